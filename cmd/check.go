@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"github.com/cyverse/s3rods/commons"
+	"github.com/cyverse/s3rods/irods"
+)
+
+const (
+	// exit codes of check, for CI
+	checkExitPassed        = 0
+	checkExitInvalidConfig = 1
+	checkExitFailed        = 2
+
+	// certificates expiring sooner are reported, but don't fail the check
+	certificateExpiryWarning = 14 * 24 * time.Hour
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check config and connectivity of S3Rods Service",
+	Long:  "Validate the config, connect to iRODS as the admin user and check collections, the data root dir and TLS certificates. Exits with 0 if all checks pass, 1 if the config is invalid, 2 if any check fails.",
+	RunE:  processCheckCommand,
+}
+
+// checkResult is a line of the check report
+type checkResult struct {
+	name    string
+	message string
+	err     error
+	skipped bool
+}
+
+func setCheckCommand(command *cobra.Command) {
+	checkCmd.Flags().BoolP("debug", "d", false, "Enable debug mode")
+	checkCmd.Flags().StringP("config", "c", "", "Set config file (yaml)")
+	checkCmd.Flags().Duration("timeout", 30*time.Second, "Set timeout of iRODS checks")
+
+	command.AddCommand(checkCmd)
+}
+
+func processCheckCommand(command *cobra.Command, args []string) error {
+	debug, _ := command.Flags().GetBool("debug")
+	if debug {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		// errors are in the report
+		log.SetLevel(log.FatalLevel)
+	}
+
+	configPath, _ := command.Flags().GetString("config")
+	timeout, _ := command.Flags().GetDuration("timeout")
+
+	config, err := commons.LoadConfig(configPath)
+	if err == nil {
+		err = config.Validate()
+	}
+
+	if err != nil {
+		printCheckResult(checkResult{name: "config", err: err})
+		fmt.Println("FAILED: config is invalid")
+		os.Exit(checkExitInvalidConfig)
+	}
+
+	configMessage := "valid"
+	if len(config.ConfigFilePath) > 0 {
+		configMessage = fmt.Sprintf("%s is valid", config.ConfigFilePath)
+	}
+
+	results := []checkResult{
+		{name: "config", message: configMessage},
+	}
+	results = append(results, checkDataRoot(config))
+	results = append(results, checkTls(config))
+	results = append(results, checkIrods(config, timeout)...)
+
+	failed := 0
+	for _, result := range results {
+		printCheckResult(result)
+		if result.err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("FAILED: %d of %d checks failed\n", failed, len(results))
+		os.Exit(checkExitFailed)
+	}
+
+	fmt.Printf("PASSED: %d checks\n", len(results))
+	os.Exit(checkExitPassed)
+	return nil
+}
+
+func printCheckResult(result checkResult) {
+	switch {
+	case result.err != nil:
+		fmt.Printf("[FAIL] %s: %s\n", result.name, result.err.Error())
+	case result.skipped:
+		fmt.Printf("[SKIP] %s: %s\n", result.name, result.message)
+	default:
+		fmt.Printf("[PASS] %s: %s\n", result.name, result.message)
+	}
+}
+
+// checkDataRoot checks the data root dir, or its nearest existing parent if not created yet, is writable and has enough space
+func checkDataRoot(config *commons.Config) checkResult {
+	result := checkResult{name: "data root"}
+
+	dirPath, err := filepath.Abs(config.DataRootPath)
+	if err != nil {
+		result.err = xerrors.Errorf("failed to get absolute path of %s: %w", config.DataRootPath, err)
+		return result
+	}
+
+	for {
+		dirInfo, err := os.Stat(dirPath)
+		if err == nil {
+			if !dirInfo.IsDir() {
+				result.err = xerrors.Errorf("%s is not a dir", dirPath)
+				return result
+			}
+			break
+		}
+
+		if !os.IsNotExist(err) || filepath.Dir(dirPath) == dirPath {
+			result.err = xerrors.Errorf("failed to stat %s: %w", dirPath, err)
+			return result
+		}
+
+		dirPath = filepath.Dir(dirPath)
+	}
+
+	testFile, err := os.CreateTemp(dirPath, ".s3rods-check-")
+	if err != nil {
+		result.err = xerrors.Errorf("%s is not writable: %w", dirPath, err)
+		return result
+	}
+	testFile.Close()
+	os.Remove(testFile.Name())
+
+	usage, err := commons.GetDiskUsage(dirPath)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	if usage.FreeBytes < uint64(config.HealthDiskFreeMin) {
+		result.err = xerrors.Errorf("%d bytes free in %s, requires %d bytes", usage.FreeBytes, dirPath, config.HealthDiskFreeMin)
+		return result
+	}
+
+	result.message = fmt.Sprintf("%s is writable, %d bytes free", dirPath, usage.FreeBytes)
+	return result
+}
+
+// checkTls checks the certificate matches the key and is valid now
+func checkTls(config *commons.Config) checkResult {
+	result := checkResult{name: "tls"}
+
+	if !config.IsTlsEnabled() {
+		result.skipped = true
+		result.message = "tls is disabled"
+		return result
+	}
+
+	certificate, err := tls.LoadX509KeyPair(config.TlsCertPath, config.TlsKeyPath)
+	if err != nil {
+		result.err = xerrors.Errorf("failed to load key pair %s, %s: %w", config.TlsCertPath, config.TlsKeyPath, err)
+		return result
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		result.err = xerrors.Errorf("failed to parse certificate %s: %w", config.TlsCertPath, err)
+		return result
+	}
+
+	now := time.Now()
+	if now.Before(leaf.NotBefore) {
+		result.err = xerrors.Errorf("certificate %s is not valid until %s", config.TlsCertPath, leaf.NotBefore.Format(time.RFC3339))
+		return result
+	}
+
+	if now.After(leaf.NotAfter) {
+		result.err = xerrors.Errorf("certificate %s expired at %s", config.TlsCertPath, leaf.NotAfter.Format(time.RFC3339))
+		return result
+	}
+
+	result.message = fmt.Sprintf("certificate for %s is valid until %s", strings.Join(getCertificateNames(leaf), ", "), leaf.NotAfter.Format(time.RFC3339))
+	if leaf.NotAfter.Sub(now) < certificateExpiryWarning {
+		result.message += ", expiring soon"
+	}
+
+	return result
+}
+
+func getCertificateNames(certificate *x509.Certificate) []string {
+	if len(certificate.DNSNames) > 0 {
+		return certificate.DNSNames
+	}
+
+	return []string{certificate.Subject.CommonName}
+}
+
+// checkIrods resolves the iRODS host, logs in as the admin user and checks collections
+// later checks are skipped if the host can't be reached
+func checkIrods(config *commons.Config, timeout time.Duration) []checkResult {
+	results := []checkResult{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resolveResult := checkResult{name: "irods host"}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, config.IrodsHost)
+	if err != nil {
+		resolveResult.err = xerrors.Errorf("failed to resolve %s: %w", config.IrodsHost, err)
+	} else {
+		resolveResult.message = fmt.Sprintf("%s resolves to %s", config.IrodsHost, strings.Join(addrs, ", "))
+	}
+	results = append(results, resolveResult)
+
+	controller, err := irods.Start(config)
+	if err != nil {
+		return append(results, checkResult{name: "irods login", err: err})
+	}
+	defer controller.Stop()
+
+	loginResult := checkResult{name: "irods login"}
+	if resolveResult.err != nil {
+		loginResult.skipped = true
+		loginResult.message = "irods host is not resolved"
+	} else {
+		err = runCheck(ctx, controller.CheckConnection)
+		if err != nil {
+			loginResult.err = err
+		} else {
+			loginResult.message = fmt.Sprintf("logged in to %s:%d as %s#%s", config.IrodsHost, config.IrodsPort, config.IrodsAdminUsername, config.IrodsZone)
+		}
+	}
+	results = append(results, loginResult)
+
+	collections := []struct {
+		name string
+		path string
+	}{
+		{name: "bucket root", path: controller.GetBucketRootPath()},
+		{name: "shared dir", path: controller.GetSharedDirPath()},
+	}
+
+	for _, collection := range collections {
+		collectionResult := checkResult{name: collection.name}
+		if loginResult.err != nil || loginResult.skipped {
+			collectionResult.skipped = true
+			collectionResult.message = "irods login failed"
+		} else {
+			err = runCheck(ctx, func(ctx context.Context) error {
+				return controller.CheckCollection(ctx, collection.path)
+			})
+			if err != nil {
+				collectionResult.err = err
+			} else {
+				collectionResult.message = fmt.Sprintf("collection %s exists", collection.path)
+			}
+		}
+		results = append(results, collectionResult)
+	}
+
+	return results
+}
+
+// runCheck runs a check until the context is done, iRODS calls don't take contexts
+func runCheck(ctx context.Context, check func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return xerrors.Errorf("timed out: %w", ctx.Err())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 
 	"golang.org/x/xerrors"
@@ -16,8 +17,25 @@ import (
 
 const (
 	ChildProcessArgument = "child_process"
+
+	LogTimestampFormat = "2006-01-02 15:04:05.000000"
 )
 
+// SetLogFormatter sets the log formatter, text or json
+func SetLogFormatter(format string) {
+	if format == commons.LogFormatJSON {
+		log.SetFormatter(&log.JSONFormatter{
+			TimestampFormat: LogTimestampFormat,
+		})
+		return
+	}
+
+	log.SetFormatter(&log.TextFormatter{
+		TimestampFormat: LogTimestampFormat,
+		FullTimestamp:   true,
+	})
+}
+
 func SetCommonFlags(command *cobra.Command) {
 	command.Flags().BoolP("version", "v", false, "Print version")
 	command.Flags().BoolP("help", "h", false, "Print help")
@@ -79,58 +97,58 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.Config, io.WriteCloser
 		}
 	}
 
-	readConfig := false
-	var config *commons.Config
-
+	configPath := ""
 	configFlag := command.Flags().Lookup("config")
 	if configFlag != nil {
-		configPath := configFlag.Value.String()
-		if len(configPath) > 0 {
-			yamlBytes, err := os.ReadFile(configPath)
-			if err != nil {
-				readErr := xerrors.Errorf("failed to read config file %s: %w", configPath, err)
-				logger.Errorf("%+v", readErr)
-				return nil, nil, false, readErr // stop here
-			}
-
-			serverConfig, err := commons.NewConfigFromYAML(yamlBytes)
-			if err != nil {
-				logger.Errorf("%+v", err)
-				return nil, nil, false, err // stop here
-			}
+		configPath = configFlag.Value.String()
+	}
 
-			// overwrite config
-			config = serverConfig
-			readConfig = true
+	// kept to re-read the file on reload
+	if len(configPath) > 0 {
+		absConfigPath, err := filepath.Abs(configPath)
+		if err == nil {
+			configPath = absConfigPath
 		}
 	}
 
-	// default config
-	if !readConfig {
-		config = commons.NewDefaultConfig()
+	// defaults, overridden by the config file and S3RODS_* environment variables
+	config, err := commons.LoadConfig(configPath)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return nil, nil, false, err // stop here
 	}
 
 	// prioritize command-line flag over config files
 	if debug {
 		log.SetLevel(log.DebugLevel)
 		config.Debug = true
+		config.SetSource("debug", commons.ConfigSourceFlag+" --debug")
 	}
 
 	if foreground {
 		config.Foreground = true
 	}
 
+	// systemd tracks the main process, a child process can't notify it or receive its sockets
+	if !config.Foreground && commons.IsSystemdService() {
+		logger.Info("Running in foreground under systemd")
+		config.Foreground = true
+	}
+
 	config.ChildProcess = childProcess
 
 	if config.Debug {
 		log.SetLevel(log.DebugLevel)
 	}
 
+	SetLogFormatter(config.LogFormat)
+
 	dataRootFlag := command.Flags().Lookup("data_root")
 	if dataRootFlag != nil {
 		dataRoot := dataRootFlag.Value.String()
 		if len(dataRoot) > 0 {
 			config.DataRootPath = dataRoot
+			config.SetSource("data_root_path", commons.ConfigSourceFlag+" --data_root")
 
 			if len(config.LogPath) == 0 {
 				config.LogPath = config.GetLogFilePath()
@@ -138,7 +156,7 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.Config, io.WriteCloser
 		}
 	}
 
-	err := config.MakeLogDir()
+	err = config.MakeLogDir()
 	if err != nil {
 		logger.Errorf("%+v", err)
 		return nil, nil, false, err // stop here
@@ -159,8 +177,9 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.Config, io.WriteCloser
 		logger.Infof("Logging to %s", parentLogFilePath)
 	}
 
+	// the flag default must not override the port in config files
 	portFlag := command.Flags().Lookup("port")
-	if portFlag != nil {
+	if portFlag != nil && portFlag.Changed {
 		port, err := strconv.ParseInt(portFlag.Value.String(), 10, 64)
 		if err != nil {
 			parseErr := xerrors.Errorf("failed to convert input '%s' to int64: %w", portFlag.Value.String(), err)
@@ -170,6 +189,7 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.Config, io.WriteCloser
 
 		if port > 0 {
 			config.Port = int(port)
+			config.SetSource("port", commons.ConfigSourceFlag+" --port")
 		}
 	}
 
@@ -182,6 +202,44 @@ func ProcessCommonFlags(command *cobra.Command) (*commons.Config, io.WriteCloser
 	return config, logWriter, true, nil // continue
 }
 
+// SetConfigFlags sets flags for subcommands that only read a config file
+func SetConfigFlags(command *cobra.Command) {
+	command.Flags().BoolP("debug", "d", false, "Enable debug mode")
+	command.Flags().StringP("config", "c", "", "Set config file (yaml)")
+}
+
+// ReadConfigFromFlags reads a config file given via flags and environment variables, used by subcommands
+func ReadConfigFromFlags(command *cobra.Command) (*commons.Config, error) {
+	debugFlag := command.Flags().Lookup("debug")
+	if debugFlag != nil {
+		debug, _ := strconv.ParseBool(debugFlag.Value.String())
+		if debug {
+			log.SetLevel(log.DebugLevel)
+		}
+	}
+
+	configPath := ""
+	configFlag := command.Flags().Lookup("config")
+	if configFlag != nil {
+		configPath = configFlag.Value.String()
+	}
+
+	// settings may also be given by S3RODS_* environment variables only
+	config, err := commons.LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	SetLogFormatter(config.LogFormat)
+
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
 func PrintVersion(command *cobra.Command) error {
 	info, err := commons.GetVersionJSON()
 	if err != nil {
@@ -180,6 +180,8 @@ func ChildProcessReadConfigViaSTDIN() (*commons.Config, io.WriteCloser, error) {
 		log.SetLevel(log.DebugLevel)
 	}
 
+	SetLogFormatter(config.LogFormat)
+
 	err = config.Validate()
 	if err != nil {
 		logger.Errorf("%+v", err)
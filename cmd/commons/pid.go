@@ -0,0 +1,151 @@
+package commons
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// processCheckInterval is the interval of checking if a process stopped
+	processCheckInterval = 200 * time.Millisecond
+)
+
+// ProcessState is a state of the service found via the pid file
+type ProcessState int
+
+const (
+	// ProcessStateStopped means no pid file exists
+	ProcessStateStopped ProcessState = iota
+	// ProcessStateRunning means the process in the pid file is alive
+	ProcessStateRunning
+	// ProcessStateStale means the pid file exists, but its process is gone
+	ProcessStateStale
+)
+
+// ReadPidFile returns the process id in the pid file
+func ReadPidFile(pidFilePath string) (int, error) {
+	pidBytes, err := os.ReadFile(pidFilePath)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to read pid file %s: %w", pidFilePath, err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+	if err != nil || pid <= 0 {
+		return 0, xerrors.Errorf("failed to parse pid file %s, invalid pid %q", pidFilePath, strings.TrimSpace(string(pidBytes)))
+	}
+
+	return pid, nil
+}
+
+// GetProcessState returns a state of the service and its process id, an unreadable pid file is stale
+func GetProcessState(pidFilePath string) (ProcessState, int, error) {
+	_, err := os.Stat(pidFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ProcessStateStopped, 0, nil
+		}
+		return ProcessStateStopped, 0, xerrors.Errorf("failed to stat pid file %s: %w", pidFilePath, err)
+	}
+
+	pid, err := ReadPidFile(pidFilePath)
+	if err != nil {
+		return ProcessStateStale, 0, nil
+	}
+
+	if !IsProcessRunning(pid) {
+		return ProcessStateStale, pid, nil
+	}
+
+	return ProcessStateRunning, pid, nil
+}
+
+// WritePidFile writes the process id of this process, fails if another process of the service is running
+// a stale pid file left by a crashed process is replaced
+func WritePidFile(pidFilePath string) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "commons",
+		"function": "WritePidFile",
+	})
+
+	state, pid, err := GetProcessState(pidFilePath)
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case ProcessStateRunning:
+		if pid != os.Getpid() {
+			return xerrors.Errorf("S3Rods Service is already running with pid %d, pid file %s", pid, pidFilePath)
+		}
+	case ProcessStateStale:
+		logger.Warnf("Replacing stale pid file %s of pid %d", pidFilePath, pid)
+	}
+
+	err = os.MkdirAll(filepath.Dir(pidFilePath), 0775)
+	if err != nil {
+		return xerrors.Errorf("failed to make a dir for pid file %s: %w", pidFilePath, err)
+	}
+
+	// write to a temp file and rename so that readers never see a partial pid
+	tempPath := pidFilePath + ".tmp"
+	err = os.WriteFile(tempPath, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+	if err != nil {
+		return xerrors.Errorf("failed to write pid file %s: %w", tempPath, err)
+	}
+
+	err = os.Rename(tempPath, pidFilePath)
+	if err != nil {
+		os.Remove(tempPath)
+		return xerrors.Errorf("failed to write pid file %s: %w", pidFilePath, err)
+	}
+
+	return nil
+}
+
+// RemovePidFile removes the pid file if it holds the process id of this process
+func RemovePidFile(pidFilePath string) error {
+	pid, err := ReadPidFile(pidFilePath)
+	if err != nil {
+		if xerrors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if pid != os.Getpid() {
+		// written by another instance
+		return nil
+	}
+
+	err = os.Remove(pidFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("failed to remove pid file %s: %w", pidFilePath, err)
+	}
+
+	return nil
+}
+
+// StopProcess asks the process to terminate and waits until it exits
+func StopProcess(pid int, timeout time.Duration) error {
+	err := terminateProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for IsProcessRunning(pid) {
+		if time.Now().After(deadline) {
+			return xerrors.Errorf("process %d did not stop in %s", pid, timeout)
+		}
+
+		time.Sleep(processCheckInterval)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package commons
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// IsProcessRunning checks if the process is alive
+func IsProcessRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	// signal 0 checks existence without signaling, EPERM means it exists but is owned by another user
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || xerrors.Is(err, syscall.EPERM)
+}
+
+// terminateProcess sends SIGTERM to the process
+func terminateProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return xerrors.Errorf("failed to find process %d: %w", pid, err)
+	}
+
+	err = process.Signal(syscall.SIGTERM)
+	if err != nil {
+		return xerrors.Errorf("failed to send SIGTERM to process %d: %w", pid, err)
+	}
+
+	return nil
+}
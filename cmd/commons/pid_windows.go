@@ -0,0 +1,46 @@
+//go:build windows
+
+package commons
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/xerrors"
+)
+
+// stillActive is the exit code of processes not exited yet, STILL_ACTIVE
+const stillActive = 259
+
+// IsProcessRunning checks if the process is alive
+func IsProcessRunning(pid int) bool {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// access denied means it exists but is owned by another user
+		return xerrors.Is(err, windows.ERROR_ACCESS_DENIED)
+	}
+	defer windows.CloseHandle(handle)
+
+	var exitCode uint32
+	err = windows.GetExitCodeProcess(handle, &exitCode)
+	if err != nil {
+		return false
+	}
+
+	return exitCode == stillActive
+}
+
+// terminateProcess kills the process, windows has no SIGTERM to deliver to a console-less process
+func terminateProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return xerrors.Errorf("failed to find process %d: %w", pid, err)
+	}
+
+	err = process.Kill()
+	if err != nil {
+		return xerrors.Errorf("failed to kill process %d: %w", pid, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	cmd_commons "github.com/cyverse/s3rods/cmd/commons"
+	"github.com/cyverse/s3rods/commons"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect S3Rods Service config",
+	Long:  "Inspect the config of S3Rods Service merged from defaults, the config file and S3RODS_* environment variables.",
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print effective config",
+	Long:  "Print the effective config in YAML, with where each setting comes from as a comment.",
+	RunE:  processConfigPrintCommand,
+}
+
+func setConfigCommand(command *cobra.Command) {
+	cmd_commons.SetConfigFlags(configPrintCmd)
+	configPrintCmd.Flags().Bool("redacted", false, "Hide secrets, such as irods_admin_password")
+
+	configCmd.AddCommand(configPrintCmd)
+	command.AddCommand(configCmd)
+}
+
+func processConfigPrintCommand(command *cobra.Command, args []string) error {
+	debug, _ := command.Flags().GetBool("debug")
+	if debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	configPath, _ := command.Flags().GetString("config")
+	redacted, _ := command.Flags().GetBool("redacted")
+
+	config, err := commons.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	configYAML, err := config.PrintYAML(redacted)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(configYAML)
+
+	// printed first, to help finding the invalid setting
+	err = config.Validate()
+	if err != nil {
+		return xerrors.Errorf("invalid configuration: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	cmd_commons "github.com/cyverse/s3rods/cmd/commons"
+	"github.com/cyverse/s3rods/commons"
+)
+
+const (
+	// stopTimeoutMargin is added to the shutdown timeout of the config when waiting for the service to exit
+	stopTimeoutMargin = 30 * time.Second
+
+	// exit codes of status, following LSB init scripts
+	statusExitRunning    = 0
+	statusExitStale      = 1
+	statusExitNotRunning = 3
+)
+
+var stopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop S3Rods Service",
+	Long:  "Stop S3Rods Service running in the data root dir of the config, waits until it exits.",
+	RunE:  processStopCommand,
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Print status of S3Rods Service",
+	Long:  "Print status of S3Rods Service running in the data root dir of the config. Exits with 0 if running, 1 if the pid file is stale, 3 if not running.",
+	RunE:  processStatusCommand,
+}
+
+var restartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "Restart S3Rods Service",
+	Long:  "Stop S3Rods Service if running and start it in the background with the config.",
+	RunE:  processRestartCommand,
+}
+
+func setLifecycleCommands(command *cobra.Command) {
+	for _, lifecycleCmd := range []*cobra.Command{stopCmd, statusCmd, restartCmd} {
+		cmd_commons.SetConfigFlags(lifecycleCmd)
+		lifecycleCmd.Flags().String("data_root", "", "Set data root dir path")
+		command.AddCommand(lifecycleCmd)
+	}
+
+	stopCmd.Flags().Duration("timeout", 0, "Set time to wait for the service to exit (default shutdown_timeout + 30s)")
+	restartCmd.Flags().Duration("timeout", 0, "Set time to wait for the service to exit (default shutdown_timeout + 30s)")
+}
+
+// readLifecycleConfig reads the config locating the pid file
+func readLifecycleConfig(command *cobra.Command) (*commons.Config, error) {
+	config, err := cmd_commons.ReadConfigFromFlags(command)
+	if err != nil {
+		return nil, err
+	}
+
+	dataRoot, _ := command.Flags().GetString("data_root")
+	if len(dataRoot) > 0 {
+		config.DataRootPath = dataRoot
+	}
+
+	return config, nil
+}
+
+// getStopTimeout returns time to wait for the service to exit, long enough for it to drain requests
+func getStopTimeout(command *cobra.Command, config *commons.Config) time.Duration {
+	timeout, _ := command.Flags().GetDuration("timeout")
+	if timeout > 0 {
+		return timeout
+	}
+
+	return config.ShutdownTimeout + stopTimeoutMargin
+}
+
+// stopService stops the service if running, a stale pid file is removed
+func stopService(config *commons.Config, timeout time.Duration) error {
+	pidFilePath := config.GetPidFilePath()
+
+	state, pid, err := cmd_commons.GetProcessState(pidFilePath)
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case cmd_commons.ProcessStateStopped:
+		fmt.Println("S3Rods Service is not running")
+		return nil
+	case cmd_commons.ProcessStateStale:
+		fmt.Printf("S3Rods Service is not running, removing stale pid file %s\n", pidFilePath)
+		err = os.Remove(pidFilePath)
+		if err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("failed to remove stale pid file %s: %w", pidFilePath, err)
+		}
+		return nil
+	}
+
+	fmt.Printf("Stopping S3Rods Service (pid %d)\n", pid)
+	err = cmd_commons.StopProcess(pid, timeout)
+	if err != nil {
+		return xerrors.Errorf("failed to stop S3Rods Service: %w", err)
+	}
+
+	fmt.Println("S3Rods Service is stopped")
+	return nil
+}
+
+func processStopCommand(command *cobra.Command, args []string) error {
+	config, err := readLifecycleConfig(command)
+	if err != nil {
+		return err
+	}
+
+	return stopService(config, getStopTimeout(command, config))
+}
+
+func processStatusCommand(command *cobra.Command, args []string) error {
+	config, err := readLifecycleConfig(command)
+	if err != nil {
+		return err
+	}
+
+	pidFilePath := config.GetPidFilePath()
+
+	state, pid, err := cmd_commons.GetProcessState(pidFilePath)
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case cmd_commons.ProcessStateRunning:
+		fmt.Printf("S3Rods Service is running (pid %d)\n", pid)
+		os.Exit(statusExitRunning)
+	case cmd_commons.ProcessStateStale:
+		fmt.Printf("S3Rods Service is not running, but pid file %s exists (pid %d)\n", pidFilePath, pid)
+		os.Exit(statusExitStale)
+	default:
+		fmt.Println("S3Rods Service is not running")
+		os.Exit(statusExitNotRunning)
+	}
+
+	return nil
+}
+
+func processRestartCommand(command *cobra.Command, args []string) error {
+	config, err := readLifecycleConfig(command)
+	if err != nil {
+		return err
+	}
+
+	err = stopService(config, getStopTimeout(command, config))
+	if err != nil {
+		return err
+	}
+
+	// start in the background like the root command does
+	childStdin, childStdout, err := cmd_commons.RunChildProcess(os.Args[0])
+	if err != nil {
+		return xerrors.Errorf("failed to run S3Rods Service child process: %w", err)
+	}
+
+	err = cmd_commons.ParentProcessSendConfigViaSTDIN(config, childStdin, childStdout)
+	if err != nil {
+		return xerrors.Errorf("failed to send configuration to S3Rods Service child process: %w", err)
+	}
+
+	fmt.Println("S3Rods Service is started")
+	return nil
+}
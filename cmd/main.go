@@ -2,10 +2,10 @@ package main
 
 import (
 	"fmt"
-	_ "net/http/pprof"
 	"os"
 	"os/signal"
 	"sync"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/xerrors"
@@ -56,10 +56,7 @@ func processCommand(command *cobra.Command, args []string) error {
 }
 
 func main() {
-	log.SetFormatter(&log.TextFormatter{
-		TimestampFormat: "2006-01-02 15:04:05.000000",
-		FullTimestamp:   true,
-	})
+	cmd_commons.SetLogFormatter(commons.LogFormatText)
 
 	log.SetLevel(log.InfoLevel)
 
@@ -71,6 +68,12 @@ func main() {
 	// attach common flags
 	cmd_commons.SetCommonFlags(rootCmd)
 
+	// attach subcommands
+	setTicketsCommand(rootCmd)
+	setLifecycleCommands(rootCmd)
+	setConfigCommand(rootCmd)
+	setCheckCommand(rootCmd)
+
 	err := Execute()
 	if err != nil {
 		logger.Fatalf("%+v", err)
@@ -193,6 +196,25 @@ func run(config *commons.Config, isChildProcess bool) error {
 		return err
 	}
 
+	// refuse to start while another instance is running, before binding ports
+	err = cmd_commons.WritePidFile(config.GetPidFilePath())
+	if err != nil {
+		pidErr := xerrors.Errorf("failed to write pid file: %w", err)
+		logger.Errorf("%+v", pidErr)
+		if isChildProcess {
+			cmd_commons.ReportChildProcessError()
+		}
+		return err
+	}
+	defer cmd_commons.RemovePidFile(config.GetPidFilePath())
+
+	tracing, err := commons.StartTracing(config)
+	if err != nil {
+		tracingErr := xerrors.Errorf("failed to start tracing: %w", err)
+		logger.Errorf("%+v", tracingErr)
+		return err
+	}
+
 	irodsController, err := irods.Start(config)
 	if err != nil {
 		configErr := xerrors.Errorf("failed to start IRODS controller: %w", err)
@@ -218,16 +240,22 @@ func run(config *commons.Config, isChildProcess bool) error {
 		}
 	}
 
+	// systemd with Type=notify starts dependent units once ready
+	commons.SystemdNotify(commons.SystemdNotifyReady)
+
 	defer func() {
+		commons.SystemdNotify(commons.SystemdNotifyStopping)
+
 		svc.Stop()
 		irodsController.Stop()
+		tracing.Stop()
 
 		// remove work dir
 		config.CleanWorkDirs()
-
-		os.Exit(0)
 	}()
 
+	handleHangup(svc)
+
 	// wait
 	waitForCtrlC()
 
@@ -240,7 +268,7 @@ func waitForCtrlC() {
 	endWaiter.Add(1)
 	signalChannel := make(chan os.Signal, 1)
 
-	signal.Notify(signalChannel, os.Interrupt)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		<-signalChannel
@@ -249,3 +277,25 @@ func waitForCtrlC() {
 
 	endWaiter.Wait()
 }
+
+// handleHangup reloads the config file and the TLS certificate on SIGHUP
+func handleHangup(svc *s3.S3Service) {
+	logger := log.WithFields(log.Fields{
+		"package":  "main",
+		"function": "handleHangup",
+	})
+
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, syscall.SIGHUP)
+
+	go func() {
+		for range signalChannel {
+			logger.Info("Received SIGHUP, reloading configuration")
+
+			_, err := svc.ReloadConfig()
+			if err != nil {
+				logger.Errorf("failed to reload configuration, keeping the current one: %+v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	cmd_commons "github.com/cyverse/s3rods/cmd/commons"
+	"github.com/cyverse/s3rods/commons"
+	"github.com/cyverse/s3rods/irods"
+	"github.com/cyverse/s3rods/s3"
+)
+
+var ticketsCmd = &cobra.Command{
+	Use:   "tickets",
+	Short: "Manage iRODS tickets for S3 access",
+	Long:  "Manage iRODS tickets that are used as S3 credentials.",
+}
+
+var ticketsCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an iRODS ticket for S3 access",
+	Long:  "Create an iRODS ticket and print S3 credentials and a presigned URL using the ticket.",
+	RunE:  processTicketsCreateCommand,
+}
+
+func setTicketsCommand(command *cobra.Command) {
+	cmd_commons.SetConfigFlags(ticketsCreateCmd)
+	ticketsCreateCmd.Flags().StringP("user", "u", "", "Set owner of the ticket")
+	ticketsCreateCmd.Flags().StringP("path", "p", "", "Set iRODS path to share")
+	ticketsCreateCmd.Flags().StringP("type", "t", string(irodsclient_types.TicketTypeRead), "Set ticket type (read or write)")
+	ticketsCreateCmd.Flags().Int64("uses", 0, "Set uses limit of the ticket (0 for unlimited)")
+	ticketsCreateCmd.Flags().Duration("expire", 0, "Set expiry of the ticket (0 for no expiry)")
+	ticketsCreateCmd.Flags().StringSlice("host", []string{}, "Add a host allowed to use the ticket")
+	ticketsCreateCmd.Flags().String("endpoint", "", "Set S3 endpoint URL (default http://localhost:<port>)")
+	ticketsCreateCmd.Flags().Duration("url_expire", 24*time.Hour, "Set expiry of the presigned URL (max 168h)")
+
+	ticketsCmd.AddCommand(ticketsCreateCmd)
+	command.AddCommand(ticketsCmd)
+}
+
+func processTicketsCreateCommand(command *cobra.Command, args []string) error {
+	config, err := cmd_commons.ReadConfigFromFlags(command)
+	if err != nil {
+		return err
+	}
+
+	username, _ := command.Flags().GetString("user")
+	irodsPath, _ := command.Flags().GetString("path")
+	ticketTypeString, _ := command.Flags().GetString("type")
+	usesLimit, _ := command.Flags().GetInt64("uses")
+	expire, _ := command.Flags().GetDuration("expire")
+	hosts, _ := command.Flags().GetStringSlice("host")
+	endpoint, _ := command.Flags().GetString("endpoint")
+	urlExpire, _ := command.Flags().GetDuration("url_expire")
+
+	if len(username) == 0 {
+		return xerrors.Errorf("user must be given")
+	}
+
+	if len(irodsPath) == 0 {
+		return xerrors.Errorf("path must be given")
+	}
+
+	ticketType := irodsclient_types.TicketType(ticketTypeString)
+	if ticketType != irodsclient_types.TicketTypeRead && ticketType != irodsclient_types.TicketTypeWrite {
+		return xerrors.Errorf("unknown ticket type %s", ticketTypeString)
+	}
+
+	if len(endpoint) == 0 {
+		endpoint, err = getDefaultEndpoint(config)
+		if err != nil {
+			return err
+		}
+	}
+
+	expireTime := time.Time{}
+	if expire > 0 {
+		expireTime = time.Now().Add(expire)
+	}
+
+	irodsController, err := irods.Start(config)
+	if err != nil {
+		return xerrors.Errorf("failed to start IRODS controller: %w", err)
+	}
+	defer irodsController.Stop()
+
+	bucket, key, err := irodsController.SplitPath(irodsPath)
+	if err != nil {
+		return err
+	}
+
+	ticketString, err := irodsController.CreateTicket(context.Background(), username, irodsPath, ticketType, usesLimit, expireTime, hosts)
+	if err != nil {
+		return err
+	}
+
+	ticket, err := irodsController.GetTicket(context.Background(), ticketString)
+	if err != nil {
+		return err
+	}
+
+	// collections are shared as a listing of the bucket with the prefix
+	query := url.Values{}
+	objectKey := key
+	if ticket.Path == irodsPath && irodsController.IsCollection(context.Background(), irodsPath) {
+		objectKey = ""
+		if len(key) > 0 {
+			query.Set("prefix", strings.TrimSuffix(key, "/")+"/")
+		}
+	}
+
+	accessKey := s3.TicketAccessKeyPrefix + ticketString
+	secretKey := irodsController.GetTicketSecretKey(ticketString)
+	presignedURL, err := s3.GetPresignedURL(endpoint, "GET", bucket, objectKey, query, accessKey, secretKey, config.GetRegion(), urlExpire)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Ticket: %s\n", ticketString)
+	fmt.Printf("Path: %s\n", ticket.Path)
+	fmt.Printf("Type: %s\n", ticket.Type)
+	if !ticket.ExpireTime.IsZero() {
+		fmt.Printf("Expires: %s\n", ticket.ExpireTime.Format(time.RFC3339))
+	}
+	fmt.Printf("Access Key: %s\n", accessKey)
+	fmt.Printf("Secret Key: %s\n", secretKey)
+	fmt.Printf("URL: %s\n", presignedURL)
+	return nil
+}
+
+// getDefaultEndpoint returns a URL of the first tcp listener serving the S3 API on localhost
+func getDefaultEndpoint(config *commons.Config) (string, error) {
+	for _, listener := range config.GetListeners() {
+		if listener.IsUnixSocket() || !listener.IsS3Served() {
+			continue
+		}
+
+		_, port, err := net.SplitHostPort(listener.Address)
+		if err != nil {
+			return "", xerrors.Errorf("failed to get port of listener %s: %w", listener.Address, err)
+		}
+
+		scheme := "http"
+		if listener.Tls {
+			scheme = "https"
+		}
+
+		return fmt.Sprintf("%s://localhost:%s", scheme, port), nil
+	}
+
+	return "", xerrors.Errorf("no tcp listener serves the S3 API, endpoint must be given")
+}
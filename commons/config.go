@@ -4,15 +4,49 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"golang.org/x/xerrors"
 	yaml "gopkg.in/yaml.v2"
 )
 
 const (
+	maxPort                      int = 65535
+	adminTokenLengthMin          int = 16
+	keyEncryptionSecretLengthMin int = 32
+
 	ServicePortDefault        int    = 8080
 	IrodsPortDefault          int    = 1247
 	IrodsSharedDirnameDefault string = "public"
+
+	LogFormatText string = "text"
+	LogFormatJSON string = "json"
+
+	RegionDefault       string        = "us-east-1"
+	ClockSkewMaxDefault time.Duration = 15 * time.Minute
+
+	AuthCacheTimeoutDefault         time.Duration = 5 * time.Minute
+	AuthNegativeCacheTimeoutDefault time.Duration = 30 * time.Second
+
+	StsDurationMaxDefault time.Duration = 12 * time.Hour
+
+	OidcUsernameClaimDefault string = "preferred_username"
+
+	BucketLoggingFlushIntervalDefault time.Duration = 5 * time.Minute
+
+	// ReservedPathPrefix is the path prefix of s3rods endpoints, never a valid bucket name
+	ReservedPathPrefix string = "/_s3rods/"
+	MetricsPathDefault string = ReservedPathPrefix + "metrics"
+
+	ShutdownTimeoutDefault time.Duration = 30 * time.Second
+
+	HealthCheckTimeoutDefault time.Duration = 5 * time.Second
+	HealthDiskFreeMinDefault  int64         = 100 * 1024 * 1024 // 100MB
+
+	TracingExporterOTLP   string = "otlp"
+	TracingExporterStdout string = "stdout"
+	TracingExporterFile   string = "file"
 )
 
 func GetDefaultDataRootDirPath() string {
@@ -28,18 +62,103 @@ type Config struct {
 	Port         int    `yaml:"port"`
 	DataRootPath string `yaml:"data_root_path,omitempty"`
 
-	LogPath string `yaml:"log_path,omitempty"`
+	// the port serves HTTPS if a certificate is given, plaintext is served alongside only if http port is given
+	TlsCertPath string `yaml:"tls_cert_path,omitempty"`
+	TlsKeyPath  string `yaml:"tls_key_path,omitempty"`
+	HttpPort    int    `yaml:"http_port,omitempty"`
+	// replaces port and http port if given
+	Listeners []ListenerConfig `yaml:"listeners,omitempty"`
+	// IPs or CIDRs of reverse proxies, their X-Forwarded-* headers and PROXY protocol headers are honored
+	// connections over unix sockets are always trusted
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+
+	PidFilePath string `yaml:"pid_file_path,omitempty"`
+	// time given to in-flight requests on shutdown, requests still running are cut off
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout,omitempty"`
+
+	LogPath   string `yaml:"log_path,omitempty"`
+	LogFormat string `yaml:"log_format,omitempty"`
+	// S3 server access log in AWS format, empty disables it
+	AccessLogPath string `yaml:"access_log_path,omitempty"`
+	// audit log of admin actions in JSON lines, always written
+	AdminAuditLogPath string `yaml:"admin_audit_log_path,omitempty"`
 
 	IrodsHost          string `yaml:"irods_host"`
 	IrodsPort          int    `yaml:"irods_port"`
+	IrodsZone          string `yaml:"irods_zone"`
 	IrodsAdminUsername string `yaml:"irods_admin_username"`
 	IrodsAdminPassword string `yaml:"irods_admin_password"`
 
 	IrodsSharedDirname string `yaml:"irods_shared_dirname,omitempty"`
 
+	// users exempted from limits, the irods admin user is always an admin
+	AdminUsers []string `yaml:"admin_users,omitempty"`
+	// bearer token accepted by admin endpoints besides requests signed by admin users, empty disables it
+	AdminToken string `yaml:"admin_token,omitempty"`
+	// secret shared by all instances encrypting secret keys stored in iRODS and deriving ticket secret keys
+	// stored keys are unreadable and ticket credentials are invalid without it
+	KeyEncryptionSecret string `yaml:"key_encryption_secret"`
+
+	// regions accepted in SigV4 credential scopes, the first is reported to clients
+	Regions      []string      `yaml:"regions,omitempty"`
+	ClockSkewMax time.Duration `yaml:"clock_skew_max,omitempty"`
+
+	// signing keys and unknown access keys are cached, zero disables caching
+	AuthCacheTimeout         time.Duration `yaml:"auth_cache_timeout,omitempty"`
+	AuthNegativeCacheTimeout time.Duration `yaml:"auth_negative_cache_timeout,omitempty"`
+
+	// requests per second with bursts and concurrent requests, zero disables the limit
+	RateLimitPerUser             float64 `yaml:"rate_limit_per_user,omitempty"`
+	RateLimitBurstPerUser        int     `yaml:"rate_limit_burst_per_user,omitempty"`
+	MaxConcurrentRequestsPerUser int     `yaml:"max_concurrent_requests_per_user,omitempty"`
+	RateLimitPerIP               float64 `yaml:"rate_limit_per_ip,omitempty"`
+	RateLimitBurstPerIP          int     `yaml:"rate_limit_burst_per_ip,omitempty"`
+	MaxConcurrentRequestsPerIP   int     `yaml:"max_concurrent_requests_per_ip,omitempty"`
+
+	// bytes per second of object streams with bursts in bytes, zero disables the limit
+	BandwidthLimit        int64 `yaml:"bandwidth_limit,omitempty"`
+	BandwidthBurst        int64 `yaml:"bandwidth_burst,omitempty"`
+	BandwidthLimitPerUser int64 `yaml:"bandwidth_limit_per_user,omitempty"`
+	BandwidthBurstPerUser int64 `yaml:"bandwidth_burst_per_user,omitempty"`
+
+	// bytes a user can own in the zone in addition to iRODS quotas, zero disables the quota
+	UserQuota int64 `yaml:"user_quota,omitempty"`
+
+	StsKeyPath     string        `yaml:"sts_key_path,omitempty"`
+	StsDurationMax time.Duration `yaml:"sts_duration_max,omitempty"`
+
+	// OIDC provider trusted by AssumeRoleWithWebIdentity, disabled if no JWKS is given
+	OidcIssuer        string `yaml:"oidc_issuer,omitempty"`
+	OidcAudience      string `yaml:"oidc_audience,omitempty"`
+	OidcJwksPath      string `yaml:"oidc_jwks_path,omitempty"`
+	OidcJwksURL       string `yaml:"oidc_jwks_url,omitempty"`
+	OidcUsernameClaim string `yaml:"oidc_username_claim,omitempty"`
+
+	// interval of writing batched server access logs into target buckets
+	BucketLoggingFlushInterval time.Duration `yaml:"bucket_logging_flush_interval,omitempty"`
+
+	// path of the prometheus endpoint under /_s3rods/, served by admin listeners, empty disables it
+	MetricsPath string `yaml:"metrics_path"`
+
+	// time given to each readiness check, and free bytes required in the data root dir, zero disables the disk check
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout,omitempty"`
+	HealthDiskFreeMin  int64         `yaml:"health_disk_free_min,omitempty"`
+
+	// tracing exporter, otlp, stdout or file, empty disables tracing
+	TracingExporter string `yaml:"tracing_exporter,omitempty"`
+	// OTLP/HTTP collector endpoint, e.g., http://localhost:4318
+	TracingEndpoint    string  `yaml:"tracing_endpoint,omitempty"`
+	TracingFilePath    string  `yaml:"tracing_file_path,omitempty"`
+	TracingSampleRatio float64 `yaml:"tracing_sample_ratio,omitempty"`
+
 	Foreground   bool `yaml:"foreground,omitempty"`
 	Debug        bool `yaml:"debug,omitempty"`
 	ChildProcess bool `yaml:"childprocess,omitempty"`
+	// config file read, passed to the child process to re-read it on reload
+	ConfigFilePath string `yaml:"config_file_path,omitempty"`
+
+	// sources of settings, yaml key -> source, not passed to the child process
+	sources map[string]string
 }
 
 // NewDefaultConfig returns a default config
@@ -48,17 +167,79 @@ func NewDefaultConfig() *Config {
 		Port:         ServicePortDefault,
 		DataRootPath: GetDefaultDataRootDirPath(),
 
-		LogPath: "", // use default
+		TlsCertPath: "", // disabled
+		TlsKeyPath:  "",
+		HttpPort:    0,   // disabled
+		Listeners:   nil, // use port and http port
+
+		TrustedProxies: []string{}, // trust no proxies
+
+		PidFilePath:     "", // use default
+		ShutdownTimeout: ShutdownTimeoutDefault,
+
+		LogPath:       "", // use default
+		LogFormat:     LogFormatText,
+		AccessLogPath: "", // disabled
+
+		AdminAuditLogPath: "", // use default
 
 		IrodsHost:          "",
 		IrodsPort:          IrodsPortDefault,
+		IrodsZone:          "",
 		IrodsAdminUsername: "",
 		IrodsAdminPassword: "",
 		IrodsSharedDirname: IrodsSharedDirnameDefault,
 
-		Foreground:   false,
-		Debug:        false,
-		ChildProcess: false,
+		AdminUsers: []string{},
+		AdminToken: "", // disabled
+
+		KeyEncryptionSecret: "",
+
+		Regions:      []string{RegionDefault},
+		ClockSkewMax: ClockSkewMaxDefault,
+
+		AuthCacheTimeout:         AuthCacheTimeoutDefault,
+		AuthNegativeCacheTimeout: AuthNegativeCacheTimeoutDefault,
+
+		RateLimitPerUser:             0, // unlimited
+		RateLimitBurstPerUser:        0,
+		MaxConcurrentRequestsPerUser: 0,
+		RateLimitPerIP:               0,
+		RateLimitBurstPerIP:          0,
+		MaxConcurrentRequestsPerIP:   0,
+
+		BandwidthLimit:        0, // unlimited
+		BandwidthBurst:        0, // a second of the limit
+		BandwidthLimitPerUser: 0,
+		BandwidthBurstPerUser: 0,
+
+		UserQuota: 0, // unlimited
+
+		StsKeyPath:     "", // use default
+		StsDurationMax: StsDurationMaxDefault,
+
+		OidcIssuer:        "",
+		OidcAudience:      "",
+		OidcJwksPath:      "",
+		OidcJwksURL:       "",
+		OidcUsernameClaim: OidcUsernameClaimDefault,
+
+		BucketLoggingFlushInterval: BucketLoggingFlushIntervalDefault,
+
+		MetricsPath: MetricsPathDefault,
+
+		HealthCheckTimeout: HealthCheckTimeoutDefault,
+		HealthDiskFreeMin:  HealthDiskFreeMinDefault,
+
+		TracingExporter:    "", // disabled
+		TracingEndpoint:    "",
+		TracingFilePath:    "", // use default
+		TracingSampleRatio: 1,
+
+		Foreground:     false,
+		Debug:          false,
+		ChildProcess:   false,
+		ConfigFilePath: "",
 	}
 }
 
@@ -84,6 +265,81 @@ func (config *Config) GetLogFilePath() string {
 	return path.Join(config.DataRootPath, "service.log")
 }
 
+// GetAdminAuditLogFilePath returns a path to the audit log of admin actions
+func (config *Config) GetAdminAuditLogFilePath() string {
+	if len(config.AdminAuditLogPath) > 0 {
+		return config.AdminAuditLogPath
+	}
+
+	// default
+	return path.Join(config.DataRootPath, "admin_audit.log")
+}
+
+// GetPidFilePath returns a path to the file holding the process id of the running service
+func (config *Config) GetPidFilePath() string {
+	if len(config.PidFilePath) > 0 {
+		return config.PidFilePath
+	}
+
+	// default
+	return path.Join(config.DataRootPath, "s3rods.pid")
+}
+
+// GetStsKeyPath returns a path to the key signing STS session tokens
+func (config *Config) GetStsKeyPath() string {
+	if len(config.StsKeyPath) > 0 {
+		return config.StsKeyPath
+	}
+
+	// default
+	return path.Join(config.DataRootPath, "sts.key")
+}
+
+// GetRegion returns the primary region
+func (config *Config) GetRegion() string {
+	if len(config.Regions) > 0 {
+		return config.Regions[0]
+	}
+
+	// default
+	return RegionDefault
+}
+
+// GetTracingFilePath returns a path to the file that the file exporter writes spans to
+func (config *Config) GetTracingFilePath() string {
+	if len(config.TracingFilePath) > 0 {
+		return config.TracingFilePath
+	}
+
+	// default
+	return path.Join(config.DataRootPath, "traces.json")
+}
+
+// IsAdminUser checks if the user is an admin
+func (config *Config) IsAdminUser(username string) bool {
+	if username == config.IrodsAdminUsername {
+		return true
+	}
+
+	for _, adminUser := range config.AdminUsers {
+		if username == adminUser {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsOidcEnabled checks if an OIDC provider is configured
+func (config *Config) IsOidcEnabled() bool {
+	return len(config.OidcJwksPath) > 0 || len(config.OidcJwksURL) > 0
+}
+
+// IsTlsEnabled checks if a certificate is configured
+func (config *Config) IsTlsEnabled() bool {
+	return len(config.TlsCertPath) > 0 || len(config.TlsKeyPath) > 0
+}
+
 // MakeLogDir makes a log dir required
 func (config *Config) MakeLogDir() error {
 	logFilePath := config.GetLogFilePath()
@@ -150,10 +406,35 @@ func (config *Config) Validate() error {
 		return xerrors.Errorf("service port must be given")
 	}
 
+	if config.Port > maxPort {
+		return xerrors.Errorf("service port %d is out of range", config.Port)
+	}
+
 	if len(config.DataRootPath) == 0 {
 		return xerrors.Errorf("data root dir must be given")
 	}
 
+	if config.IsTlsEnabled() {
+		if len(config.TlsCertPath) == 0 || len(config.TlsKeyPath) == 0 {
+			return xerrors.Errorf("both tls cert path and tls key path must be given")
+		}
+
+		if config.HttpPort < 0 || config.HttpPort > maxPort {
+			return xerrors.Errorf("http port %d is out of range", config.HttpPort)
+		}
+
+		if config.HttpPort == config.Port {
+			return xerrors.Errorf("http port must differ from the service port")
+		}
+	} else if config.HttpPort != 0 {
+		return xerrors.Errorf("http port requires tls cert path and tls key path")
+	}
+
+	err := config.validateListeners()
+	if err != nil {
+		return err
+	}
+
 	if len(config.IrodsHost) == 0 {
 		return xerrors.Errorf("irods host must be given")
 	}
@@ -162,6 +443,18 @@ func (config *Config) Validate() error {
 		return xerrors.Errorf("irods port must be given")
 	}
 
+	if config.IrodsPort > maxPort {
+		return xerrors.Errorf("irods port %d is out of range", config.IrodsPort)
+	}
+
+	if len(config.IrodsSharedDirname) == 0 || strings.Contains(config.IrodsSharedDirname, "/") {
+		return xerrors.Errorf("irods shared dirname must be a single path element")
+	}
+
+	if len(config.IrodsZone) == 0 {
+		return xerrors.Errorf("irods zone must be given")
+	}
+
 	if len(config.IrodsAdminUsername) == 0 {
 		return xerrors.Errorf("irods admin username must be given")
 	}
@@ -170,5 +463,116 @@ func (config *Config) Validate() error {
 		return xerrors.Errorf("irods admin password must be given")
 	}
 
+	if len(config.AdminToken) > 0 && len(config.AdminToken) < adminTokenLengthMin {
+		return xerrors.Errorf("admin token must be at least %d characters", adminTokenLengthMin)
+	}
+
+	if len(config.KeyEncryptionSecret) == 0 {
+		return xerrors.Errorf("key encryption secret must be given")
+	}
+
+	if len(config.KeyEncryptionSecret) < keyEncryptionSecretLengthMin {
+		return xerrors.Errorf("key encryption secret must be at least %d characters", keyEncryptionSecretLengthMin)
+	}
+
+	if config.LogFormat != LogFormatText && config.LogFormat != LogFormatJSON {
+		return xerrors.Errorf("unknown log format %s", config.LogFormat)
+	}
+
+	if len(config.Regions) == 0 {
+		return xerrors.Errorf("at least one region must be given")
+	}
+
+	for _, region := range config.Regions {
+		if len(region) == 0 {
+			return xerrors.Errorf("region must not be empty")
+		}
+	}
+
+	if config.ClockSkewMax <= 0 {
+		return xerrors.Errorf("clock skew max must be positive")
+	}
+
+	if config.AuthCacheTimeout < 0 || config.AuthNegativeCacheTimeout < 0 {
+		return xerrors.Errorf("auth cache timeout must not be negative")
+	}
+
+	if config.RateLimitPerUser < 0 || config.RateLimitPerIP < 0 {
+		return xerrors.Errorf("rate limit must not be negative")
+	}
+
+	if config.RateLimitBurstPerUser < 0 || config.RateLimitBurstPerIP < 0 {
+		return xerrors.Errorf("rate limit burst must not be negative")
+	}
+
+	if config.MaxConcurrentRequestsPerUser < 0 || config.MaxConcurrentRequestsPerIP < 0 {
+		return xerrors.Errorf("max concurrent requests must not be negative")
+	}
+
+	if config.BandwidthLimit < 0 || config.BandwidthBurst < 0 || config.BandwidthLimitPerUser < 0 || config.BandwidthBurstPerUser < 0 {
+		return xerrors.Errorf("bandwidth limit must not be negative")
+	}
+
+	if config.UserQuota < 0 {
+		return xerrors.Errorf("user quota must not be negative")
+	}
+
+	if config.StsDurationMax < 15*time.Minute {
+		return xerrors.Errorf("sts max duration must be at least 15 minutes")
+	}
+
+	if len(config.OidcJwksPath) > 0 && len(config.OidcJwksURL) > 0 {
+		return xerrors.Errorf("only one of oidc jwks path and url can be given")
+	}
+
+	if config.IsOidcEnabled() {
+		if len(config.OidcIssuer) == 0 {
+			return xerrors.Errorf("oidc issuer must be given")
+		}
+
+		if len(config.OidcAudience) == 0 {
+			return xerrors.Errorf("oidc audience must be given")
+		}
+
+		if len(config.OidcUsernameClaim) == 0 {
+			return xerrors.Errorf("oidc username claim must be given")
+		}
+	}
+
+	if config.BucketLoggingFlushInterval <= 0 {
+		return xerrors.Errorf("bucket logging flush interval must be positive")
+	}
+
+	if len(config.MetricsPath) > 0 && !strings.HasPrefix(config.MetricsPath, ReservedPathPrefix) {
+		// other paths shadow buckets
+		return xerrors.Errorf("metrics path must start with %s", ReservedPathPrefix)
+	}
+
+	if config.ShutdownTimeout <= 0 {
+		return xerrors.Errorf("shutdown timeout must be positive")
+	}
+
+	if config.HealthCheckTimeout <= 0 {
+		return xerrors.Errorf("health check timeout must be positive")
+	}
+
+	if config.HealthDiskFreeMin < 0 {
+		return xerrors.Errorf("health disk free min must not be negative")
+	}
+
+	switch config.TracingExporter {
+	case "", TracingExporterStdout, TracingExporterFile:
+	case TracingExporterOTLP:
+		if len(config.TracingEndpoint) == 0 {
+			return xerrors.Errorf("tracing endpoint must be given for otlp exporter")
+		}
+	default:
+		return xerrors.Errorf("unknown tracing exporter %s", config.TracingExporter)
+	}
+
+	if config.TracingSampleRatio < 0 || config.TracingSampleRatio > 1 {
+		return xerrors.Errorf("tracing sample ratio must be between 0 and 1")
+	}
+
 	return nil
 }
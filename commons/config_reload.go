@@ -0,0 +1,90 @@
+package commons
+
+import (
+	"reflect"
+	"strings"
+)
+
+// liveConfigFields are yaml keys of settings applied to the running service on reload
+// components using them must support changing them, other settings require restart
+var liveConfigFields = map[string]bool{
+	"debug": true,
+
+	"rate_limit_per_user":              true,
+	"rate_limit_burst_per_user":        true,
+	"max_concurrent_requests_per_user": true,
+	"rate_limit_per_ip":                true,
+	"rate_limit_burst_per_ip":          true,
+	"max_concurrent_requests_per_ip":   true,
+
+	"bandwidth_limit":          true,
+	"bandwidth_burst":          true,
+	"bandwidth_limit_per_user": true,
+	"bandwidth_burst_per_user": true,
+
+	"auth_cache_timeout":          true,
+	"auth_negative_cache_timeout": true,
+
+	// enabling or disabling TLS requires restart
+	"tls_cert_path": true,
+	"tls_key_path":  true,
+}
+
+// runtimeConfigFields are yaml keys of settings given by the command line, not by config files
+var runtimeConfigFields = map[string]bool{
+	"foreground":       true,
+	"childprocess":     true,
+	"config_file_path": true,
+}
+
+// ConfigChanges are settings changed in a config file, in yaml keys
+type ConfigChanges struct {
+	Live            []string `json:"live"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// IsLive checks if the setting is changed and can be applied live
+func (changes *ConfigChanges) IsLive(field string) bool {
+	for _, liveField := range changes.Live {
+		if liveField == field {
+			return true
+		}
+	}
+	return false
+}
+
+// GetConfigChanges compares the running config with a config re-read
+func GetConfigChanges(current *Config, updated *Config) *ConfigChanges {
+	changes := &ConfigChanges{
+		Live:            []string{},
+		RestartRequired: []string{},
+	}
+
+	currentValue := reflect.ValueOf(current).Elem()
+	updatedValue := reflect.ValueOf(updated).Elem()
+	configType := currentValue.Type()
+
+	for i := 0; i < configType.NumField(); i++ {
+		field := strings.Split(configType.Field(i).Tag.Get("yaml"), ",")[0]
+		if len(field) == 0 || runtimeConfigFields[field] {
+			continue
+		}
+
+		if reflect.DeepEqual(currentValue.Field(i).Interface(), updatedValue.Field(i).Interface()) {
+			continue
+		}
+
+		live := liveConfigFields[field]
+		if strings.HasPrefix(field, "tls_") && current.IsTlsEnabled() != updated.IsTlsEnabled() {
+			live = false
+		}
+
+		if live {
+			changes.Live = append(changes.Live, field)
+		} else {
+			changes.RestartRequired = append(changes.RestartRequired, field)
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,287 @@
+package commons
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// ConfigEnvPrefix is the prefix of environment variables overriding settings, S3RODS_IRODS_HOST
+	ConfigEnvPrefix = "S3RODS_"
+	// configSecretFileSuffix is the suffix of settings read from files, irods_admin_password_file
+	configSecretFileSuffix = "_file"
+
+	ConfigSourceDefault = "default"
+	ConfigSourceFile    = "config file"
+	ConfigSourceEnv     = "env"
+	ConfigSourceFlag    = "flag"
+)
+
+// secretConfigFields are yaml keys of settings redacted when printed
+var secretConfigFields = map[string]bool{
+	"irods_admin_password":  true,
+	"admin_token":           true,
+	"key_encryption_secret": true,
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// configField is a setting of Config
+type configField struct {
+	key   string
+	value reflect.Value
+}
+
+// getConfigFields returns settings of the config in the order of declaration
+func getConfigFields(config *Config) []configField {
+	fields := []configField{}
+
+	configValue := reflect.ValueOf(config).Elem()
+	configType := configValue.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		key := strings.Split(configType.Field(i).Tag.Get("yaml"), ",")[0]
+		if len(key) == 0 || key == "-" {
+			continue
+		}
+
+		fields = append(fields, configField{
+			key:   key,
+			value: configValue.Field(i),
+		})
+	}
+
+	return fields
+}
+
+// LoadConfig creates Config from defaults, the config file, secret files and S3RODS_* environment variables
+// later sources override earlier ones, an empty path skips the config file
+func LoadConfig(configPath string) (*Config, error) {
+	config := NewDefaultConfig()
+
+	if len(configPath) > 0 {
+		err := config.loadFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := config.loadEnv(os.Environ())
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// loadFile reads the config file, key_file reads a string setting from a file, e.g., a Docker secret
+func (config *Config) loadFile(configPath string) error {
+	yamlBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return xerrors.Errorf("failed to read config file %s: %w", configPath, err)
+	}
+
+	err = yaml.Unmarshal(yamlBytes, config)
+	if err != nil {
+		return xerrors.Errorf("failed to unmarshal yaml into config: %w", err)
+	}
+
+	values := map[string]interface{}{}
+	err = yaml.Unmarshal(yamlBytes, &values)
+	if err != nil {
+		return xerrors.Errorf("failed to unmarshal yaml into config: %w", err)
+	}
+
+	for _, field := range getConfigFields(config) {
+		if _, ok := values[field.key]; ok {
+			config.SetSource(field.key, ConfigSourceFile)
+		}
+
+		secretPathValue, ok := values[field.key+configSecretFileSuffix]
+		if !ok {
+			continue
+		}
+
+		if _, ok := values[field.key]; ok {
+			return xerrors.Errorf("only one of %s and %s can be given", field.key, field.key+configSecretFileSuffix)
+		}
+
+		secretPath := fmt.Sprintf("%v", secretPathValue)
+		err = setConfigFieldFromFile(field, secretPath)
+		if err != nil {
+			return err
+		}
+
+		config.SetSource(field.key, fmt.Sprintf("%s %s %s", ConfigSourceFile, field.key+configSecretFileSuffix, secretPath))
+	}
+
+	config.ConfigFilePath = configPath
+	return nil
+}
+
+// loadEnv applies S3RODS_KEY and S3RODS_KEY_FILE variables given as KEY=VALUE
+func (config *Config) loadEnv(environ []string) error {
+	env := map[string]string{}
+	for _, keyValue := range environ {
+		if key, value, ok := strings.Cut(keyValue, "="); ok && strings.HasPrefix(key, ConfigEnvPrefix) {
+			env[key] = value
+		}
+	}
+
+	for _, field := range getConfigFields(config) {
+		if runtimeConfigFields[field.key] {
+			continue
+		}
+
+		envKey := ConfigEnvPrefix + strings.ToUpper(field.key)
+		envFileKey := envKey + strings.ToUpper(configSecretFileSuffix)
+
+		value, hasValue := env[envKey]
+		secretPath, hasFile := env[envFileKey]
+
+		switch {
+		case hasValue && hasFile:
+			return xerrors.Errorf("only one of %s and %s can be given", envKey, envFileKey)
+		case hasValue:
+			err := setConfigFieldFromString(field, value)
+			if err != nil {
+				return xerrors.Errorf("failed to parse %s: %w", envKey, err)
+			}
+			config.SetSource(field.key, fmt.Sprintf("%s %s", ConfigSourceEnv, envKey))
+		case hasFile:
+			err := setConfigFieldFromFile(field, secretPath)
+			if err != nil {
+				return xerrors.Errorf("failed to read %s: %w", envFileKey, err)
+			}
+			config.SetSource(field.key, fmt.Sprintf("%s %s %s", ConfigSourceEnv, envFileKey, secretPath))
+		}
+	}
+
+	return nil
+}
+
+// setConfigFieldFromFile sets a setting to the content of the file, trailing newlines are trimmed
+func setConfigFieldFromFile(field configField, path string) error {
+	if field.value.Kind() != reflect.String {
+		return xerrors.Errorf("%s can't be read from a file, only string settings can", field.key)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return xerrors.Errorf("failed to read %s from %s: %w", field.key, path, err)
+	}
+
+	field.value.SetString(strings.TrimRight(string(content), "\r\n"))
+	return nil
+}
+
+// setConfigFieldFromString parses the value in the type of the setting, lists of strings are comma-separated
+func setConfigFieldFromString(field configField, value string) error {
+	value = strings.TrimSpace(value)
+
+	if field.value.Type() == durationType {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.value.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.value.Kind() {
+	case reflect.String:
+		field.value.SetString(value)
+	case reflect.Bool:
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.value.SetBool(boolValue)
+	case reflect.Int, reflect.Int64:
+		intValue, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.value.SetInt(intValue)
+	case reflect.Float64:
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.value.SetFloat(floatValue)
+	case reflect.Slice:
+		if field.value.Type().Elem().Kind() != reflect.String {
+			// lists of structs, e.g., listeners, are given in YAML flow style
+			return yaml.UnmarshalStrict([]byte(value), field.value.Addr().Interface())
+		}
+
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+		field.value.Set(reflect.ValueOf(items))
+	default:
+		return xerrors.Errorf("unsupported type %s", field.value.Type())
+	}
+
+	return nil
+}
+
+// SetSource records where the setting comes from
+func (config *Config) SetSource(key string, source string) {
+	if config.sources == nil {
+		config.sources = map[string]string{}
+	}
+
+	config.sources[key] = source
+}
+
+// GetSource returns where the setting comes from
+func (config *Config) GetSource(key string) string {
+	if source, ok := config.sources[key]; ok {
+		return source
+	}
+
+	return ConfigSourceDefault
+}
+
+// PrintYAML returns the config in YAML with sources as comments, secrets are replaced if redacted
+func (config *Config) PrintYAML(redacted bool) (string, error) {
+	sb := strings.Builder{}
+	if len(config.ConfigFilePath) > 0 {
+		sb.WriteString(fmt.Sprintf("# config file: %s\n", config.ConfigFilePath))
+	}
+
+	for _, field := range getConfigFields(config) {
+		if runtimeConfigFields[field.key] {
+			continue
+		}
+
+		var value interface{} = field.value.Interface()
+		if redacted && secretConfigFields[field.key] && !field.value.IsZero() {
+			value = "REDACTED"
+		}
+
+		fieldYAML, err := yaml.Marshal(map[string]interface{}{
+			field.key: value,
+		})
+		if err != nil {
+			return "", xerrors.Errorf("failed to marshal %s: %w", field.key, err)
+		}
+
+		lines := strings.Split(strings.TrimRight(string(fieldYAML), "\n"), "\n")
+		lines[0] = fmt.Sprintf("%s # %s", lines[0], config.GetSource(field.key))
+		sb.WriteString(strings.Join(lines, "\n"))
+		sb.WriteString("\n")
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,7 @@
+package commons
+
+// DiskUsage is space of the filesystem holding a path
+type DiskUsage struct {
+	TotalBytes uint64
+	FreeBytes  uint64 // available to unprivileged users
+}
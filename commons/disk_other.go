@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package commons
+
+import (
+	"golang.org/x/xerrors"
+)
+
+// GetDiskUsage is not supported on this platform
+func GetDiskUsage(path string) (*DiskUsage, error) {
+	return nil, xerrors.Errorf("failed to get disk usage of %s: not supported on this platform", path)
+}
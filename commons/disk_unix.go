@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+
+package commons
+
+import (
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// GetDiskUsage returns space of the filesystem holding the path
+func GetDiskUsage(path string) (*DiskUsage, error) {
+	stat := syscall.Statfs_t{}
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to statfs %s: %w", path, err)
+	}
+
+	return &DiskUsage{
+		TotalBytes: uint64(stat.Blocks) * uint64(stat.Bsize),
+		FreeBytes:  uint64(stat.Bavail) * uint64(stat.Bsize),
+	}, nil
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package commons
+
+import (
+	"golang.org/x/sys/windows"
+	"golang.org/x/xerrors"
+)
+
+// GetDiskUsage returns space of the filesystem holding the path
+func GetDiskUsage(path string) (*DiskUsage, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to convert path %s: %w", path, err)
+	}
+
+	var freeBytes, totalBytes, totalFreeBytes uint64
+	err = windows.GetDiskFreeSpaceEx(pathPtr, &freeBytes, &totalBytes, &totalFreeBytes)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get disk free space of %s: %w", path, err)
+	}
+
+	return &DiskUsage{
+		TotalBytes: totalBytes,
+		FreeBytes:  freeBytes,
+	}, nil
+}
@@ -0,0 +1,216 @@
+package commons
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// roles of listeners, admin serves admin endpoints and metrics, health endpoints are served by all
+	// listeners serve s3 by default, so admin endpoints and metrics are exposed only when configured
+	// diagnostics are only served by the admin role, so they are opt-in
+	ListenerRoleS3    string = "s3"
+	ListenerRoleAdmin string = "admin"
+	ListenerRoleAll   string = "all"
+
+	UnixSocketModeDefault string = "0660"
+)
+
+// ListenerConfig is an address to serve, either a TCP address or a unix socket
+type ListenerConfig struct {
+	// host:port, host may be omitted to bind all interfaces
+	Address        string `yaml:"address,omitempty"`
+	UnixSocketPath string `yaml:"unix_socket_path,omitempty"`
+	// octal permissions of the unix socket file
+	UnixSocketMode string `yaml:"unix_socket_mode,omitempty"`
+	// serves HTTPS with tls cert path and tls key path
+	Tls  bool   `yaml:"tls,omitempty"`
+	Role string `yaml:"role,omitempty"`
+	// requires PROXY protocol v1 or v2 headers from trusted proxies, other clients must not send them
+	ProxyProtocol bool `yaml:"proxy_protocol,omitempty"`
+}
+
+// IsUnixSocket checks if the listener is a unix socket
+func (listener *ListenerConfig) IsUnixSocket() bool {
+	return len(listener.UnixSocketPath) > 0
+}
+
+// GetNetwork returns a network name for net.Listen
+func (listener *ListenerConfig) GetNetwork() string {
+	if listener.IsUnixSocket() {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// GetAddress returns an address for net.Listen
+func (listener *ListenerConfig) GetAddress() string {
+	if listener.IsUnixSocket() {
+		return listener.UnixSocketPath
+	}
+	return listener.Address
+}
+
+// GetRole returns the role, s3 by default
+func (listener *ListenerConfig) GetRole() string {
+	if len(listener.Role) == 0 {
+		return ListenerRoleS3
+	}
+	return listener.Role
+}
+
+// GetUnixSocketMode returns permissions of the unix socket file
+func (listener *ListenerConfig) GetUnixSocketMode() (os.FileMode, error) {
+	modeString := listener.UnixSocketMode
+	if len(modeString) == 0 {
+		modeString = UnixSocketModeDefault
+	}
+
+	mode, err := strconv.ParseUint(modeString, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, xerrors.Errorf("unix socket mode %q must be octal permissions, e.g., 0660", listener.UnixSocketMode)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// IsS3Served checks if the listener serves the S3 API
+func (listener *ListenerConfig) IsS3Served() bool {
+	return listener.GetRole() != ListenerRoleAdmin
+}
+
+// IsAdminServed checks if the listener serves admin endpoints and metrics
+func (listener *ListenerConfig) IsAdminServed() bool {
+	return listener.GetRole() != ListenerRoleS3
+}
+
+// IsDiagnosticsServed checks if the listener serves pprof and runtime diagnostics
+func (listener *ListenerConfig) IsDiagnosticsServed() bool {
+	return listener.GetRole() == ListenerRoleAdmin
+}
+
+// String returns a description of the listener for logs
+func (listener *ListenerConfig) String() string {
+	scheme := "http"
+	if listener.Tls {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s %s (%s, role %s)", listener.GetNetwork(), listener.GetAddress(), scheme, listener.GetRole())
+}
+
+// Validate validates the listener
+func (listener *ListenerConfig) Validate() error {
+	if len(listener.Address) > 0 && listener.IsUnixSocket() {
+		return xerrors.Errorf("only one of address and unix socket path can be given for a listener")
+	}
+
+	if len(listener.Address) == 0 && !listener.IsUnixSocket() {
+		return xerrors.Errorf("address or unix socket path must be given for a listener")
+	}
+
+	if listener.IsUnixSocket() {
+		_, err := listener.GetUnixSocketMode()
+		if err != nil {
+			return err
+		}
+	} else {
+		if len(listener.UnixSocketMode) > 0 {
+			return xerrors.Errorf("unix socket mode is given for a tcp listener %s", listener.Address)
+		}
+
+		err := validateListenAddress(listener.Address)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch listener.GetRole() {
+	case ListenerRoleS3, ListenerRoleAdmin, ListenerRoleAll:
+	default:
+		return xerrors.Errorf("unknown listener role %s", listener.Role)
+	}
+
+	return nil
+}
+
+func validateListenAddress(address string) error {
+	_, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return xerrors.Errorf("invalid listener address %s: %w", address, err)
+	}
+
+	port, err := strconv.Atoi(portString)
+	if err != nil || port <= 0 || port > maxPort {
+		return xerrors.Errorf("invalid port in listener address %s", address)
+	}
+
+	return nil
+}
+
+// GetListeners returns listeners to serve, derived from port and http port if listeners are not given
+func (config *Config) GetListeners() []ListenerConfig {
+	if len(config.Listeners) > 0 {
+		return config.Listeners
+	}
+
+	if !config.IsTlsEnabled() {
+		return []ListenerConfig{
+			{Address: fmt.Sprintf(":%d", config.Port)},
+		}
+	}
+
+	listeners := []ListenerConfig{
+		{Address: fmt.Sprintf(":%d", config.Port), Tls: true},
+	}
+
+	if config.HttpPort > 0 {
+		listeners = append(listeners, ListenerConfig{Address: fmt.Sprintf(":%d", config.HttpPort)})
+	}
+
+	return listeners
+}
+
+func (config *Config) validateListeners() error {
+	trustedProxies, err := ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	s3Served := false
+	addresses := map[string]bool{}
+
+	for _, listener := range config.Listeners {
+		err := listener.Validate()
+		if err != nil {
+			return err
+		}
+
+		if listener.Tls && !config.IsTlsEnabled() {
+			return xerrors.Errorf("tls listener %s requires tls cert path and tls key path", listener.GetAddress())
+		}
+
+		if listener.ProxyProtocol && !listener.IsUnixSocket() && len(trustedProxies) == 0 {
+			return xerrors.Errorf("proxy protocol listener %s requires trusted proxies", listener.GetAddress())
+		}
+
+		if addresses[listener.GetAddress()] {
+			return xerrors.Errorf("listener %s is given more than once", listener.GetAddress())
+		}
+		addresses[listener.GetAddress()] = true
+
+		if listener.IsS3Served() {
+			s3Served = true
+		}
+	}
+
+	if len(config.Listeners) > 0 && !s3Served {
+		return xerrors.Errorf("at least one listener must serve the s3 role")
+	}
+
+	return nil
+}
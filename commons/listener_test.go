@@ -0,0 +1,53 @@
+package commons
+
+import (
+	"testing"
+)
+
+func TestListenerConfigRoles(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        string
+		s3          bool
+		admin       bool
+		diagnostics bool
+	}{
+		{"default", "", true, false, false},
+		{"s3", ListenerRoleS3, true, false, false},
+		{"admin", ListenerRoleAdmin, false, true, true},
+		{"all", ListenerRoleAll, true, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listener := ListenerConfig{Address: ":8080", Role: test.role}
+
+			if listener.IsS3Served() != test.s3 {
+				t.Errorf("expected s3 served %t", test.s3)
+			}
+
+			if listener.IsAdminServed() != test.admin {
+				t.Errorf("expected admin served %t", test.admin)
+			}
+
+			if listener.IsDiagnosticsServed() != test.diagnostics {
+				t.Errorf("expected diagnostics served %t", test.diagnostics)
+			}
+		})
+	}
+}
+
+func TestGetListenersDefault(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Port = 8080
+
+	listeners := config.GetListeners()
+	if len(listeners) != 1 {
+		t.Fatalf("expected a listener, got %d", len(listeners))
+	}
+
+	// single port deployments must not expose admin endpoints and metrics on the public port
+	if listeners[0].IsAdminServed() {
+		t.Errorf("expected the default listener not to serve admin endpoints")
+	}
+}
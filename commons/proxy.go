@@ -0,0 +1,37 @@
+package commons
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// ParseTrustedProxies parses IP addresses and CIDRs of trusted proxies
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, xerrors.Errorf("invalid trusted proxy %q, must be an IP address or CIDR", proxy)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid trusted proxy %q, must be an IP address or CIDR: %w", proxy, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
@@ -0,0 +1,56 @@
+package commons
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// states sent to systemd, see sd_notify(3)
+	SystemdNotifyReady    string = daemon.SdNotifyReady
+	SystemdNotifyStopping string = daemon.SdNotifyStopping
+	SystemdNotifyWatchdog string = daemon.SdNotifyWatchdog
+)
+
+// IsSystemdService checks if the process is started by systemd with Type=notify or socket activation
+// such a process must not daemonize, systemd only accepts notifications and sockets for the main process
+func IsSystemdService() bool {
+	if len(os.Getenv("NOTIFY_SOCKET")) > 0 {
+		return true
+	}
+
+	listenPid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	return err == nil && listenPid == os.Getpid()
+}
+
+// SystemdNotify sends the state to systemd, does nothing if not started with Type=notify
+func SystemdNotify(state string) {
+	logger := log.WithFields(log.Fields{
+		"package":  "commons",
+		"function": "SystemdNotify",
+	})
+
+	sent, err := daemon.SdNotify(false, state)
+	if err != nil {
+		logger.Warnf("failed to notify %s to systemd: %+v", state, err)
+		return
+	}
+
+	if sent {
+		logger.Debugf("Notified %s to systemd", state)
+	}
+}
+
+// GetSystemdWatchdogInterval returns WatchdogSec of the unit, 0 if the watchdog is disabled
+func GetSystemdWatchdogInterval() time.Duration {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		return 0
+	}
+
+	return interval
+}
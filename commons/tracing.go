@@ -0,0 +1,127 @@
+package commons
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"golang.org/x/xerrors"
+)
+
+const (
+	tracingServiceName     = "s3rods"
+	tracingShutdownTimeout = 5 * time.Second
+)
+
+// Tracing exports spans to the configured exporter
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+	file     *os.File
+}
+
+// StartTracing sets up the global tracer provider, returns a no-op Tracing if tracing is disabled
+func StartTracing(config *Config) (*Tracing, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "commons",
+		"function": "StartTracing",
+	})
+
+	tracing := &Tracing{}
+	if len(config.TracingExporter) == 0 {
+		return tracing, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch config.TracingExporter {
+	case TracingExporterOTLP:
+		endpointURL, err := url.Parse(config.TracingEndpoint)
+		if err != nil || len(endpointURL.Host) == 0 {
+			return nil, xerrors.Errorf("failed to parse tracing endpoint %s", config.TracingEndpoint)
+		}
+
+		options := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(endpointURL.Host),
+		}
+
+		if endpointURL.Scheme == "http" {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+
+		if len(endpointURL.Path) > 0 && endpointURL.Path != "/" {
+			options = append(options, otlptracehttp.WithURLPath(endpointURL.Path))
+		}
+
+		otlpExporter, err := otlptracehttp.New(context.Background(), options...)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		exporter = otlpExporter
+	case TracingExporterStdout, TracingExporterFile:
+		var writer io.Writer = os.Stdout
+		if config.TracingExporter == TracingExporterFile {
+			file, err := os.OpenFile(config.GetTracingFilePath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+			if err != nil {
+				return nil, xerrors.Errorf("failed to open tracing file %s: %w", config.GetTracingFilePath(), err)
+			}
+			tracing.file = file
+			writer = file
+		}
+
+		stdoutExporter, err := stdouttrace.New(stdouttrace.WithWriter(writer))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to create stdout exporter: %w", err)
+		}
+		exporter = stdoutExporter
+	default:
+		return nil, xerrors.Errorf("unknown tracing exporter %s", config.TracingExporter)
+	}
+
+	tracingResource := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(tracingServiceName),
+		semconv.ServiceVersionKey.String(GetServiceVersion()),
+	)
+
+	tracing.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(tracingResource),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.TracingSampleRatio))),
+	)
+
+	otel.SetTracerProvider(tracing.provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	logger.Infof("Exporting traces via %s", config.TracingExporter)
+	return tracing, nil
+}
+
+// Stop flushes pending spans and stops exporting
+func (tracing *Tracing) Stop() error {
+	if tracing.provider == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+
+	err := tracing.provider.Shutdown(ctx)
+
+	if tracing.file != nil {
+		tracing.file.Close()
+	}
+
+	if err != nil {
+		return xerrors.Errorf("failed to shutdown tracer provider: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+package irods
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// SecretKeyAttributeName is the user AVU attribute storing the encrypted secret key, units are the creation time
+	SecretKeyAttributeName = "s3rods::secret_key"
+	// S3DisabledAttributeName is the user AVU attribute marking users denied S3 access
+	S3DisabledAttributeName = "s3rods::s3_disabled"
+
+	// secretKeyLength is the number of random bytes of a secret key, 40 characters in base64 like AWS
+	secretKeyLength = 30
+
+	// userStatusCacheTimeout is the time S3 access status of users is cached, other instances see changes after it
+	userStatusCacheTimeout = 1 * time.Minute
+
+	// secretKeyEncryptionContext derives the key encrypting secret keys from the key encryption secret
+	secretKeyEncryptionContext = "s3rods secret key encryption"
+)
+
+var (
+	// ErrKeyStoreUnavailable is returned when the key encrypting secret keys is not given
+	ErrKeyStoreUnavailable = xerrors.New("key encryption secret is not configured")
+)
+
+// AccessKey is an S3 key of a user, the access key is the username
+type AccessKey struct {
+	AccessKey  string    `json:"access_key"`
+	SecretKey  string    `json:"secret_key,omitempty"`
+	CreateTime time.Time `json:"create_time"`
+}
+
+// deriveKey derives a key for the purpose from the key encryption secret, so keys for other purposes are independent
+// user AVUs are visible to other iRODS users, so secret keys are never stored in plaintext
+func deriveKey(secret string, purpose string) ([]byte, error) {
+	if len(secret) == 0 {
+		return nil, ErrKeyStoreUnavailable
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil), nil
+}
+
+func (controller *IrodsController) getKeyCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(controller.keyEncryptionKey)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create a cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealSecretKey encrypts the secret key bound to the user, so it can't be copied to other users
+func (controller *IrodsController) sealSecretKey(username string, secretKey string) (string, error) {
+	aead, err := controller.getKeyCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", xerrors.Errorf("failed to generate a nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(secretKey), []byte(username))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (controller *IrodsController) openSecretKey(username string, sealedSecretKey string) (string, error) {
+	aead, err := controller.getKeyCipher()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(sealedSecretKey)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", xerrors.Errorf("malformed secret key of user %s", username)
+	}
+
+	secretKey, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(username))
+	if err != nil {
+		return "", xerrors.Errorf("failed to decrypt secret key of user %s, the key encryption secret may differ: %w", username, err)
+	}
+
+	return string(secretKey), nil
+}
+
+// listUserMetadataByName returns user AVUs of the attribute
+func (controller *IrodsController) listUserMetadataByName(username string, attrName string) ([]*irodsclient_types.IRODSMeta, error) {
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	metas, err := filesystem.ListUserMetadata(username)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to list metadata of user %s: %w", username, err)
+	}
+
+	matched := []*irodsclient_types.IRODSMeta{}
+	for _, meta := range metas {
+		if meta.Name == attrName {
+			matched = append(matched, meta)
+		}
+	}
+
+	return matched, nil
+}
+
+// deleteUserMetadataByName deletes user AVUs of the attribute, returns the number of AVUs deleted
+func (controller *IrodsController) deleteUserMetadataByName(username string, attrName string) (int, error) {
+	metas, err := controller.listUserMetadataByName(username, attrName)
+	if err != nil {
+		return 0, err
+	}
+
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, meta := range metas {
+		err = filesystem.DeleteUserMetadata(username, meta.AVUID, meta.Name, meta.Value, meta.Units)
+		if err != nil {
+			return 0, xerrors.Errorf("failed to delete metadata %s of user %s: %w", attrName, username, err)
+		}
+	}
+
+	return len(metas), nil
+}
+
+// GetUserSecretKey returns a secret key of the access key, ErrAccessKeyNotFound if not registered
+func (controller *IrodsController) GetUserSecretKey(ctx context.Context, username string) (_ string, err error) {
+	_, span := startSpan(ctx, "GetUserSecretKey", userAttribute(username))
+	defer func() { endSpan(span, err) }()
+
+	accessKey, err := controller.getUserAccessKey(username)
+	if err != nil {
+		return "", err
+	}
+
+	return accessKey.SecretKey, nil
+}
+
+// GetUserAccessKey returns the S3 key of the user without the secret key, ErrAccessKeyNotFound if not registered
+func (controller *IrodsController) GetUserAccessKey(ctx context.Context, username string) (_ *AccessKey, err error) {
+	_, span := startSpan(ctx, "GetUserAccessKey", userAttribute(username))
+	defer func() { endSpan(span, err) }()
+
+	accessKey, err := controller.getUserAccessKey(username)
+	if err != nil {
+		return nil, err
+	}
+
+	accessKey.SecretKey = ""
+	return accessKey, nil
+}
+
+func (controller *IrodsController) getUserAccessKey(username string) (*AccessKey, error) {
+	metas, err := controller.listUserMetadataByName(username, SecretKeyAttributeName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(metas) == 0 {
+		return nil, xerrors.Errorf("no secret key of user %s: %w", username, ErrAccessKeyNotFound)
+	}
+
+	// the latest is used if a concurrent creation left more than one
+	latest := metas[0]
+	for _, meta := range metas[1:] {
+		if meta.Units > latest.Units {
+			latest = meta
+		}
+	}
+
+	secretKey, err := controller.openSecretKey(username, latest.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	accessKey := &AccessKey{
+		AccessKey: username,
+		SecretKey: secretKey,
+	}
+
+	if createTime, err := strconv.ParseInt(latest.Units, 10, 64); err == nil {
+		accessKey.CreateTime = time.Unix(createTime, 0).UTC()
+	}
+
+	return accessKey, nil
+}
+
+// CreateUserAccessKey creates a new secret key of the user, replacing the existing one
+func (controller *IrodsController) CreateUserAccessKey(ctx context.Context, username string) (_ *AccessKey, err error) {
+	_, span := startSpan(ctx, "CreateUserAccessKey", userAttribute(username))
+	defer func() { endSpan(span, err) }()
+
+	secretKeyBytes := make([]byte, secretKeyLength)
+	_, err = rand.Read(secretKeyBytes)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to generate a secret key: %w", err)
+	}
+
+	accessKey := &AccessKey{
+		AccessKey:  username,
+		SecretKey:  base64.StdEncoding.EncodeToString(secretKeyBytes),
+		CreateTime: time.Now().UTC().Truncate(time.Second),
+	}
+
+	sealedSecretKey, err := controller.sealSecretKey(username, accessKey.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = controller.deleteUserMetadataByName(username, SecretKeyAttributeName)
+	if err != nil {
+		return nil, err
+	}
+
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	err = filesystem.AddUserMetadata(username, 0, SecretKeyAttributeName, sealedSecretKey, strconv.FormatInt(accessKey.CreateTime.Unix(), 10))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to store secret key of user %s: %w", username, err)
+	}
+
+	return accessKey, nil
+}
+
+// DeleteUserAccessKey revokes the secret key of the user, ErrAccessKeyNotFound if not registered
+func (controller *IrodsController) DeleteUserAccessKey(ctx context.Context, username string) (err error) {
+	_, span := startSpan(ctx, "DeleteUserAccessKey", userAttribute(username))
+	defer func() { endSpan(span, err) }()
+
+	deleted, err := controller.deleteUserMetadataByName(username, SecretKeyAttributeName)
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return xerrors.Errorf("no secret key of user %s: %w", username, ErrAccessKeyNotFound)
+	}
+
+	return nil
+}
+
+// IsUserS3Disabled checks if the user is denied S3 access, cached for userStatusCacheTimeout
+func (controller *IrodsController) IsUserS3Disabled(ctx context.Context, username string) (_ bool, err error) {
+	_, span := startSpan(ctx, "IsUserS3Disabled", userAttribute(username))
+	defer func() { endSpan(span, err) }()
+
+	if disabled, ok := controller.userStatusCache.Get(username); ok {
+		return disabled.(bool), nil
+	}
+
+	metas, err := controller.listUserMetadataByName(username, S3DisabledAttributeName)
+	if err != nil {
+		return false, err
+	}
+
+	disabled := len(metas) > 0
+	controller.userStatusCache.SetDefault(username, disabled)
+	return disabled, nil
+}
+
+// SetUserS3Disabled denies or allows S3 access of the user
+func (controller *IrodsController) SetUserS3Disabled(ctx context.Context, username string, disabled bool) (err error) {
+	_, span := startSpan(ctx, "SetUserS3Disabled", userAttribute(username))
+	defer func() { endSpan(span, err) }()
+
+	_, err = controller.deleteUserMetadataByName(username, S3DisabledAttributeName)
+	if err != nil {
+		return err
+	}
+
+	if disabled {
+		filesystem, err := controller.getAdminFilesystem()
+		if err != nil {
+			return err
+		}
+
+		err = filesystem.AddUserMetadata(username, 0, S3DisabledAttributeName, "true", strconv.FormatInt(time.Now().Unix(), 10))
+		if err != nil {
+			return xerrors.Errorf("failed to disable S3 access of user %s: %w", username, err)
+		}
+	}
+
+	controller.userStatusCache.SetDefault(username, disabled)
+	return nil
+}
+
+// DisconnectUser releases iRODS connections opened for the user, requests using them fail
+func (controller *IrodsController) DisconnectUser(ctx context.Context, username string) (_ ClientPoolStats, err error) {
+	_, span := startSpan(ctx, "DisconnectUser", userAttribute(username))
+	defer func() { endSpan(span, err) }()
+
+	return controller.clientPool.ReleaseUser(username), nil
+}
@@ -0,0 +1,128 @@
+package irods
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// BucketLoggingAttributeName is the AVU attribute storing bucket logging configurations
+	BucketLoggingAttributeName = "s3rods::bucket_logging"
+)
+
+// BucketLogging is a server access logging configuration of a bucket
+type BucketLogging struct {
+	TargetBucket string `json:"target_bucket"`
+	TargetPrefix string `json:"target_prefix"`
+}
+
+// GetBucketLogging returns a logging configuration of the bucket, returns nil if not set
+func (controller *IrodsController) GetBucketLogging(ctx context.Context, bucket string) (_ *BucketLogging, err error) {
+	_, span := startSpan(ctx, "GetBucketLogging", bucketAttribute(bucket))
+	defer func() { endSpan(span, err) }()
+
+	loggingBytes, err := controller.getChunkedCollectionMeta(controller.getBucketPath(bucket), BucketLoggingAttributeName)
+	if err != nil {
+		return nil, err
+	}
+
+	if loggingBytes == nil {
+		return nil, nil
+	}
+
+	logging := &BucketLogging{}
+	err = json.Unmarshal(loggingBytes, logging)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse logging configuration of bucket %s: %w", bucket, err)
+	}
+
+	return logging, nil
+}
+
+// SetBucketLogging stores a logging configuration of the bucket, replaces existing one
+func (controller *IrodsController) SetBucketLogging(ctx context.Context, bucket string, logging *BucketLogging) (err error) {
+	_, span := startSpan(ctx, "SetBucketLogging", bucketAttribute(bucket))
+	defer func() { endSpan(span, err) }()
+
+	loggingBytes, err := json.Marshal(logging)
+	if err != nil {
+		return xerrors.Errorf("failed to marshal logging configuration: %w", err)
+	}
+
+	return controller.setChunkedCollectionMeta(controller.getBucketPath(bucket), BucketLoggingAttributeName, loggingBytes)
+}
+
+// DeleteBucketLogging deletes a logging configuration of the bucket
+func (controller *IrodsController) DeleteBucketLogging(ctx context.Context, bucket string) (err error) {
+	_, span := startSpan(ctx, "DeleteBucketLogging", bucketAttribute(bucket))
+	defer func() { endSpan(span, err) }()
+
+	return controller.deleteCollectionMeta(controller.getBucketPath(bucket), BucketLoggingAttributeName)
+}
+
+// PutBucketLogObject writes a log object into the bucket as the bucket owner
+// so that log objects are owned and charged to the owner
+func (controller *IrodsController) PutBucketLogObject(ctx context.Context, bucket string, key string, data []byte) (err error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irods",
+		"struct":   "IrodsController",
+		"function": "PutBucketLogObject",
+	})
+
+	_, span := startSpan(ctx, "PutBucketLogObject", bucketAttribute(bucket), keyAttribute(key))
+	defer func() { endSpan(span, err) }()
+
+	bucketPath := controller.getBucketPath(bucket)
+	objectPath := path.Join(bucketPath, key)
+	if !strings.HasPrefix(objectPath, bucketPath+"/") {
+		return xerrors.Errorf("invalid log object key %s", key)
+	}
+
+	adminFilesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return err
+	}
+
+	bucketEntry, err := adminFilesystem.StatDir(bucketPath)
+	if err != nil {
+		return xerrors.Errorf("failed to stat bucket %s: %w", bucket, err)
+	}
+
+	filesystem, done, err := controller.clientPool.GetUserFilesystem(bucketEntry.Owner)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	parentPath := path.Dir(objectPath)
+	if !filesystem.ExistsDir(parentPath) {
+		err = filesystem.MakeDir(parentPath, true)
+		if err != nil {
+			return xerrors.Errorf("failed to make collection %s: %w", parentPath, err)
+		}
+	}
+
+	handle, err := filesystem.CreateFile(objectPath, "", "w")
+	if err != nil {
+		return xerrors.Errorf("failed to create %s: %w", objectPath, err)
+	}
+
+	_, err = handle.Write(data)
+	if err != nil {
+		handle.Close()
+		return xerrors.Errorf("failed to write %s: %w", objectPath, err)
+	}
+
+	err = handle.Close()
+	if err != nil {
+		return xerrors.Errorf("failed to close %s: %w", objectPath, err)
+	}
+
+	logger.Debugf("wrote a log object %s of %d bytes", objectPath, len(data))
+	return nil
+}
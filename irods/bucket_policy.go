@@ -0,0 +1,266 @@
+package irods
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// BucketPolicyAttributeName is the AVU attribute storing bucket policies
+	BucketPolicyAttributeName = "s3rods::bucket_policy"
+
+	// avuValueChunkSize is the max length of an AVU value stored in a chunk
+	// the iCAT column for AVU values is limited to 2700 bytes
+	avuValueChunkSize = 2048
+)
+
+// GetBucketPolicy returns a bucket policy document in JSON, returns nil if not set
+func (controller *IrodsController) GetBucketPolicy(ctx context.Context, bucket string) (_ []byte, err error) {
+	_, span := startSpan(ctx, "GetBucketPolicy", bucketAttribute(bucket))
+	defer func() { endSpan(span, err) }()
+
+	return controller.getChunkedCollectionMeta(controller.getBucketPath(bucket), BucketPolicyAttributeName)
+}
+
+// SetBucketPolicy stores a bucket policy document in JSON, replaces existing one
+func (controller *IrodsController) SetBucketPolicy(ctx context.Context, bucket string, policy []byte) (err error) {
+	_, span := startSpan(ctx, "SetBucketPolicy", bucketAttribute(bucket))
+	defer func() { endSpan(span, err) }()
+
+	return controller.setChunkedCollectionMeta(controller.getBucketPath(bucket), BucketPolicyAttributeName, policy)
+}
+
+// DeleteBucketPolicy deletes a bucket policy document
+func (controller *IrodsController) DeleteBucketPolicy(ctx context.Context, bucket string) (err error) {
+	_, span := startSpan(ctx, "DeleteBucketPolicy", bucketAttribute(bucket))
+	defer func() { endSpan(span, err) }()
+
+	return controller.deleteCollectionMeta(controller.getBucketPath(bucket), BucketPolicyAttributeName)
+}
+
+// getChunkedCollectionMeta reads a value stored in multiple AVUs, see joinMetaChunks for the layout
+func (controller *IrodsController) getChunkedCollectionMeta(collectionPath string, attrName string) ([]byte, error) {
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	if !filesystem.ExistsDir(collectionPath) {
+		return nil, irodsclient_types.NewFileNotFoundErrorf("failed to find collection %s", collectionPath)
+	}
+
+	metas, err := filesystem.ListMetadata(collectionPath)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to list metadata of %s: %w", collectionPath, err)
+	}
+
+	return joinMetaChunks(metas, attrName), nil
+}
+
+// setChunkedCollectionMeta stores a long value in multiple AVUs
+// new chunks are added under a new generation before old ones are deleted,
+// so a failure in the middle leaves the previous value readable
+func (controller *IrodsController) setChunkedCollectionMeta(collectionPath string, attrName string, value []byte) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irods",
+		"struct":   "IrodsController",
+		"function": "setChunkedCollectionMeta",
+	})
+
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return err
+	}
+
+	if !filesystem.ExistsDir(collectionPath) {
+		return irodsclient_types.NewFileNotFoundErrorf("failed to find collection %s", collectionPath)
+	}
+
+	metas, err := filesystem.ListMetadata(collectionPath)
+	if err != nil {
+		return xerrors.Errorf("failed to list metadata of %s: %w", collectionPath, err)
+	}
+
+	generation := getNextMetaChunkGeneration(metas, attrName)
+	chunks := splitMetaValue(string(value), avuValueChunkSize)
+	for idx, chunk := range chunks {
+		err = filesystem.AddMetadata(collectionPath, attrName, chunk, formatMetaChunkUnits(generation, idx, len(chunks)))
+		if err != nil {
+			return xerrors.Errorf("failed to add metadata %s to %s: %w", attrName, collectionPath, err)
+		}
+	}
+
+	// remove chunks of older generations, including ones left by failed writes
+	for _, meta := range metas {
+		if meta.Name != attrName {
+			continue
+		}
+
+		err = filesystem.DeleteMetadata(collectionPath, meta.Name, meta.Value, meta.Units)
+		if err != nil {
+			return xerrors.Errorf("failed to delete metadata %s from %s: %w", attrName, collectionPath, err)
+		}
+	}
+
+	logger.Debugf("stored metadata %s on %s", attrName, collectionPath)
+	return nil
+}
+
+// splitMetaValue splits a value into chunks of at most chunkSize bytes
+// cuts are moved back to rune boundaries so each chunk stays valid UTF-8
+func splitMetaValue(value string, chunkSize int) []string {
+	chunks := []string{}
+	for len(value) > 0 {
+		cut := chunkSize
+		if cut >= len(value) {
+			chunks = append(chunks, value)
+			break
+		}
+
+		for cut > chunkSize-utf8.UTFMax && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+
+		if !utf8.RuneStart(value[cut]) {
+			// not valid UTF-8, cut at the byte offset
+			cut = chunkSize
+		}
+
+		chunks = append(chunks, value[:cut])
+		value = value[cut:]
+	}
+	return chunks
+}
+
+// formatMetaChunkUnits returns units of a chunk AVU in "generation.index.count" form
+func formatMetaChunkUnits(generation int, idx int, count int) string {
+	return fmt.Sprintf("%d.%d.%d", generation, idx, count)
+}
+
+// parseMetaChunkUnits parses units of a chunk AVU
+// units holding only a chunk index are from older versions, they are treated as generation 0 with unknown count
+func parseMetaChunkUnits(units string) (int, int, int, bool) {
+	fields := strings.Split(units, ".")
+	numbers := make([]int, len(fields))
+	for i, field := range fields {
+		number, err := strconv.Atoi(field)
+		if err != nil || number < 0 {
+			return 0, 0, 0, false
+		}
+		numbers[i] = number
+	}
+
+	switch len(numbers) {
+	case 1:
+		return 0, numbers[0], -1, true
+	case 3:
+		return numbers[0], numbers[1], numbers[2], true
+	default:
+		return 0, 0, 0, false
+	}
+}
+
+// getNextMetaChunkGeneration returns a generation greater than any stored for the attribute
+func getNextMetaChunkGeneration(metas []*irodsclient_types.IRODSMeta, attrName string) int {
+	next := 1
+	for _, meta := range metas {
+		if meta.Name != attrName {
+			continue
+		}
+
+		generation, _, _, ok := parseMetaChunkUnits(meta.Units)
+		if ok && generation >= next {
+			next = generation + 1
+		}
+	}
+	return next
+}
+
+// joinMetaChunks joins chunks of the newest complete generation of the attribute
+// returns nil if no complete generation is found
+func joinMetaChunks(metas []*irodsclient_types.IRODSMeta, attrName string) []byte {
+	type metaChunk struct {
+		idx   int
+		value string
+	}
+
+	generations := map[int][]metaChunk{}
+	counts := map[int]int{}
+	for _, meta := range metas {
+		if meta.Name != attrName {
+			continue
+		}
+
+		generation, idx, count, ok := parseMetaChunkUnits(meta.Units)
+		if !ok {
+			continue
+		}
+
+		generations[generation] = append(generations[generation], metaChunk{idx: idx, value: meta.Value})
+		counts[generation] = count
+	}
+
+	keys := []int{}
+	for generation := range generations {
+		keys = append(keys, generation)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+
+	for _, generation := range keys {
+		chunks := generations[generation]
+		if counts[generation] >= 0 && len(chunks) != counts[generation] {
+			// incomplete, left by a failed write
+			continue
+		}
+
+		sort.Slice(chunks, func(i int, j int) bool {
+			return chunks[i].idx < chunks[j].idx
+		})
+
+		var sb strings.Builder
+		for _, chunk := range chunks {
+			sb.WriteString(chunk.value)
+		}
+		return []byte(sb.String())
+	}
+
+	return nil
+}
+
+// deleteCollectionMeta deletes all AVUs having the attribute name
+func (controller *IrodsController) deleteCollectionMeta(collectionPath string, attrName string) error {
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return err
+	}
+
+	if !filesystem.ExistsDir(collectionPath) {
+		return irodsclient_types.NewFileNotFoundErrorf("failed to find collection %s", collectionPath)
+	}
+
+	metas, err := filesystem.ListMetadata(collectionPath)
+	if err != nil {
+		return xerrors.Errorf("failed to list metadata of %s: %w", collectionPath, err)
+	}
+
+	for _, meta := range metas {
+		if meta.Name != attrName {
+			continue
+		}
+
+		err = filesystem.DeleteMetadata(collectionPath, meta.Name, meta.Value, meta.Units)
+		if err != nil {
+			return xerrors.Errorf("failed to delete metadata %s from %s: %w", attrName, collectionPath, err)
+		}
+	}
+
+	return nil
+}
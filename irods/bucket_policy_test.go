@@ -0,0 +1,104 @@
+package irods
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+)
+
+func newTestMetaChunks(attrName string, generation int, value string) []*irodsclient_types.IRODSMeta {
+	chunks := splitMetaValue(value, avuValueChunkSize)
+
+	metas := []*irodsclient_types.IRODSMeta{}
+	for idx, chunk := range chunks {
+		metas = append(metas, &irodsclient_types.IRODSMeta{
+			Name:  attrName,
+			Value: chunk,
+			Units: formatMetaChunkUnits(generation, idx, len(chunks)),
+		})
+	}
+	return metas
+}
+
+func TestSplitMetaValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"short", `{"Version":"2012-10-17"}`},
+		{"ascii over chunk size", strings.Repeat("a", avuValueChunkSize*2+1)},
+		{"two byte runes", `{"Sid": "` + strings.Repeat("é", avuValueChunkSize) + `"}`},
+		{"three byte runes", `{"Sid": "` + strings.Repeat("資料", avuValueChunkSize) + `"}`},
+		{"four byte runes", `{"Sid": "` + strings.Repeat("🪣", avuValueChunkSize) + `"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chunks := splitMetaValue(test.value, avuValueChunkSize)
+			for idx, chunk := range chunks {
+				if len(chunk) > avuValueChunkSize {
+					t.Errorf("chunk %d has %d bytes, over %d", idx, len(chunk), avuValueChunkSize)
+				}
+
+				if !utf8.ValidString(chunk) {
+					t.Errorf("chunk %d is not valid UTF-8", idx)
+				}
+			}
+
+			if strings.Join(chunks, "") != test.value {
+				t.Errorf("joined chunks differ from the value")
+			}
+		})
+	}
+}
+
+func TestJoinMetaChunks(t *testing.T) {
+	oldPolicy := `{"Sid": "` + strings.Repeat("旧", avuValueChunkSize) + `"}`
+	newPolicy := `{"Sid": "` + strings.Repeat("新", avuValueChunkSize) + `"}`
+
+	partial := newTestMetaChunks(BucketPolicyAttributeName, 3, newPolicy)
+	partial = partial[:len(partial)-1]
+
+	legacy := []*irodsclient_types.IRODSMeta{
+		{Name: BucketPolicyAttributeName, Value: "world", Units: "1"},
+		{Name: BucketPolicyAttributeName, Value: "hello ", Units: "0"},
+	}
+
+	other := &irodsclient_types.IRODSMeta{Name: BucketLoggingAttributeName, Value: "{}", Units: "9.0.1"}
+
+	tests := []struct {
+		name     string
+		metas    []*irodsclient_types.IRODSMeta
+		expected string
+	}{
+		{"none", []*irodsclient_types.IRODSMeta{other}, ""},
+		{"round trip", append(newTestMetaChunks(BucketPolicyAttributeName, 1, newPolicy), other), newPolicy},
+		{"newest generation", append(newTestMetaChunks(BucketPolicyAttributeName, 1, oldPolicy), newTestMetaChunks(BucketPolicyAttributeName, 2, newPolicy)...), newPolicy},
+		{"incomplete generation", append(newTestMetaChunks(BucketPolicyAttributeName, 2, oldPolicy), partial...), oldPolicy},
+		{"legacy chunks", legacy, "hello world"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value := joinMetaChunks(test.metas, BucketPolicyAttributeName)
+			if string(value) != test.expected {
+				t.Errorf("expected %d bytes, got %d bytes", len(test.expected), len(value))
+			}
+		})
+	}
+}
+
+func TestGetNextMetaChunkGeneration(t *testing.T) {
+	metas := append(newTestMetaChunks(BucketPolicyAttributeName, 4, "{}"), &irodsclient_types.IRODSMeta{Name: BucketLoggingAttributeName, Value: "{}", Units: "9.0.1"})
+
+	if generation := getNextMetaChunkGeneration(metas, BucketPolicyAttributeName); generation != 5 {
+		t.Errorf("expected generation 5, got %d", generation)
+	}
+
+	if generation := getNextMetaChunkGeneration(nil, BucketPolicyAttributeName); generation != 1 {
+		t.Errorf("expected generation 1, got %d", generation)
+	}
+}
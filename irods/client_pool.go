@@ -1,4 +1,255 @@
 package irods
 
+import (
+	"sync"
+	"time"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/cyverse/s3rods/commons"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// clientIdleTimeout is the time after which an unused client is released
+	clientIdleTimeout = 5 * time.Minute
+	// clientCleanupInterval is the interval of checking idle clients
+	clientCleanupInterval = 1 * time.Minute
+
+	anonymousUsername = "anonymous"
+)
+
+type poolClient struct {
+	filesystem     *irodsclient_fs.FileSystem
+	lastAccessTime time.Time
+	// inUse is the number of requests using the filesystem, it is released only when unused
+	inUse int
+	// removed is set when the client is removed from the pool while in use
+	removed bool
+}
+
+// ClientPoolStats is a snapshot of ClientPool usage
+type ClientPoolStats struct {
+	Clients     int `json:"clients"`
+	Connections int `json:"connections"`
+}
+
+// ClientPool manages iRODS filesystems opened on behalf of S3 clients
 type ClientPool struct {
+	config     *commons.Config
+	clients    map[string]*poolClient
+	terminated bool
+	terminate  chan bool
+	mutex      sync.Mutex
+}
+
+// NewClientPool creates a new ClientPool
+func NewClientPool(config *commons.Config) *ClientPool {
+	pool := &ClientPool{
+		config:     config,
+		clients:    map[string]*poolClient{},
+		terminated: false,
+		terminate:  make(chan bool),
+	}
+
+	go pool.cleanupIdleClients()
+
+	return pool
+}
+
+// Release releases all clients
+func (pool *ClientPool) Release() {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if !pool.terminated {
+		pool.terminated = true
+		close(pool.terminate)
+	}
+
+	for key, client := range pool.clients {
+		pool.removeClient(key, client)
+	}
+}
+
+// GetStats returns the number of clients and iRODS connections opened
+func (pool *ClientPool) GetStats() ClientPoolStats {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	stats := ClientPoolStats{
+		Clients: len(pool.clients),
+	}
+
+	for _, client := range pool.clients {
+		stats.Connections += client.filesystem.ConnectionTotal()
+	}
+
+	return stats
+}
+
+// ReleaseUser releases clients of the user, returns the number of clients and connections released
+func (pool *ClientPool) ReleaseUser(username string) ClientPoolStats {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	stats := ClientPoolStats{}
+
+	key := "user:" + username
+	if client, ok := pool.clients[key]; ok {
+		stats.Clients++
+		stats.Connections += client.filesystem.ConnectionTotal()
+
+		pool.removeClient(key, client)
+	}
+
+	return stats
+}
+
+// GetTicketFilesystem returns a filesystem opened with the ticket as an anonymous user
+// the caller must call the returned done func when it stops using the filesystem
+func (pool *ClientPool) GetTicketFilesystem(ticket string) (*irodsclient_fs.FileSystem, func(), error) {
+	account, err := irodsclient_types.CreateIRODSAccountForTicket(pool.config.IrodsHost, pool.config.IrodsPort, anonymousUsername, pool.config.IrodsZone, irodsclient_types.AuthSchemeNative, "", ticket, "")
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to create an account for ticket: %w", err)
+	}
+
+	return pool.getFilesystem("ticket:"+ticket, account)
+}
+
+// GetUserFilesystem returns a filesystem opened as the user via the admin proxy
+// the caller must call the returned done func when it stops using the filesystem
+func (pool *ClientPool) GetUserFilesystem(username string) (*irodsclient_fs.FileSystem, func(), error) {
+	account, err := irodsclient_types.CreateIRODSProxyAccount(pool.config.IrodsHost, pool.config.IrodsPort, username, pool.config.IrodsZone, pool.config.IrodsAdminUsername, pool.config.IrodsZone, irodsclient_types.AuthSchemeNative, pool.config.IrodsAdminPassword, "")
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to create a proxy account: %w", err)
+	}
+
+	return pool.getFilesystem("user:"+username, account)
+}
+
+func (pool *ClientPool) getFilesystem(key string, account *irodsclient_types.IRODSAccount) (*irodsclient_fs.FileSystem, func(), error) {
+	client, err := pool.acquireClient(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if client == nil {
+		// connect without holding the lock, logins of other users must not wait for a slow login
+		filesystem, err := irodsclient_fs.NewFileSystemWithDefault(account, applicationName)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to connect to %s:%d as %s: %w", account.Host, account.Port, account.ClientUser, err)
+		}
+
+		client, err = pool.addClient(key, filesystem)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	done := func() {
+		pool.releaseClient(client)
+	}
+
+	return client.filesystem, done, nil
+}
+
+// acquireClient returns a pooled client in use, nil if the key is not connected yet
+func (pool *ClientPool) acquireClient(key string) (*poolClient, error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.terminated {
+		return nil, xerrors.Errorf("client pool is already released")
+	}
+
+	client, ok := pool.clients[key]
+	if !ok {
+		return nil, nil
+	}
+
+	client.inUse++
+	client.lastAccessTime = time.Now()
+	return client, nil
+}
+
+// addClient adds a connected filesystem in use, the filesystem is released if others connected the key meanwhile
+func (pool *ClientPool) addClient(key string, filesystem *irodsclient_fs.FileSystem) (*poolClient, error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.terminated {
+		filesystem.Release()
+		return nil, xerrors.Errorf("client pool is already released")
+	}
+
+	if client, ok := pool.clients[key]; ok {
+		filesystem.Release()
+
+		client.inUse++
+		client.lastAccessTime = time.Now()
+		return client, nil
+	}
+
+	client := &poolClient{
+		filesystem:     filesystem,
+		lastAccessTime: time.Now(),
+		inUse:          1,
+	}
+	pool.clients[key] = client
+
+	return client, nil
+}
+
+// releaseClient marks the client unused, clients removed from the pool are released when the last use ends
+func (pool *ClientPool) releaseClient(client *poolClient) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	client.inUse--
+	client.lastAccessTime = time.Now()
+
+	if client.removed && client.inUse <= 0 {
+		client.filesystem.Release()
+	}
+}
+
+// removeClient removes the client from the pool, the caller must lock the pool
+func (pool *ClientPool) removeClient(key string, client *poolClient) {
+	delete(pool.clients, key)
+
+	if client.inUse > 0 {
+		client.removed = true
+		return
+	}
+
+	client.filesystem.Release()
+}
+
+func (pool *ClientPool) cleanupIdleClients() {
+	logger := log.WithFields(log.Fields{
+		"package":  "irods",
+		"struct":   "ClientPool",
+		"function": "cleanupIdleClients",
+	})
+
+	ticker := time.NewTicker(clientCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pool.terminate:
+			return
+		case <-ticker.C:
+			pool.mutex.Lock()
+			for key, client := range pool.clients {
+				if client.inUse <= 0 && time.Since(client.lastAccessTime) > clientIdleTimeout {
+					logger.Debug("releasing an idle client")
+					pool.removeClient(key, client)
+				}
+			}
+			pool.mutex.Unlock()
+		}
+	}
 }
@@ -1,17 +1,42 @@
 package irods
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
 	"github.com/cyverse/s3rods/commons"
+	gocache "github.com/patrickmn/go-cache"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	applicationName = "s3rods"
+)
+
+var (
+	// ErrAccessKeyNotFound is returned when no secret key is registered for the access key
+	ErrAccessKeyNotFound = xerrors.New("access key not found")
 )
 
 // IrodsController is a controller object
 type IrodsController struct {
-	config *commons.Config
+	config     *commons.Config
+	clientPool *ClientPool
+
+	adminFilesystem *irodsclient_fs.FileSystem
+	quotaCache      *gocache.Cache
+	userStatusCache *gocache.Cache
+	// encrypts secret keys in user AVUs and derives ticket secret keys, derived from the key encryption secret
+	keyEncryptionKey []byte
+	ticketKey        []byte
+	hostCache        *gocache.Cache
+	ticketCache      *gocache.Cache
+	mutex            sync.Mutex
 }
 
 // Start starts a new S3 service
@@ -22,8 +47,27 @@ func Start(config *commons.Config) (*IrodsController, error) {
 	})
 
 	logger.Info("Starting IRODS controller")
+
+	keyEncryptionKey, err := deriveKey(config.KeyEncryptionSecret, secretKeyEncryptionContext)
+	if err != nil {
+		return nil, err
+	}
+
+	ticketKey, err := deriveKey(config.KeyEncryptionSecret, ticketSecretKeyContext)
+	if err != nil {
+		return nil, err
+	}
+
 	controller := &IrodsController{
-		config: config,
+		config:     config,
+		clientPool: NewClientPool(config),
+		quotaCache: gocache.New(quotaCacheTimeout, quotaCacheTimeout),
+
+		userStatusCache:  gocache.New(userStatusCacheTimeout, userStatusCacheTimeout),
+		keyEncryptionKey: keyEncryptionKey,
+		ticketKey:        ticketKey,
+		hostCache:        gocache.New(hostCacheTimeout, hostCacheTimeout),
+		ticketCache:      gocache.New(ticketCacheTimeout, ticketCacheTimeout),
 	}
 
 	return controller, nil
@@ -39,24 +83,118 @@ func (controller *IrodsController) Stop() error {
 
 	logger.Infof("Stopping IRODS controller\n")
 
+	stats := controller.GetClientPoolStats()
+	logger.Infof("Closing %d iRODS clients with %d connections", stats.Clients, stats.Connections)
+
+	controller.clientPool.Release()
+
+	controller.mutex.Lock()
+	if controller.adminFilesystem != nil {
+		controller.adminFilesystem.Release()
+		controller.adminFilesystem = nil
+	}
+	controller.mutex.Unlock()
+
 	logger.Infof("Stopped IRODS controller\n")
 
 	return nil
 }
 
-func (controller *IrodsController) GetUserSecretKey(username string) (string, error) {
-	//TODO: Implement this
-	return "testSecret", nil
+// GetClientPoolStats returns usage of the client pool, including the admin connections
+func (controller *IrodsController) GetClientPoolStats() ClientPoolStats {
+	stats := controller.clientPool.GetStats()
+
+	controller.mutex.Lock()
+	if controller.adminFilesystem != nil {
+		stats.Clients++
+		stats.Connections += controller.adminFilesystem.ConnectionTotal()
+	}
+	controller.mutex.Unlock()
+
+	return stats
 }
 
-func (controller *IrodsController) ListRootDirStats(username string) ([]*irodsclient_fs.Entry, error) {
+// getAdminFilesystem returns a filesystem connected as the admin user, connects lazily
+func (controller *IrodsController) getAdminFilesystem() (*irodsclient_fs.FileSystem, error) {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	if controller.adminFilesystem != nil {
+		return controller.adminFilesystem, nil
+	}
+
+	account, err := irodsclient_types.CreateIRODSAccount(controller.config.IrodsHost, controller.config.IrodsPort, controller.config.IrodsAdminUsername, controller.config.IrodsZone, irodsclient_types.AuthSchemeNative, controller.config.IrodsAdminPassword, "")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create an admin account: %w", err)
+	}
+
+	filesystem, err := irodsclient_fs.NewFileSystemWithDefault(account, applicationName)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to connect to %s:%d as %s: %w", controller.config.IrodsHost, controller.config.IrodsPort, controller.config.IrodsAdminUsername, err)
+	}
+
+	controller.adminFilesystem = filesystem
+	return filesystem, nil
+}
+
+// getRequesterFilesystem returns a filesystem opened with the ticket if given, or as the user
+// the caller must call done when it stops using the filesystem
+func (controller *IrodsController) getRequesterFilesystem(username string, ticketString string) (*irodsclient_fs.FileSystem, func(), error) {
+	if len(ticketString) > 0 {
+		return controller.clientPool.GetTicketFilesystem(ticketString)
+	}
+	return controller.clientPool.GetUserFilesystem(username)
+}
+
+// GetBucketRootPath returns an iRODS collection path containing buckets
+func (controller *IrodsController) GetBucketRootPath() string {
+	return fmt.Sprintf("/%s/home", controller.config.IrodsZone)
+}
+
+// GetSharedDirPath returns an iRODS collection path shared by all users
+func (controller *IrodsController) GetSharedDirPath() string {
+	return controller.getBucketPath(controller.config.IrodsSharedDirname)
+}
+
+// getBucketPath returns an iRODS collection path for the bucket
+func (controller *IrodsController) getBucketPath(bucket string) string {
+	return fmt.Sprintf("%s/%s", controller.GetBucketRootPath(), bucket)
+}
+
+// IsBucketOwner checks if the user owns the bucket
+func (controller *IrodsController) IsBucketOwner(ctx context.Context, username string, bucket string) (_ bool, err error) {
+	_, span := startSpan(ctx, "IsBucketOwner", userAttribute(username), bucketAttribute(bucket))
+	defer func() { endSpan(span, err) }()
+
+	if username == bucket {
+		// user's home
+		return true, nil
+	}
+
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return false, err
+	}
+
+	entry, err := filesystem.StatDir(controller.getBucketPath(bucket))
+	if err != nil {
+		return false, xerrors.Errorf("failed to stat bucket %s: %w", bucket, err)
+	}
+
+	return entry.Owner == username, nil
+}
+
+func (controller *IrodsController) ListRootDirStats(ctx context.Context, username string) (_ []*irodsclient_fs.Entry, err error) {
+	_, span := startSpan(ctx, "ListRootDirStats", userAttribute(username))
+	defer func() { endSpan(span, err) }()
+
 	//TODO: Implement this
 	return []*irodsclient_fs.Entry{
 		{
 			ID:         0,
 			Type:       irodsclient_fs.DirectoryEntry,
 			Name:       username,
-			Path:       fmt.Sprintf("/iplant/home/%s", username),
+			Path:       controller.getBucketPath(username),
 			Owner:      username,
 			Size:       0,
 			DataType:   "",
@@ -0,0 +1,79 @@
+package irods
+
+import (
+	"context"
+	"fmt"
+
+	irodsclient_common "github.com/cyverse/go-irodsclient/irods/common"
+	irodsclient_message "github.com/cyverse/go-irodsclient/irods/message"
+	"golang.org/x/xerrors"
+)
+
+// CheckConnection checks that the admin user can reach the catalog of IrodsHost
+// it runs a query on a connection rather than stat, so cached entries can't hide a broken server
+func (controller *IrodsController) CheckConnection(ctx context.Context) (err error) {
+	_, span := startSpan(ctx, "CheckConnection")
+	defer func() { endSpan(span, err) }()
+
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return err
+	}
+
+	conn, err := filesystem.GetMetadataConnection()
+	if err != nil {
+		return xerrors.Errorf("failed to get a connection: %w", err)
+	}
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+	defer conn.Unlock()
+
+	zonePath := fmt.Sprintf("/%s", controller.config.IrodsZone)
+
+	query := irodsclient_message.NewIRODSMessageQueryRequest(1, 0, 0, 0)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_COLL_ID, 1)
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_COLL_NAME, fmt.Sprintf("= '%s'", zonePath))
+
+	rows, err := requestQuery(conn, query)
+	if err != nil {
+		return xerrors.Errorf("failed to query zone collection %s: %w", zonePath, err)
+	}
+
+	if len(rows) == 0 {
+		return xerrors.Errorf("zone collection %s is not found", zonePath)
+	}
+
+	return nil
+}
+
+// CheckKeyStore checks that secret keys can be looked up, an unknown access key still proves the store is available
+func (controller *IrodsController) CheckKeyStore(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "CheckKeyStore")
+	defer func() { endSpan(span, err) }()
+
+	_, err = controller.GetUserSecretKey(ctx, controller.config.IrodsAdminUsername)
+	if err != nil && !xerrors.Is(err, ErrAccessKeyNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// CheckCollection checks that the collection exists and the admin user can see it
+func (controller *IrodsController) CheckCollection(ctx context.Context, irodsPath string) (err error) {
+	_, span := startSpan(ctx, "CheckCollection", pathAttribute(irodsPath))
+	defer func() { endSpan(span, err) }()
+
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return err
+	}
+
+	_, err = filesystem.StatDir(irodsPath)
+	if err != nil {
+		return xerrors.Errorf("failed to stat collection %s: %w", irodsPath, err)
+	}
+
+	return nil
+}
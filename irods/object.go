@@ -0,0 +1,184 @@
+package irods
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_common "github.com/cyverse/go-irodsclient/irods/common"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"golang.org/x/xerrors"
+)
+
+// IsAccessDeniedError checks if iRODS rejected an access by ACLs or the ticket
+func IsAccessDeniedError(err error) bool {
+	// iRODS appends errno to error codes, e.g., -818000 becomes -818013
+	code := irodsclient_types.GetIRODSErrorCode(err) / 1000 * 1000
+
+	switch code {
+	case irodsclient_common.CAT_NO_ACCESS_PERMISSION,
+		irodsclient_common.CAT_TICKET_INVALID,
+		irodsclient_common.CAT_TICKET_EXPIRED,
+		irodsclient_common.CAT_TICKET_USES_EXCEEDED,
+		irodsclient_common.CAT_TICKET_USER_EXCLUDED,
+		irodsclient_common.CAT_TICKET_HOST_EXCLUDED:
+		return true
+	}
+	return false
+}
+
+// getObjectPath returns an iRODS path of the object, keys escaping the bucket are not found
+func (controller *IrodsController) getObjectPath(bucket string, key string) (string, error) {
+	bucketPath := controller.getBucketPath(bucket)
+	objectPath := path.Join(bucketPath, key)
+	if !strings.HasPrefix(objectPath, bucketPath+"/") {
+		return "", irodsclient_types.NewFileNotFoundErrorf("failed to find object %s/%s", bucket, key)
+	}
+
+	return objectPath, nil
+}
+
+// StatObject returns the entry of the object, stat as the user or with the ticket if given
+// objects the requester can't read are not found, so existence of others' objects is not revealed
+func (controller *IrodsController) StatObject(ctx context.Context, username string, ticketString string, bucket string, key string) (_ *irodsclient_fs.Entry, err error) {
+	_, span := startSpan(ctx, "StatObject", userAttribute(username), bucketAttribute(bucket), keyAttribute(key))
+	defer func() { endSpan(span, err) }()
+
+	objectPath, err := controller.getObjectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	filesystem, done, err := controller.getRequesterFilesystem(username, ticketString)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	entry, err := filesystem.StatFile(objectPath)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to stat object %s/%s: %w", bucket, key, err)
+	}
+
+	return entry, nil
+}
+
+// ObjectReader reads an object opened in iRODS, the filesystem is kept in use until it is closed
+type ObjectReader struct {
+	handle *irodsclient_fs.FileHandle
+	done   func()
+}
+
+// GetEntry returns the entry of the object
+func (reader *ObjectReader) GetEntry() *irodsclient_fs.Entry {
+	return reader.handle.GetEntry()
+}
+
+// Read reads the object
+func (reader *ObjectReader) Read(p []byte) (int, error) {
+	return reader.handle.Read(p)
+}
+
+// Close closes the object and returns the filesystem to the pool
+func (reader *ObjectReader) Close() error {
+	defer reader.done()
+	return reader.handle.Close()
+}
+
+// OpenObject opens the object for reading as the user or with the ticket if given
+// opening with a ticket counts a use of the ticket in iRODS, also for tickets on collections
+func (controller *IrodsController) OpenObject(ctx context.Context, username string, ticketString string, bucket string, key string) (_ *ObjectReader, err error) {
+	_, span := startSpan(ctx, "OpenObject", userAttribute(username), bucketAttribute(bucket), keyAttribute(key))
+	defer func() { endSpan(span, err) }()
+
+	objectPath, err := controller.getObjectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	filesystem, done, err := controller.getRequesterFilesystem(username, ticketString)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := filesystem.OpenFile(objectPath, "", "r")
+	if err != nil {
+		done()
+		return nil, xerrors.Errorf("failed to open object %s/%s: %w", bucket, key, err)
+	}
+
+	return &ObjectReader{
+		handle: handle,
+		done:   done,
+	}, nil
+}
+
+// PutObject writes the object as the user or with the ticket if given, missing parent collections are made
+// returns the number of bytes written
+func (controller *IrodsController) PutObject(ctx context.Context, username string, ticketString string, bucket string, key string, reader io.Reader) (_ int64, err error) {
+	_, span := startSpan(ctx, "PutObject", userAttribute(username), bucketAttribute(bucket), keyAttribute(key))
+	defer func() { endSpan(span, err) }()
+
+	objectPath, err := controller.getObjectPath(bucket, key)
+	if err != nil {
+		return 0, err
+	}
+
+	filesystem, done, err := controller.getRequesterFilesystem(username, ticketString)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	parentPath := path.Dir(objectPath)
+	if !filesystem.ExistsDir(parentPath) {
+		err = filesystem.MakeDir(parentPath, true)
+		if err != nil {
+			return 0, xerrors.Errorf("failed to make collection %s: %w", parentPath, err)
+		}
+	}
+
+	handle, err := filesystem.CreateFile(objectPath, "", "w")
+	if err != nil {
+		return 0, xerrors.Errorf("failed to create object %s/%s: %w", bucket, key, err)
+	}
+
+	written, err := io.Copy(handle, reader)
+	if err != nil {
+		handle.Close()
+		return written, xerrors.Errorf("failed to write object %s/%s: %w", bucket, key, err)
+	}
+
+	err = handle.Close()
+	if err != nil {
+		return written, xerrors.Errorf("failed to close object %s/%s: %w", bucket, key, err)
+	}
+
+	return written, nil
+}
+
+// DeleteObject deletes the object as the user or with the ticket if given
+func (controller *IrodsController) DeleteObject(ctx context.Context, username string, ticketString string, bucket string, key string) (err error) {
+	_, span := startSpan(ctx, "DeleteObject", userAttribute(username), bucketAttribute(bucket), keyAttribute(key))
+	defer func() { endSpan(span, err) }()
+
+	objectPath, err := controller.getObjectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	filesystem, done, err := controller.getRequesterFilesystem(username, ticketString)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	err = filesystem.RemoveFile(objectPath, true)
+	if err != nil {
+		return xerrors.Errorf("failed to delete object %s/%s: %w", bucket, key, err)
+	}
+
+	return nil
+}
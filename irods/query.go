@@ -0,0 +1,57 @@
+package irods
+
+import (
+	irodsclient_common "github.com/cyverse/go-irodsclient/irods/common"
+	irodsclient_conn "github.com/cyverse/go-irodsclient/irods/connection"
+	irodsclient_message "github.com/cyverse/go-irodsclient/irods/message"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"golang.org/x/xerrors"
+)
+
+// queryRow is a row of a GenQuery result, column -> value
+type queryRow map[irodsclient_common.ICATColumnNumber]string
+
+// requestQuery runs a GenQuery and returns rows of the first page
+// the connection must be locked by the caller
+func requestQuery(conn *irodsclient_conn.IRODSConnection, query *irodsclient_message.IRODSMessageQueryRequest) ([]queryRow, error) {
+	if conn == nil || !conn.IsConnected() {
+		return nil, xerrors.Errorf("connection is nil or disconnected")
+	}
+
+	queryResult := irodsclient_message.IRODSMessageQueryResponse{}
+	err := conn.Request(query, &queryResult, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to receive a query result message: %w", err)
+	}
+
+	err = queryResult.CheckError()
+	if err != nil {
+		if irodsclient_types.GetIRODSErrorCode(err) == irodsclient_common.CAT_NO_ROWS_FOUND {
+			return []queryRow{}, nil
+		}
+
+		return nil, xerrors.Errorf("received a query error: %w", err)
+	}
+
+	if queryResult.AttributeCount > len(queryResult.SQLResult) {
+		return nil, xerrors.Errorf("failed to receive attributes - requires %d, but received %d attributes", queryResult.AttributeCount, len(queryResult.SQLResult))
+	}
+
+	rows := make([]queryRow, queryResult.RowCount)
+	for rowIdx := range rows {
+		rows[rowIdx] = queryRow{}
+	}
+
+	for attrIdx := 0; attrIdx < queryResult.AttributeCount; attrIdx++ {
+		sqlResult := queryResult.SQLResult[attrIdx]
+		if len(sqlResult.Values) != queryResult.RowCount {
+			return nil, xerrors.Errorf("failed to receive rows - requires %d, but received %d values", queryResult.RowCount, len(sqlResult.Values))
+		}
+
+		for rowIdx, value := range sqlResult.Values {
+			rows[rowIdx][irodsclient_common.ICATColumnNumber(sqlResult.AttributeIndex)] = value
+		}
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,396 @@
+package irods
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	irodsclient_common "github.com/cyverse/go-irodsclient/irods/common"
+	irodsclient_conn "github.com/cyverse/go-irodsclient/irods/connection"
+	irodsclient_message "github.com/cyverse/go-irodsclient/irods/message"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// GenQuery select options
+	queryAggregateSum   = 4
+	queryAggregateCount = 6
+
+	// globalQuotaResourceID is the resource id of global quotas
+	globalQuotaResourceID = "0"
+
+	// quotaCacheTimeout is the time quotas and usages are cached for quota checks
+	quotaCacheTimeout = 1 * time.Minute
+)
+
+var (
+	// ErrQuotaExceeded is returned when a write would exceed a quota
+	ErrQuotaExceeded = xerrors.New("quota exceeded")
+)
+
+// Quota is an iRODS global quota of a user or a group
+type Quota struct {
+	Owner string `json:"owner"` // user or group
+	Limit int64  `json:"limit"`
+	// Over is usage - limit, computed by iRODS when quota usage is updated (iadmin cu)
+	Over int64 `json:"over"`
+}
+
+// Exceeds checks if writing size bytes exceeds the quota
+func (quota *Quota) Exceeds(size int64) bool {
+	return quota.Limit > 0 && quota.Over+size > 0
+}
+
+// UserUsage is bytes of data objects owned by a user
+type UserUsage struct {
+	Username string   `json:"username"`
+	Bytes    int64    `json:"bytes"`
+	Quotas   []*Quota `json:"quotas"`
+	// Limit is the s3rods-side quota, zero if not set
+	Limit int64 `json:"limit"`
+}
+
+// BucketUsage is the number of objects and bytes in a bucket
+type BucketUsage struct {
+	Bucket  string `json:"bucket"`
+	Objects int64  `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+	// StoredBytes includes all replicas
+	StoredBytes int64 `json:"stored_bytes"`
+}
+
+// IsQuotaExceededError checks if iRODS rejected a write by a resource quota
+func IsQuotaExceededError(err error) bool {
+	return irodsclient_types.GetIRODSErrorCode(err) == irodsclient_common.SYS_RESC_QUOTA_EXCEEDED
+}
+
+// CheckUserQuota checks if writing size bytes by the user exceeds iRODS global quotas of the user and its groups
+// or the s3rods-side quota, quotas and usages are cached for a minute
+// resource quotas are enforced by iRODS itself
+func (controller *IrodsController) CheckUserQuota(ctx context.Context, username string, size int64) (err error) {
+	ctx, span := startSpan(ctx, "CheckUserQuota", userAttribute(username), attribute.Int64("s3rods.size", size))
+	defer func() { endSpan(span, err) }()
+
+	quotas, err := controller.getCachedUserQuotas(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	for _, quota := range quotas {
+		if quota.Exceeds(size) {
+			return xerrors.Errorf("quota of %s (%d bytes) for user %s: %w", quota.Owner, quota.Limit, username, ErrQuotaExceeded)
+		}
+	}
+
+	if controller.config.UserQuota > 0 {
+		usedBytes, err := controller.getCachedUserUsedBytes(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		if usedBytes+size > controller.config.UserQuota {
+			return xerrors.Errorf("s3rods quota (%d bytes) for user %s: %w", controller.config.UserQuota, username, ErrQuotaExceeded)
+		}
+	}
+
+	return nil
+}
+
+func (controller *IrodsController) getCachedUserQuotas(ctx context.Context, username string) ([]*Quota, error) {
+	cacheKey := "quota:" + username
+	if quotas, ok := controller.quotaCache.Get(cacheKey); ok {
+		return quotas.([]*Quota), nil
+	}
+
+	quotas, err := controller.GetUserQuotas(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	controller.quotaCache.SetDefault(cacheKey, quotas)
+	return quotas, nil
+}
+
+func (controller *IrodsController) getCachedUserUsedBytes(ctx context.Context, username string) (int64, error) {
+	cacheKey := "usage:" + username
+	if usedBytes, ok := controller.quotaCache.Get(cacheKey); ok {
+		return usedBytes.(int64), nil
+	}
+
+	usedBytes, err := controller.GetUserUsedBytes(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+
+	controller.quotaCache.SetDefault(cacheKey, usedBytes)
+	return usedBytes, nil
+}
+
+// GetUserQuotas returns iRODS global quotas of the user and groups the user belongs to
+func (controller *IrodsController) GetUserQuotas(ctx context.Context, username string) (_ []*Quota, err error) {
+	_, span := startSpan(ctx, "GetUserQuotas", userAttribute(username))
+	defer func() { endSpan(span, err) }()
+
+	if !isQueryableName(username) {
+		return nil, xerrors.Errorf("invalid username %q", username)
+	}
+
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := filesystem.GetMetadataConnection()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get a connection: %w", err)
+	}
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+	defer conn.Unlock()
+
+	owners, err := queryUserGroups(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	owners = append(owners, username)
+
+	quotedOwners := make([]string, len(owners))
+	for ownerIdx, owner := range owners {
+		quotedOwners[ownerIdx] = fmt.Sprintf("'%s'", owner)
+	}
+
+	query := irodsclient_message.NewIRODSMessageQueryRequest(irodsclient_common.MaxQueryRows, 0, 0, 0)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_QUOTA_USER_NAME, 1)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_QUOTA_LIMIT, 1)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_QUOTA_OVER, 1)
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_QUOTA_USER_NAME, fmt.Sprintf("in (%s)", strings.Join(quotedOwners, ", ")))
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_QUOTA_RESC_ID, fmt.Sprintf("= '%s'", globalQuotaResourceID))
+
+	rows, err := requestQuery(conn, query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query quotas of user %s: %w", username, err)
+	}
+
+	quotas := []*Quota{}
+	for _, row := range rows {
+		limit, err := strconv.ParseInt(row[irodsclient_common.ICAT_COLUMN_QUOTA_LIMIT], 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse quota limit: %w", err)
+		}
+
+		over, err := strconv.ParseInt(row[irodsclient_common.ICAT_COLUMN_QUOTA_OVER], 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse quota over: %w", err)
+		}
+
+		quotas = append(quotas, &Quota{
+			Owner: row[irodsclient_common.ICAT_COLUMN_QUOTA_USER_NAME],
+			Limit: limit,
+			Over:  over,
+		})
+	}
+
+	return quotas, nil
+}
+
+// GetUserUsedBytes returns bytes of data objects owned by the user in the zone, a replica each
+func (controller *IrodsController) GetUserUsedBytes(ctx context.Context, username string) (_ int64, err error) {
+	_, span := startSpan(ctx, "GetUserUsedBytes", userAttribute(username))
+	defer func() { endSpan(span, err) }()
+
+	if !isQueryableName(username) {
+		return 0, xerrors.Errorf("invalid username %q", username)
+	}
+
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := filesystem.GetMetadataConnection()
+	if err != nil {
+		return 0, xerrors.Errorf("failed to get a connection: %w", err)
+	}
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+	defer conn.Unlock()
+
+	query := irodsclient_message.NewIRODSMessageQueryRequest(irodsclient_common.MaxQueryRows, 0, 0, 0)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_DATA_SIZE, queryAggregateSum)
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_D_OWNER_NAME, fmt.Sprintf("= '%s'", username))
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_COLL_NAME, fmt.Sprintf("like '/%s/%%'", escapeLikePattern(controller.config.IrodsZone)))
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_DATA_REPL_NUM, "= '0'")
+
+	rows, err := requestQuery(conn, query)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to query usage of user %s: %w", username, err)
+	}
+
+	return parseAggregate(rows, irodsclient_common.ICAT_COLUMN_DATA_SIZE)
+}
+
+// GetUserUsage returns usage and quotas of the user
+func (controller *IrodsController) GetUserUsage(ctx context.Context, username string) (_ *UserUsage, err error) {
+	ctx, span := startSpan(ctx, "GetUserUsage", userAttribute(username))
+	defer func() { endSpan(span, err) }()
+
+	quotas, err := controller.GetUserQuotas(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	usedBytes, err := controller.GetUserUsedBytes(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserUsage{
+		Username: username,
+		Bytes:    usedBytes,
+		Quotas:   quotas,
+		Limit:    controller.config.UserQuota,
+	}, nil
+}
+
+// GetBucketUsage returns the number of objects and bytes in the bucket, computed with GenQuery aggregates
+// objects and bytes count replica 0 of each data object, stored bytes count all replicas
+func (controller *IrodsController) GetBucketUsage(ctx context.Context, bucket string) (_ *BucketUsage, err error) {
+	_, span := startSpan(ctx, "GetBucketUsage", bucketAttribute(bucket))
+	defer func() { endSpan(span, err) }()
+
+	if !isQueryableName(bucket) {
+		return nil, irodsclient_types.NewFileNotFoundErrorf("failed to find bucket %s", bucket)
+	}
+
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	bucketPath := controller.getBucketPath(bucket)
+	if !filesystem.ExistsDir(bucketPath) {
+		return nil, irodsclient_types.NewFileNotFoundErrorf("failed to find bucket %s", bucket)
+	}
+
+	conn, err := filesystem.GetMetadataConnection()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get a connection: %w", err)
+	}
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	conn.Lock()
+	defer conn.Unlock()
+
+	collectionCondition := getCollectionTreeCondition(bucketPath)
+
+	query := irodsclient_message.NewIRODSMessageQueryRequest(irodsclient_common.MaxQueryRows, 0, 0, 0)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_D_DATA_ID, queryAggregateCount)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_DATA_SIZE, queryAggregateSum)
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_COLL_NAME, collectionCondition)
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_DATA_REPL_NUM, "= '0'")
+
+	rows, err := requestQuery(conn, query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query usage of bucket %s: %w", bucket, err)
+	}
+
+	objects, err := parseAggregate(rows, irodsclient_common.ICAT_COLUMN_D_DATA_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := parseAggregate(rows, irodsclient_common.ICAT_COLUMN_DATA_SIZE)
+	if err != nil {
+		return nil, err
+	}
+
+	query = irodsclient_message.NewIRODSMessageQueryRequest(irodsclient_common.MaxQueryRows, 0, 0, 0)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_DATA_SIZE, queryAggregateSum)
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_COLL_NAME, collectionCondition)
+
+	rows, err = requestQuery(conn, query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query stored bytes of bucket %s: %w", bucket, err)
+	}
+
+	storedBytes, err := parseAggregate(rows, irodsclient_common.ICAT_COLUMN_DATA_SIZE)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BucketUsage{
+		Bucket:      bucket,
+		Objects:     objects,
+		Bytes:       bytes,
+		StoredBytes: storedBytes,
+	}, nil
+}
+
+// GetObjectSize returns the size of the object, stat as the user or with the ticket if given
+func (controller *IrodsController) GetObjectSize(ctx context.Context, username string, ticketString string, bucket string, key string) (int64, error) {
+	entry, err := controller.StatObject(ctx, username, ticketString, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+
+	return entry.Size, nil
+}
+
+// queryUserGroups returns groups the user belongs to, the connection must be locked by the caller
+func queryUserGroups(conn *irodsclient_conn.IRODSConnection, username string) ([]string, error) {
+	query := irodsclient_message.NewIRODSMessageQueryRequest(irodsclient_common.MaxQueryRows, 0, 0, 0)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_COLL_USER_GROUP_NAME, 1)
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_USER_NAME, fmt.Sprintf("= '%s'", username))
+
+	rows, err := requestQuery(conn, query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query groups of user %s: %w", username, err)
+	}
+
+	groups := []string{}
+	for _, row := range rows {
+		group := row[irodsclient_common.ICAT_COLUMN_COLL_USER_GROUP_NAME]
+		if group != username {
+			// every user is a member of its own group
+			groups = append(groups, group)
+		}
+	}
+
+	return groups, nil
+}
+
+// parseAggregate parses an aggregated value, empty if no rows are aggregated
+func parseAggregate(rows []queryRow, column irodsclient_common.ICATColumnNumber) (int64, error) {
+	if len(rows) == 0 || len(rows[0][column]) == 0 {
+		return 0, nil
+	}
+
+	value, err := strconv.ParseInt(rows[0][column], 10, 64)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to parse aggregated value %q: %w", rows[0][column], err)
+	}
+
+	return value, nil
+}
+
+// escapeLikePattern escapes the LIKE wildcard _ so it matches only itself
+// % and \ are never in queryable names, see isQueryableName
+func escapeLikePattern(value string) string {
+	return strings.ReplaceAll(value, "_", "\\_")
+}
+
+// getCollectionTreeCondition returns a GenQuery condition of the collection and its sub-collections
+func getCollectionTreeCondition(collectionPath string) string {
+	return fmt.Sprintf("= '%s' || like '%s/%%'", collectionPath, escapeLikePattern(collectionPath))
+}
+
+// isQueryableName checks if the name can be put in GenQuery conditions safely
+func isQueryableName(name string) bool {
+	return len(name) > 0 && !strings.ContainsAny(name, "'%/\\")
+}
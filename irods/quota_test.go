@@ -0,0 +1,91 @@
+package irods
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestQuotaExceeds(t *testing.T) {
+	tests := []struct {
+		name     string
+		quota    Quota
+		size     int64
+		expected bool
+	}{
+		{"no limit", Quota{Limit: 0, Over: 100}, 100, false},
+		{"under limit", Quota{Limit: 1000, Over: -500}, 100, false},
+		{"reaches limit", Quota{Limit: 1000, Over: -500}, 500, false},
+		{"over limit after write", Quota{Limit: 1000, Over: -500}, 501, true},
+		{"already over limit", Quota{Limit: 1000, Over: 10}, 0, true},
+		{"at limit", Quota{Limit: 1000, Over: 0}, 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exceeds := test.quota.Exceeds(test.size)
+			if exceeds != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, exceeds)
+			}
+		})
+	}
+}
+
+// matchLike matches the value with a SQL LIKE pattern escaped with backslashes
+func matchLike(pattern string, value string) bool {
+	expression := "^"
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+			expression += regexp.QuoteMeta(pattern[i : i+1])
+		case '%':
+			expression += ".*"
+		case '_':
+			expression += "."
+		default:
+			expression += regexp.QuoteMeta(pattern[i : i+1])
+		}
+	}
+	return regexp.MustCompile(expression + "$").MatchString(value)
+}
+
+func TestGetCollectionTreeCondition(t *testing.T) {
+	condition := getCollectionTreeCondition("/zone/home/my_lab")
+
+	if condition != `= '/zone/home/my_lab' || like '/zone/home/my\_lab/%'` {
+		t.Fatalf("unexpected condition %s", condition)
+	}
+
+	pattern := strings.TrimSuffix(strings.SplitN(condition, "like '", 2)[1], "'")
+
+	tests := []struct {
+		collectionPath string
+		expected       bool
+	}{
+		{"/zone/home/my_lab/data", true},
+		{"/zone/home/my_lab/data/sub", true},
+		{"/zone/home/myXlab/data", false},
+		{"/zone/home/my_labs/data", false},
+	}
+
+	for _, test := range tests {
+		if matchLike(pattern, test.collectionPath) != test.expected {
+			t.Errorf("%s matching %s: expected %t", pattern, test.collectionPath, test.expected)
+		}
+	}
+}
+
+func TestEscapeLikePattern(t *testing.T) {
+	if escaped := escapeLikePattern("temp_zone"); escaped != `temp\_zone` {
+		t.Errorf("unexpected escaped zone %s", escaped)
+	}
+
+	if !matchLike("/"+escapeLikePattern("temp_zone")+"/%", "/temp_zone/home") {
+		t.Errorf("expected the zone to match itself")
+	}
+
+	if matchLike("/"+escapeLikePattern("temp_zone")+"/%", "/tempXzone/home") {
+		t.Errorf("expected _ not to match other characters")
+	}
+}
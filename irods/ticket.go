@@ -0,0 +1,453 @@
+package irods
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_common "github.com/cyverse/go-irodsclient/irods/common"
+	irodsclient_conn "github.com/cyverse/go-irodsclient/irods/connection"
+	irodsclient_message "github.com/cyverse/go-irodsclient/irods/message"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsclient_util "github.com/cyverse/go-irodsclient/irods/util"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// icat columns for ticket restrictions, not defined in go-irodsclient
+const (
+	icatColumnTicketAllowedHost  irodsclient_common.ICATColumnNumber = 2221
+	icatColumnTicketDataName     irodsclient_common.ICATColumnNumber = 2226
+	icatColumnTicketDataCollName irodsclient_common.ICATColumnNumber = 2227
+	icatColumnTicketOwnerName    irodsclient_common.ICATColumnNumber = 2229
+)
+
+const (
+	ticketStringLength   = 20
+	ticketStringLetters  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	ticketRequestTimeout = 30 * time.Second
+
+	// ticketSecretKeyContext derives the key deriving ticket secret keys from the key encryption secret
+	ticketSecretKeyContext = "s3rods ticket secret key"
+	// ticketSecretKeyLength is the number of characters of a ticket secret key, same as AWS
+	ticketSecretKeyLength = 40
+
+	// hostCacheTimeout is the time resolved addresses of ticket allowed hosts are cached
+	hostCacheTimeout = 5 * time.Minute
+	// ticketCacheTimeout is the time ticket information is cached for ticket checks
+	ticketCacheTimeout = 10 * time.Second
+)
+
+// Ticket holds iRODS ticket information with restrictions
+type Ticket struct {
+	Name         string
+	Type         irodsclient_types.TicketType
+	Owner        string
+	ObjectType   irodsclient_types.ObjectType
+	Path         string
+	ExpireTime   time.Time
+	UsesLimit    int64
+	UsesCount    int64
+	AllowedHosts []string
+}
+
+// IsExpired checks if the ticket is expired
+func (ticket *Ticket) IsExpired() bool {
+	if ticket.ExpireTime.IsZero() || ticket.ExpireTime.Unix() == 0 {
+		return false
+	}
+	return time.Now().After(ticket.ExpireTime)
+}
+
+// IsUsedUp checks if the ticket reached its uses limit
+func (ticket *Ticket) IsUsedUp() bool {
+	return ticket.UsesLimit > 0 && ticket.UsesCount >= ticket.UsesLimit
+}
+
+// IsHostAllowed checks if the client address is allowed to use the ticket, host names are resolved with lookupHost
+func (ticket *Ticket) IsHostAllowed(clientAddress string, lookupHost func(host string) ([]string, error)) bool {
+	if len(ticket.AllowedHosts) == 0 {
+		return true
+	}
+
+	clientIP := net.ParseIP(clientAddress)
+	for _, allowedHost := range ticket.AllowedHosts {
+		if allowedHost == clientAddress {
+			return true
+		}
+
+		if clientIP == nil || net.ParseIP(allowedHost) != nil {
+			// addresses are compared as is
+			continue
+		}
+
+		addrs, err := lookupHost(allowedHost)
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			if clientIP.Equal(net.ParseIP(addr)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// GetTicket returns ticket information, queried as the admin user
+func (controller *IrodsController) GetTicket(ctx context.Context, ticketString string) (_ *Ticket, err error) {
+	_, span := startSpan(ctx, "GetTicket")
+	defer func() { endSpan(span, err) }()
+
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := filesystem.GetMetadataConnection()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get a connection: %w", err)
+	}
+	defer filesystem.ReturnMetadataConnection(conn)
+
+	ticket, err := queryTicket(conn, ticketString)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket.AllowedHosts, err = queryTicketAllowedHosts(conn, ticketString)
+	if err != nil {
+		return nil, err
+	}
+
+	return ticket, nil
+}
+
+// lookupHost resolves the host, results including failures are cached not to resolve hosts on every request
+func (controller *IrodsController) lookupHost(host string) ([]string, error) {
+	if addrs, ok := controller.hostCache.Get(host); ok {
+		return addrs.([]string), nil
+	}
+
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		controller.hostCache.SetDefault(host, []string{})
+		return nil, xerrors.Errorf("failed to resolve %s: %w", host, err)
+	}
+
+	controller.hostCache.SetDefault(host, addrs)
+	return addrs, nil
+}
+
+// GetTicketSecretKey returns the secret key of S3 credentials for the ticket
+// the ticket is sent in access keys, so the secret key is derived from it with a key only servers know
+func (controller *IrodsController) GetTicketSecretKey(ticketString string) string {
+	mac := hmac.New(sha256.New, controller.ticketKey)
+	mac.Write([]byte(ticketString))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))[:ticketSecretKeyLength]
+}
+
+// getCachedTicket returns ticket information cached shortly, not to query iRODS on every request
+// uses counts may lag, iRODS checks and counts uses itself when objects are opened with the ticket
+func (controller *IrodsController) getCachedTicket(ctx context.Context, ticketString string) (*Ticket, error) {
+	if ticket, ok := controller.ticketCache.Get(ticketString); ok {
+		return ticket.(*Ticket), nil
+	}
+
+	ticket, err := controller.GetTicket(ctx, ticketString)
+	if err != nil {
+		return nil, err
+	}
+
+	controller.ticketCache.SetDefault(ticketString, ticket)
+	return ticket, nil
+}
+
+// CheckTicket checks expiry, uses and host restrictions of the ticket for the client
+// a use is counted only when an object is read with the ticket, see OpenObject
+func (controller *IrodsController) CheckTicket(ctx context.Context, ticketString string, clientAddress string) (_ *Ticket, err error) {
+	ctx, span := startSpan(ctx, "CheckTicket")
+	defer func() { endSpan(span, err) }()
+
+	ticket, err := controller.getCachedTicket(ctx, ticketString)
+	if err != nil {
+		return nil, err
+	}
+
+	if ticket.IsExpired() {
+		return nil, xerrors.Errorf("ticket expired at %s", ticket.ExpireTime.Format(time.RFC3339))
+	}
+
+	if ticket.IsUsedUp() {
+		return nil, xerrors.Errorf("ticket reached its uses limit %d", ticket.UsesLimit)
+	}
+
+	if !ticket.IsHostAllowed(clientAddress, controller.lookupHost) {
+		return nil, xerrors.Errorf("ticket is not allowed for host %s", clientAddress)
+	}
+
+	return ticket, nil
+}
+
+// GetTicketFilesystem returns a filesystem opened with the ticket, the caller must call done when it stops using it
+func (controller *IrodsController) GetTicketFilesystem(ctx context.Context, ticketString string) (_ *irodsclient_fs.FileSystem, done func(), err error) {
+	_, span := startSpan(ctx, "GetTicketFilesystem")
+	defer func() { endSpan(span, err) }()
+
+	return controller.clientPool.GetTicketFilesystem(ticketString)
+}
+
+// ListTicketRootDirStats returns the bucket that the ticket grants access to, accessed with the ticket
+func (controller *IrodsController) ListTicketRootDirStats(ctx context.Context, ticketString string) (_ []*irodsclient_fs.Entry, err error) {
+	ctx, span := startSpan(ctx, "ListTicketRootDirStats")
+	defer func() { endSpan(span, err) }()
+
+	ticket, err := controller.GetTicket(ctx, ticketString)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, _, err := controller.SplitPath(ticket.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	filesystem, done, err := controller.GetTicketFilesystem(ctx, ticketString)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	entry, err := filesystem.Stat(ticket.Path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to stat %s with ticket: %w", ticket.Path, err)
+	}
+
+	bucketEntry := *entry
+	bucketEntry.Type = irodsclient_fs.DirectoryEntry
+	bucketEntry.Name = bucket
+	bucketEntry.Path = controller.getBucketPath(bucket)
+
+	return []*irodsclient_fs.Entry{&bucketEntry}, nil
+}
+
+// CreateTicket creates a ticket owned by the user for the path
+func (controller *IrodsController) CreateTicket(ctx context.Context, username string, irodsPath string, ticketType irodsclient_types.TicketType, usesLimit int64, expireTime time.Time, allowedHosts []string) (_ string, err error) {
+	_, span := startSpan(ctx, "CreateTicket", userAttribute(username), pathAttribute(irodsPath))
+	defer func() { endSpan(span, err) }()
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irods",
+		"struct":   "IrodsController",
+		"function": "CreateTicket",
+	})
+
+	// connect as the user via admin proxy so the user owns the ticket
+	account, err := irodsclient_types.CreateIRODSProxyAccount(controller.config.IrodsHost, controller.config.IrodsPort, username, controller.config.IrodsZone, controller.config.IrodsAdminUsername, controller.config.IrodsZone, irodsclient_types.AuthSchemeNative, controller.config.IrodsAdminPassword, "")
+	if err != nil {
+		return "", xerrors.Errorf("failed to create a proxy account: %w", err)
+	}
+
+	conn := irodsclient_conn.NewIRODSConnection(account, ticketRequestTimeout, applicationName)
+	err = conn.Connect()
+	if err != nil {
+		return "", xerrors.Errorf("failed to connect to %s:%d as %s: %w", account.Host, account.Port, username, err)
+	}
+	defer conn.Disconnect()
+
+	ticketString, err := makeTicketString()
+	if err != nil {
+		return "", err
+	}
+
+	requests := []*irodsclient_message.IRODSMessageTicketAdminRequest{
+		irodsclient_message.NewIRODSMessageTicketAdminRequest("create", ticketString, string(ticketType), irodsPath, ticketString),
+	}
+
+	if usesLimit > 0 {
+		requests = append(requests, irodsclient_message.NewIRODSMessageTicketAdminRequest("mod", ticketString, "uses", strconv.FormatInt(usesLimit, 10)))
+	}
+
+	if !expireTime.IsZero() {
+		requests = append(requests, irodsclient_message.NewIRODSMessageTicketAdminRequest("mod", ticketString, "expire", strconv.FormatInt(expireTime.Unix(), 10)))
+	}
+
+	for _, allowedHost := range allowedHosts {
+		requests = append(requests, irodsclient_message.NewIRODSMessageTicketAdminRequest("mod", ticketString, "add", "host", allowedHost))
+	}
+
+	for _, request := range requests {
+		conn.Lock()
+		err = conn.RequestAndCheck(request, &irodsclient_message.IRODSMessageTicketAdminResponse{}, nil)
+		conn.Unlock()
+		if err != nil {
+			return "", xerrors.Errorf("failed to %s ticket for %s: %w", request.Action, irodsPath, err)
+		}
+	}
+
+	logger.Infof("created a %s ticket for %s owned by %s", ticketType, irodsPath, username)
+	return ticketString, nil
+}
+
+// IsCollection checks if the path is a collection
+func (controller *IrodsController) IsCollection(ctx context.Context, irodsPath string) bool {
+	_, span := startSpan(ctx, "IsCollection", pathAttribute(irodsPath))
+	defer span.End()
+
+	filesystem, err := controller.getAdminFilesystem()
+	if err != nil {
+		return false
+	}
+
+	return filesystem.ExistsDir(irodsPath)
+}
+
+// SplitPath splits an iRODS path into bucket and key
+func (controller *IrodsController) SplitPath(irodsPath string) (string, string, error) {
+	homePath := fmt.Sprintf("/%s/home/", controller.config.IrodsZone)
+	if !strings.HasPrefix(irodsPath, homePath) {
+		return "", "", xerrors.Errorf("path %s is not under %s", irodsPath, homePath)
+	}
+
+	relPath := strings.TrimPrefix(irodsPath, homePath)
+	parts := strings.SplitN(relPath, "/", 2)
+	if len(parts[0]) == 0 {
+		return "", "", xerrors.Errorf("path %s does not have a bucket", irodsPath)
+	}
+
+	if len(parts) == 1 {
+		return parts[0], "", nil
+	}
+
+	return parts[0], parts[1], nil
+}
+
+func makeTicketString() (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(ticketStringLetters)))
+	for i := 0; i < ticketStringLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", xerrors.Errorf("failed to generate a ticket string: %w", err)
+		}
+		sb.WriteByte(ticketStringLetters[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// IsValidTicketString checks if the ticket string is safe to be used in queries
+func IsValidTicketString(ticketString string) bool {
+	if len(ticketString) == 0 {
+		return false
+	}
+	return !strings.ContainsAny(ticketString, "'\\\"/ ")
+}
+
+func queryTicket(conn *irodsclient_conn.IRODSConnection, ticketString string) (*Ticket, error) {
+	if !IsValidTicketString(ticketString) {
+		return nil, irodsclient_types.NewFileNotFoundErrorf("failed to find a ticket")
+	}
+
+	conn.Lock()
+	defer conn.Unlock()
+
+	query := irodsclient_message.NewIRODSMessageQueryRequest(irodsclient_common.MaxQueryRows, 0, 0, 0)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_TICKET_TYPE, 1)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_TICKET_OBJECT_TYPE, 1)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_TICKET_USES_LIMIT, 1)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_TICKET_USES_COUNT, 1)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_TICKET_EXPIRY_TS, 1)
+	query.AddSelect(irodsclient_common.ICAT_COLUMN_TICKET_COLL_NAME, 1)
+	query.AddSelect(icatColumnTicketOwnerName, 1)
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_TICKET_STRING, fmt.Sprintf("= '%s'", ticketString))
+
+	rows, err := requestQuery(conn, query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query ticket: %w", err)
+	}
+
+	if len(rows) == 0 {
+		// ticket on a data object, collection name column does not join
+		query = irodsclient_message.NewIRODSMessageQueryRequest(irodsclient_common.MaxQueryRows, 0, 0, 0)
+		query.AddSelect(irodsclient_common.ICAT_COLUMN_TICKET_TYPE, 1)
+		query.AddSelect(irodsclient_common.ICAT_COLUMN_TICKET_OBJECT_TYPE, 1)
+		query.AddSelect(irodsclient_common.ICAT_COLUMN_TICKET_USES_LIMIT, 1)
+		query.AddSelect(irodsclient_common.ICAT_COLUMN_TICKET_USES_COUNT, 1)
+		query.AddSelect(irodsclient_common.ICAT_COLUMN_TICKET_EXPIRY_TS, 1)
+		query.AddSelect(icatColumnTicketDataCollName, 1)
+		query.AddSelect(icatColumnTicketDataName, 1)
+		query.AddSelect(icatColumnTicketOwnerName, 1)
+		query.AddCondition(irodsclient_common.ICAT_COLUMN_TICKET_STRING, fmt.Sprintf("= '%s'", ticketString))
+
+		rows, err = requestQuery(conn, query)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to query ticket: %w", err)
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, irodsclient_types.NewFileNotFoundErrorf("failed to find a ticket")
+	}
+
+	row := rows[0]
+	ticket := &Ticket{
+		Name:  ticketString,
+		Type:  irodsclient_types.TicketType(row[irodsclient_common.ICAT_COLUMN_TICKET_TYPE]),
+		Owner: row[icatColumnTicketOwnerName],
+	}
+
+	if collName, ok := row[irodsclient_common.ICAT_COLUMN_TICKET_COLL_NAME]; ok {
+		ticket.ObjectType = irodsclient_types.ObjectTypeCollection
+		ticket.Path = collName
+	} else {
+		ticket.ObjectType = irodsclient_types.ObjectTypeDataObject
+		ticket.Path = row[icatColumnTicketDataCollName] + "/" + row[icatColumnTicketDataName]
+	}
+
+	ticket.UsesLimit, _ = strconv.ParseInt(row[irodsclient_common.ICAT_COLUMN_TICKET_USES_LIMIT], 10, 64)
+	ticket.UsesCount, _ = strconv.ParseInt(row[irodsclient_common.ICAT_COLUMN_TICKET_USES_COUNT], 10, 64)
+
+	expiry := strings.TrimSpace(row[irodsclient_common.ICAT_COLUMN_TICKET_EXPIRY_TS])
+	if len(expiry) > 0 {
+		ticket.ExpireTime, err = irodsclient_util.GetIRODSDateTime(expiry)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse expiry time '%s': %w", expiry, err)
+		}
+	}
+
+	return ticket, nil
+}
+
+func queryTicketAllowedHosts(conn *irodsclient_conn.IRODSConnection, ticketString string) ([]string, error) {
+	conn.Lock()
+	defer conn.Unlock()
+
+	query := irodsclient_message.NewIRODSMessageQueryRequest(irodsclient_common.MaxQueryRows, 0, 0, 0)
+	query.AddSelect(icatColumnTicketAllowedHost, 1)
+	query.AddCondition(irodsclient_common.ICAT_COLUMN_TICKET_STRING, fmt.Sprintf("= '%s'", ticketString))
+
+	rows, err := requestQuery(conn, query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query ticket allowed hosts: %w", err)
+	}
+
+	hosts := []string{}
+	for _, row := range rows {
+		if host := row[icatColumnTicketAllowedHost]; len(host) > 0 {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts, nil
+}
@@ -0,0 +1,89 @@
+package irods
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTicketIsUsedUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		ticket   Ticket
+		expected bool
+	}{
+		{"unlimited", Ticket{UsesLimit: 0, UsesCount: 10}, false},
+		{"uses left", Ticket{UsesLimit: 3, UsesCount: 2}, false},
+		{"used up", Ticket{UsesLimit: 3, UsesCount: 3}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.ticket.IsUsedUp() != test.expected {
+				t.Errorf("expected %t", test.expected)
+			}
+		})
+	}
+}
+
+func TestTicketIsExpired(t *testing.T) {
+	tests := []struct {
+		name       string
+		expireTime time.Time
+		expected   bool
+	}{
+		{"no expiry", time.Time{}, false},
+		{"epoch", time.Unix(0, 0), false},
+		{"future", time.Now().Add(time.Hour), false},
+		{"past", time.Now().Add(-time.Hour), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ticket := Ticket{ExpireTime: test.expireTime}
+			if ticket.IsExpired() != test.expected {
+				t.Errorf("expected %t", test.expected)
+			}
+		})
+	}
+}
+
+func TestTicketIsHostAllowed(t *testing.T) {
+	lookups := 0
+	lookupHost := func(host string) ([]string, error) {
+		lookups++
+		if host == "client.example.com" {
+			return []string{"192.0.2.10"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	tests := []struct {
+		name          string
+		allowedHosts  []string
+		clientAddress string
+		expected      bool
+		lookups       int
+	}{
+		{"no restriction", nil, "192.0.2.10", true, 0},
+		{"allowed IP", []string{"192.0.2.10"}, "192.0.2.10", true, 0},
+		{"other IP", []string{"192.0.2.11"}, "192.0.2.10", false, 0},
+		{"allowed host name", []string{"unknown.example.com", "client.example.com"}, "192.0.2.10", true, 2},
+		{"other host name", []string{"client.example.com"}, "192.0.2.11", false, 1},
+		{"client is not an IP", []string{"client.example.com"}, "unix-socket", false, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lookups = 0
+			ticket := Ticket{AllowedHosts: test.allowedHosts}
+			if ticket.IsHostAllowed(test.clientAddress, lookupHost) != test.expected {
+				t.Errorf("expected %t", test.expected)
+			}
+
+			if lookups != test.lookups {
+				t.Errorf("expected %d lookups, got %d", test.lookups, lookups)
+			}
+		})
+	}
+}
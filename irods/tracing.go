@@ -0,0 +1,60 @@
+package irods
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/cyverse/s3rods/irods"
+)
+
+type requestIDContextKey struct{}
+
+var (
+	tracer = otel.Tracer(tracerName)
+)
+
+// WithRequestID returns a context carrying the S3 request id, recorded in spans of IrodsController calls
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// startSpan starts a span of an IrodsController call, a child of the S3 request span in the context
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if requestID, ok := ctx.Value(requestIDContextKey{}).(string); ok {
+		attrs = append(attrs, attribute.String("aws.request_id", requestID))
+	}
+
+	return tracer.Start(ctx, "IrodsController."+name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan records the error returned by the call and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+func userAttribute(username string) attribute.KeyValue {
+	return attribute.String("s3rods.user", username)
+}
+
+func bucketAttribute(bucket string) attribute.KeyValue {
+	return attribute.String("s3rods.bucket", bucket)
+}
+
+func keyAttribute(key string) attribute.KeyValue {
+	return attribute.String("s3rods.key", key)
+}
+
+func pathAttribute(irodsPath string) attribute.KeyValue {
+	return attribute.String("irods.path", irodsPath)
+}
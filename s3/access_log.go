@@ -0,0 +1,346 @@
+package s3
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	// errorCodeContextKey is a gin context key of the S3 error code responded
+	errorCodeContextKey = "s3rods.error_code"
+
+	accessLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+// accessLogOperations maps S3 operations to operation names of AWS server access logs
+var accessLogOperations = map[string]string{
+	"ListBuckets":             "REST.GET.SERVICE",
+	"ListObjects":             "REST.GET.BUCKET",
+	"HeadBucket":              "REST.HEAD.BUCKET",
+	"CreateBucket":            "REST.PUT.BUCKET",
+	"DeleteBucket":            "REST.DELETE.BUCKET",
+	"GetBucketPolicy":         "REST.GET.BUCKETPOLICY",
+	"PutBucketPolicy":         "REST.PUT.BUCKETPOLICY",
+	"DeleteBucketPolicy":      "REST.DELETE.BUCKETPOLICY",
+	"GetBucketLogging":        "REST.GET.LOGGING_STATUS",
+	"PutBucketLogging":        "REST.PUT.LOGGING_STATUS",
+	"GetBucketLocation":       "REST.GET.LOCATION",
+	"ListMultipartUploads":    "REST.GET.UPLOADS",
+	"DeleteObjects":           "REST.POST.MULTI_OBJECT_DELETE",
+	"GetObject":               "REST.GET.OBJECT",
+	"HeadObject":              "REST.HEAD.OBJECT",
+	"PutObject":               "REST.PUT.OBJECT",
+	"CopyObject":              "REST.COPY.OBJECT",
+	"DeleteObject":            "REST.DELETE.OBJECT",
+	"CreateMultipartUpload":   "REST.POST.UPLOADS",
+	"UploadPart":              "REST.PUT.PART",
+	"UploadPartCopy":          "REST.COPY.PART",
+	"CompleteMultipartUpload": "REST.POST.UPLOAD",
+	"AbortMultipartUpload":    "REST.DELETE.UPLOAD",
+	"ListParts":               "REST.GET.UPLOAD",
+}
+
+// redactedQueryParams are query parameters not to be written in access logs
+var redactedQueryParams = []string{"X-Amz-Signature", "X-Amz-Security-Token", "WebIdentityToken"}
+
+// AccessLogRecord is a record of AWS server access logs
+type AccessLogRecord struct {
+	Bucket             string
+	Time               time.Time
+	RemoteIP           string
+	Requester          string
+	RequestID          string
+	Operation          string
+	Key                string
+	RequestURI         string
+	HTTPStatus         int
+	ErrorCode          string
+	BytesSent          int64
+	ObjectSize         int64
+	TotalTime          time.Duration
+	Referer            string
+	UserAgent          string
+	SignatureVersion   string
+	CipherSuite        string
+	AuthenticationType string
+	HostHeader         string
+	TLSVersion         string
+}
+
+// newAccessLogRecord makes an access log record of the request served
+func newAccessLogRecord(c *gin.Context, startTime time.Time) *AccessLogRecord {
+	operation := getS3Operation(c.Request)
+
+	record := &AccessLogRecord{
+		Bucket:     operation.Bucket,
+		Time:       startTime,
+		RemoteIP:   c.ClientIP(),
+		RequestID:  c.Writer.Header().Get("X-Amz-Request-Id"),
+		Operation:  getAccessLogOperation(c.Request.Method, operation.Name),
+		Key:        operation.Key,
+		RequestURI: fmt.Sprintf("%s %s %s", c.Request.Method, getRedactedRequestURI(c.Request.URL), c.Request.Proto),
+		HTTPStatus: c.Writer.Status(),
+		ErrorCode:  c.GetString(errorCodeContextKey),
+		BytesSent:  int64(c.Writer.Size()),
+		ObjectSize: -1,
+		TotalTime:  time.Since(startTime),
+		Referer:    c.Request.Referer(),
+		UserAgent:  c.Request.UserAgent(),
+		HostHeader: c.Request.Host,
+	}
+
+	if credentialValue, ok := c.Get(credentialContextKey); ok {
+		credential := credentialValue.(*AWSCredential)
+		record.Requester = credential.Username
+		record.SignatureVersion = "SigV4"
+		record.AuthenticationType = "AuthHeader"
+		if len(c.Query("X-Amz-Signature")) > 0 {
+			record.AuthenticationType = "QueryString"
+		}
+	}
+
+	switch operation.Name {
+	case "PutObject", "UploadPart":
+		record.ObjectSize = c.Request.ContentLength
+	case "GetObject", "HeadObject":
+		if contentLength, err := strconv.ParseInt(c.Writer.Header().Get("Content-Length"), 10, 64); err == nil {
+			record.ObjectSize = contentLength
+		}
+	}
+
+	if c.Request.TLS != nil {
+		record.CipherSuite = tls.CipherSuiteName(c.Request.TLS.CipherSuite)
+		record.TLSVersion = getTLSVersionName(c.Request.TLS.Version)
+	}
+
+	return record
+}
+
+// getAccessLogOperation returns an operation name of AWS server access logs, REST.GET.OBJECT
+func getAccessLogOperation(method string, operationName string) string {
+	if name, ok := accessLogOperations[operationName]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("REST.%s.%s", method, strings.ToUpper(operationName))
+}
+
+func getRedactedRequestURI(requestURL *url.URL) string {
+	query := requestURL.Query()
+
+	redacted := false
+	for _, param := range redactedQueryParams {
+		if _, ok := query[param]; ok {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+
+	// tickets in access keys are credentials for iRODS, the scope is kept
+	if credential := query.Get("X-Amz-Credential"); strings.HasPrefix(credential, TicketAccessKeyPrefix) {
+		accessKey, scope, _ := strings.Cut(credential, "/")
+		if len(scope) > 0 {
+			scope = "/" + scope
+		}
+
+		query.Set("X-Amz-Credential", getRedactedAccessKey(accessKey)+scope)
+		redacted = true
+	}
+
+	if !redacted {
+		return requestURL.RequestURI()
+	}
+
+	return requestURL.EscapedPath() + "?" + query.Encode()
+}
+
+// getRedactedAccessKey returns the access key to log, tickets in access keys are redacted
+func getRedactedAccessKey(accessKey string) string {
+	if strings.HasPrefix(accessKey, TicketAccessKeyPrefix) {
+		return TicketAccessKeyPrefix + "REDACTED"
+	}
+	return accessKey
+}
+
+// redactedLogFormatter formats gin request logs like the default formatter with redacted request URIs
+func redactedLogFormatter(param gin.LogFormatterParams) string {
+	path := param.Path
+	if requestURL, err := url.ParseRequestURI(path); err == nil {
+		path = getRedactedRequestURI(requestURL)
+	}
+
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		path,
+		param.ErrorMessage,
+	)
+}
+
+func getTLSVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLSv1"
+	case tls.VersionTLS11:
+		return "TLSv1.1"
+	case tls.VersionTLS12:
+		return "TLSv1.2"
+	case tls.VersionTLS13:
+		return "TLSv1.3"
+	default:
+		return ""
+	}
+}
+
+// String formats the record in the AWS server access log format, empty fields are written as -
+func (record *AccessLogRecord) String() string {
+	field := func(value string) string {
+		if len(value) == 0 {
+			return "-"
+		}
+		return value
+	}
+
+	quoted := func(value string) string {
+		if len(value) == 0 {
+			return "-"
+		}
+		return strconv.Quote(value)
+	}
+
+	number := func(value int64) string {
+		if value <= 0 {
+			return "-"
+		}
+		return strconv.FormatInt(value, 10)
+	}
+
+	errorCode := record.ErrorCode
+	if len(errorCode) == 0 && record.HTTPStatus >= http.StatusBadRequest {
+		errorCode = http.StatusText(record.HTTPStatus)
+	}
+
+	fields := []string{
+		"-", // bucket owner
+		field(record.Bucket),
+		"[" + record.Time.Format(accessLogTimeFormat) + "]",
+		field(record.RemoteIP),
+		field(record.Requester),
+		field(record.RequestID),
+		field(record.Operation),
+		field(url.PathEscape(record.Key)),
+		quoted(record.RequestURI),
+		strconv.Itoa(record.HTTPStatus),
+		field(errorCode),
+		number(record.BytesSent),
+		number(record.ObjectSize),
+		strconv.FormatInt(record.TotalTime.Milliseconds(), 10),
+		"-", // turn-around time
+		quoted(record.Referer),
+		quoted(record.UserAgent),
+		"-", // version id
+		"-", // host id
+		field(record.SignatureVersion),
+		field(record.CipherSuite),
+		field(record.AuthenticationType),
+		field(record.HostHeader),
+		field(record.TLSVersion),
+		"-", // access point arn
+		"-", // acl required
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// AccessLogger writes server access logs to a rotating file
+type AccessLogger struct {
+	writer io.WriteCloser
+	mutex  sync.Mutex
+}
+
+// NewAccessLogger creates a new AccessLogger writing to the path, rotated like service logs
+func NewAccessLogger(logPath string) *AccessLogger {
+	return &AccessLogger{
+		writer: &lumberjack.Logger{
+			Filename:   logPath,
+			MaxSize:    50, // 50MB
+			MaxBackups: 5,
+			MaxAge:     30, // 30 days
+			Compress:   false,
+		},
+	}
+}
+
+// Write writes a record
+func (logger *AccessLogger) Write(record *AccessLogRecord) error {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	_, err := io.WriteString(logger.writer, record.String()+"\n")
+	return err
+}
+
+// Release closes the log file
+func (logger *AccessLogger) Release() error {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	return logger.writer.Close()
+}
+
+// accessLogMiddleware writes a server access log record per S3 request to the access log and to target buckets
+func (service *S3Service) accessLogMiddleware() gin.HandlerFunc {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "accessLogMiddleware",
+	})
+
+	return func(c *gin.Context) {
+		if c.Request.URL.Path == service.config.MetricsPath {
+			c.Next()
+			return
+		}
+
+		switch getRequestOperationName(c) {
+		case "Ping", "Health", "Admin", "STS":
+			// not S3 requests
+			c.Next()
+			return
+		}
+
+		startTime := time.Now()
+
+		c.Next()
+
+		record := newAccessLogRecord(c, startTime)
+
+		if service.accessLogger != nil {
+			err := service.accessLogger.Write(record)
+			if err != nil {
+				logger.Errorf("failed to write access log: %+v", err)
+			}
+		}
+
+		// delivered to target buckets if logging is enabled on the bucket
+		service.bucketLogDelivery.Add(record)
+	}
+}
@@ -0,0 +1,145 @@
+package s3
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/cyverse/s3rods/commons"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// AdminPathPrefix is the path prefix of admin endpoints, never a valid bucket name
+	AdminPathPrefix = commons.ReservedPathPrefix + "admin"
+
+	// adminContextKey is a gin context key of the admin authenticated, a username or adminTokenIdentity
+	adminContextKey = "s3rods.admin"
+	// adminTokenIdentity identifies requests authenticated by the admin token
+	adminTokenIdentity = "admin_token"
+)
+
+// setupAdminRouter setup admin endpoints, requests must be signed by admin users or carry the admin token
+// actions changing state are written to the audit log
+func (service *S3Service) setupAdminRouter() {
+	admin := service.router.Group(AdminPathPrefix, service.auditMiddleware(), service.adminAuthMiddleware())
+	admin.GET("/buckets/:bucket/usage", service.handleAdminGetBucketUsage)
+	admin.GET("/users/:user/usage", service.handleAdminGetUserUsage)
+	admin.POST("/config/reload", service.handleAdminReloadConfig)
+
+	admin.GET("/users/:user/keys", service.handleAdminGetAccessKey)
+	admin.POST("/users/:user/keys", service.handleAdminCreateAccessKey)
+	admin.DELETE("/users/:user/keys", service.handleAdminDeleteAccessKey)
+	admin.GET("/users/:user/access", service.handleAdminGetUserAccess)
+	admin.PUT("/users/:user/access", service.handleAdminSetUserAccess)
+	admin.DELETE("/users/:user/sessions", service.handleAdminDisconnectUser)
+
+	service.setupDiagnosticsRouter(admin)
+}
+
+// writeAdminError writes an error response of admin endpoints in JSON
+func (service *S3Service) writeAdminError(c *gin.Context, err error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "writeAdminError",
+	})
+
+	var s3Error *S3Error
+	if !xerrors.As(err, &s3Error) {
+		logger.Errorf("%+v", err)
+		s3Error = ErrInternalError
+	}
+
+	type errorOutput struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+
+	c.Set(errorCodeContextKey, s3Error.Code)
+	service.setResponseHeader(c)
+	c.AbortWithStatusJSON(s3Error.HTTPStatusCode, errorOutput{
+		Code:    s3Error.Code,
+		Message: s3Error.Message,
+	})
+}
+
+// adminAuthMiddleware authenticates admin users with SigV4 signed by their long-term keys, or the admin token
+func (service *S3Service) adminAuthMiddleware() gin.HandlerFunc {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "adminAuthMiddleware",
+	})
+
+	return func(c *gin.Context) {
+		logger.Infof("admin request to %s", getRedactedRequestURI(c.Request.URL))
+
+		if token, ok := getBearerToken(c); ok {
+			if len(service.config.AdminToken) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte(service.config.AdminToken)) != 1 {
+				logger.Warnf("rejected admin request to %s with an invalid admin token", getRedactedRequestURI(c.Request.URL))
+				service.writeAdminError(c, ErrAccessDenied)
+				return
+			}
+
+			c.Set(adminContextKey, adminTokenIdentity)
+			c.Next()
+			return
+		}
+
+		credential, err := service.authenticateUser(c, serviceTypeS3)
+		if err != nil {
+			service.writeAdminError(c, toAuthError(err))
+			return
+		}
+
+		_, isSession := c.Get(sessionContextKey)
+		if len(credential.Ticket) > 0 || isSession || !service.config.IsAdminUser(credential.Username) {
+			logger.Warnf("rejected admin request to %s by %s", getRedactedRequestURI(c.Request.URL), credential.Username)
+			service.writeAdminError(c, ErrAccessDenied)
+			return
+		}
+
+		c.Set(adminContextKey, credential.Username)
+		c.Next()
+	}
+}
+
+// getBearerToken returns the token of the Authorization header, SigV4 headers are not bearer tokens
+func getBearerToken(c *gin.Context) (string, bool) {
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	return strings.TrimSpace(token), true
+}
+
+func (service *S3Service) handleAdminGetBucketUsage(c *gin.Context) {
+	usage, err := service.irodsController.GetBucketUsage(c.Request.Context(), c.Param("bucket"))
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			service.writeAdminError(c, ErrNoSuchBucket)
+			return
+		}
+		service.writeAdminError(c, err)
+		return
+	}
+
+	service.setResponseHeader(c)
+	c.JSON(http.StatusOK, usage)
+}
+
+func (service *S3Service) handleAdminGetUserUsage(c *gin.Context) {
+	usage, err := service.irodsController.GetUserUsage(c.Request.Context(), c.Param("user"))
+	if err != nil {
+		service.writeAdminError(c, err)
+		return
+	}
+
+	service.setResponseHeader(c)
+	c.JSON(http.StatusOK, usage)
+}
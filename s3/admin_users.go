@@ -0,0 +1,216 @@
+package s3
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/cyverse/s3rods/irods"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// UserAccessOutput is S3 access status of a user
+type UserAccessOutput struct {
+	Username string `json:"username"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// UserAccessInput is a request changing S3 access of a user
+type UserAccessInput struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// DisconnectOutput is iRODS connections released for a user
+type DisconnectOutput struct {
+	Username    string `json:"username"`
+	Clients     int    `json:"clients"`
+	Connections int    `json:"connections"`
+}
+
+// getAdminUserParam returns the user in the path, tickets and anonymous users have no keys
+func (service *S3Service) getAdminUserParam(c *gin.Context) (string, bool) {
+	username := c.Param("user")
+	if len(username) == 0 || username == ticketUsername || strings.HasPrefix(username, TicketAccessKeyPrefix) {
+		service.writeAdminError(c, ErrInvalidArgument.WithMessage("invalid user %q", username))
+		return "", false
+	}
+
+	return username, true
+}
+
+// writeAccessKeyError writes an error of key store operations, unknown keys are not found
+func (service *S3Service) writeAccessKeyError(c *gin.Context, err error) {
+	if xerrors.Is(err, irods.ErrAccessKeyNotFound) {
+		service.writeAdminError(c, ErrNoSuchEntity)
+		return
+	}
+
+	service.writeAdminError(c, err)
+}
+
+func (service *S3Service) handleAdminGetAccessKey(c *gin.Context) {
+	username, ok := service.getAdminUserParam(c)
+	if !ok {
+		return
+	}
+
+	accessKey, err := service.irodsController.GetUserAccessKey(c.Request.Context(), username)
+	if err != nil {
+		service.writeAccessKeyError(c, err)
+		return
+	}
+
+	service.setResponseHeader(c)
+	c.JSON(http.StatusOK, accessKey)
+}
+
+// handleAdminCreateAccessKey creates a secret key of the user, replacing the existing one
+// the secret key is only returned in this response
+func (service *S3Service) handleAdminCreateAccessKey(c *gin.Context) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleAdminCreateAccessKey",
+	})
+
+	username, ok := service.getAdminUserParam(c)
+	if !ok {
+		return
+	}
+
+	accessKey, err := service.irodsController.CreateUserAccessKey(c.Request.Context(), username)
+	if err != nil {
+		service.writeAccessKeyError(c, err)
+		return
+	}
+
+	// signing keys derived from the replaced secret key must not be used
+	service.authCache.InvalidateAccessKey(accessKey.AccessKey)
+	logger.Infof("Created a secret key of user %s", username)
+
+	service.setResponseHeader(c)
+	c.JSON(http.StatusCreated, accessKey)
+}
+
+func (service *S3Service) handleAdminDeleteAccessKey(c *gin.Context) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleAdminDeleteAccessKey",
+	})
+
+	username, ok := service.getAdminUserParam(c)
+	if !ok {
+		return
+	}
+
+	err := service.irodsController.DeleteUserAccessKey(c.Request.Context(), username)
+	if err != nil {
+		service.writeAccessKeyError(c, err)
+		return
+	}
+
+	// other instances keep cached signing keys until auth_cache_timeout
+	service.authCache.InvalidateAccessKey(username)
+	logger.Infof("Revoked the secret key of user %s", username)
+
+	service.setResponseHeader(c)
+	c.Status(http.StatusNoContent)
+}
+
+func (service *S3Service) handleAdminGetUserAccess(c *gin.Context) {
+	username, ok := service.getAdminUserParam(c)
+	if !ok {
+		return
+	}
+
+	disabled, err := service.irodsController.IsUserS3Disabled(c.Request.Context(), username)
+	if err != nil {
+		service.writeAdminError(c, err)
+		return
+	}
+
+	service.setResponseHeader(c)
+	c.JSON(http.StatusOK, UserAccessOutput{
+		Username: username,
+		Enabled:  !disabled,
+	})
+}
+
+// handleAdminSetUserAccess enables or disables S3 access of the user, including STS sessions issued
+// disabling also releases iRODS connections of the user
+func (service *S3Service) handleAdminSetUserAccess(c *gin.Context) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleAdminSetUserAccess",
+	})
+
+	username, ok := service.getAdminUserParam(c)
+	if !ok {
+		return
+	}
+
+	input := UserAccessInput{}
+	err := c.ShouldBindJSON(&input)
+	if err != nil || input.Enabled == nil {
+		service.writeAdminError(c, ErrInvalidArgument.WithMessage("request body must be {\"enabled\": true|false}"))
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err = service.irodsController.SetUserS3Disabled(ctx, username, !*input.Enabled)
+	if err != nil {
+		service.writeAdminError(c, err)
+		return
+	}
+
+	if !*input.Enabled {
+		service.authCache.InvalidateAccessKey(username)
+
+		_, err = service.irodsController.DisconnectUser(ctx, username)
+		if err != nil {
+			service.writeAdminError(c, err)
+			return
+		}
+	}
+
+	logger.Infof("Set S3 access of user %s to %t", username, *input.Enabled)
+
+	service.setResponseHeader(c)
+	c.JSON(http.StatusOK, UserAccessOutput{
+		Username: username,
+		Enabled:  *input.Enabled,
+	})
+}
+
+// handleAdminDisconnectUser releases iRODS connections of the user, requests using them fail
+func (service *S3Service) handleAdminDisconnectUser(c *gin.Context) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleAdminDisconnectUser",
+	})
+
+	username, ok := service.getAdminUserParam(c)
+	if !ok {
+		return
+	}
+
+	released, err := service.irodsController.DisconnectUser(c.Request.Context(), username)
+	if err != nil {
+		service.writeAdminError(c, err)
+		return
+	}
+
+	logger.Infof("Disconnected %d iRODS clients with %d connections of user %s", released.Clients, released.Connections, username)
+
+	service.setResponseHeader(c)
+	c.JSON(http.StatusOK, DisconnectOutput{
+		Username:    username,
+		Clients:     released.Clients,
+		Connections: released.Connections,
+	})
+}
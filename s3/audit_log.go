@@ -0,0 +1,120 @@
+package s3
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// AuditLogRecord is an admin action in the audit log
+type AuditLogRecord struct {
+	Time      time.Time         `json:"time"`
+	RequestID string            `json:"request_id"`
+	Admin     string            `json:"admin,omitempty"` // empty if not authenticated
+	RemoteIP  string            `json:"remote_ip"`
+	Action    string            `json:"action"`
+	Params    map[string]string `json:"params,omitempty"`
+	Status    int               `json:"status"`
+	ErrorCode string            `json:"error_code,omitempty"`
+}
+
+// AuditLogger writes admin actions in JSON lines
+type AuditLogger struct {
+	writer io.WriteCloser
+	mutex  sync.Mutex
+}
+
+// NewAuditLogger creates a new AuditLogger writing to the path, rotated like service logs
+func NewAuditLogger(logPath string) *AuditLogger {
+	return &AuditLogger{
+		writer: &lumberjack.Logger{
+			Filename:   logPath,
+			MaxSize:    50, // 50MB
+			MaxBackups: 5,
+			MaxAge:     30, // 30 days
+			Compress:   false,
+		},
+	}
+}
+
+// Write writes a record
+func (logger *AuditLogger) Write(record *AuditLogRecord) error {
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	_, err = logger.writer.Write(append(recordBytes, '\n'))
+	return err
+}
+
+// Release closes the log file
+func (logger *AuditLogger) Release() error {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	return logger.writer.Close()
+}
+
+// isAuditedMethod checks if requests of the method change state, reads are not audited
+func isAuditedMethod(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+// auditMiddleware writes admin actions to the audit log, including ones rejected by authentication
+func (service *S3Service) auditMiddleware() gin.HandlerFunc {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "auditMiddleware",
+	})
+
+	return func(c *gin.Context) {
+		if !isAuditedMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		// routes have params as placeholders, unknown paths are logged as is
+		route := c.FullPath()
+		if len(route) == 0 {
+			route = c.Request.URL.Path
+		}
+
+		record := &AuditLogRecord{
+			Time:      time.Now().UTC(),
+			RequestID: c.Writer.Header().Get("X-Amz-Request-Id"),
+			Admin:     c.GetString(adminContextKey),
+			RemoteIP:  c.ClientIP(),
+			Action:    c.Request.Method + " " + strings.TrimPrefix(route, AdminPathPrefix),
+			Status:    c.Writer.Status(),
+			ErrorCode: c.GetString(errorCodeContextKey),
+		}
+
+		if len(c.Params) > 0 {
+			record.Params = map[string]string{}
+			for _, param := range c.Params {
+				record.Params[param.Key] = param.Value
+			}
+		}
+
+		err := service.auditLogger.Write(record)
+		if err != nil {
+			logger.Errorf("failed to write audit log: %+v", err)
+		}
+
+		logger.Infof("admin action %s by %q from %s, status %d", record.Action, record.Admin, record.RemoteIP, record.Status)
+	}
+}
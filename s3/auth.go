@@ -5,8 +5,10 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"net/http"
+	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -24,14 +26,32 @@ const (
 	signV4Algorithm = "AWS4-HMAC-SHA256"
 	iso8601Format   = "20060102T150405Z"
 	yyyymmdd        = "20060102"
+
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+
+	serviceTypeS3  = "s3"
+	serviceTypeSTS = "sts"
+	requestVersion = "aws4_request"
+
+	// presignedExpiresMax is the max expiry of presigned URLs, 7 days
+	presignedExpiresMax = 7 * 24 * time.Hour
+
+	// TicketAccessKeyPrefix is the prefix of access keys carrying iRODS tickets, ticket:<ticket>
+	TicketAccessKeyPrefix = "ticket:"
+	ticketUsername        = "anonymous"
+
+	credentialContextKey = "s3rods.credential"
 )
 
 type AWSCredential struct {
+	AccessKey      string // access key given in the request
 	Username       string // iychoi
 	RequestDate    string // YYYYMMDD
 	Region         string // us-east-1
 	ServiceType    string // s3
 	RequestVersion string // aws4_request
+	Ticket         string // set when access key is ticket:<ticket>
+	Temporary      bool   // set when a session token is given, the access key is issued by STS
 }
 
 func (credential AWSCredential) GetScopeString() string {
@@ -84,13 +104,25 @@ func getCredential(request *http.Request) *AWSCredential {
 
 	credentialFields := strings.Split(credentialSSV, "/")
 	if len(credentialFields) == 5 {
-		return &AWSCredential{
+		credential := &AWSCredential{
+			AccessKey:      credentialFields[0],
 			Username:       credentialFields[0],
 			RequestDate:    credentialFields[1],
 			Region:         credentialFields[2],
 			ServiceType:    credentialFields[3],
 			RequestVersion: credentialFields[4],
 		}
+
+		// long-term access keys are usernames that may look like temporary ones, so the token decides
+		credential.Temporary = len(getSecurityToken(request)) > 0
+
+		if strings.HasPrefix(credential.Username, TicketAccessKeyPrefix) {
+			// tickets are accessed as an anonymous user
+			credential.Ticket = strings.TrimPrefix(credential.Username, TicketAccessKeyPrefix)
+			credential.Username = ticketUsername
+		}
+
+		return credential
 	}
 
 	return nil
@@ -106,11 +138,45 @@ func getSignature(request *http.Request) string {
 	return signature
 }
 
-func getRequestAuthFields(request *http.Request) map[string]string {
-	authorization := request.Header.Get("Authorization")
+// getSecurityToken returns a session token of temporary credentials
+func getSecurityToken(request *http.Request) string {
+	if isPresignedRequest(request) {
+		return request.URL.Query().Get("X-Amz-Security-Token")
+	}
+	return request.Header.Get("X-Amz-Security-Token")
+}
+
+// getPayloadHash returns SHA256 of the buffered STS request body
+// used for STS requests, clients don't send X-Amz-Content-SHA256 for them
+func getPayloadHash(request *http.Request) (string, error) {
+	body, err := readSTSRequestBody(request)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:]), nil
+}
 
+// isPresignedRequest checks if the request carries auth fields in query string
+func isPresignedRequest(request *http.Request) bool {
+	return len(request.Header.Get("Authorization")) == 0 && len(request.URL.Query().Get("X-Amz-Algorithm")) > 0
+}
+
+func getRequestAuthFields(request *http.Request) map[string]string {
 	fields := map[string]string{}
 
+	if isPresignedRequest(request) {
+		query := request.URL.Query()
+		fields["algorithm"] = query.Get("X-Amz-Algorithm")
+		fields["Credential"] = query.Get("X-Amz-Credential")
+		fields["SignedHeaders"] = query.Get("X-Amz-SignedHeaders")
+		fields["Signature"] = query.Get("X-Amz-Signature")
+		return fields
+	}
+
+	authorization := request.Header.Get("Authorization")
+
 	authFields := strings.Split(authorization, " ")
 	for fieldIdx, authField := range authFields {
 		authField = strings.TrimSpace(authField)
@@ -226,11 +292,11 @@ func hmacSum(key []byte, data []byte) []byte {
 	return hash.Sum(nil)
 }
 
-func getSigningKey(secretKey string, requestTime time.Time, region string, serviceType string) []byte {
-	date := hmacSum([]byte("AWS4"+secretKey), []byte(requestTime.Format(yyyymmdd)))
+func getSigningKey(secretKey string, requestDate string, region string, serviceType string) []byte {
+	date := hmacSum([]byte("AWS4"+secretKey), []byte(requestDate))
 	regionBytes := hmacSum(date, []byte(region))
 	service := hmacSum(regionBytes, []byte(serviceType))
-	signingKey := hmacSum(service, []byte("aws4_request"))
+	signingKey := hmacSum(service, []byte(requestVersion))
 	return signingKey
 }
 
@@ -238,42 +304,206 @@ func generateSignature(signingKey []byte, stringToSign string) string {
 	return hex.EncodeToString(hmacSum(signingKey, []byte(stringToSign)))
 }
 
-func checkSignature(request *http.Request, secretKey string) (bool, error) {
+// getRequestTime returns the signing time of the request
+// X-Amz-Date is preferred, the Date header is used when X-Amz-Date is not given
+func getRequestTime(request *http.Request) (time.Time, error) {
+	if isPresignedRequest(request) {
+		requestTime, err := time.Parse(iso8601Format, request.URL.Query().Get("X-Amz-Date"))
+		if err != nil {
+			return time.Time{}, xerrors.Errorf("failed to parse X-Amz-Date: %w", err)
+		}
+		return requestTime, nil
+	}
+
+	if amzDate := request.Header.Get("X-Amz-Date"); len(amzDate) > 0 {
+		requestTime, err := time.Parse(iso8601Format, amzDate)
+		if err != nil {
+			return time.Time{}, xerrors.Errorf("failed to parse X-Amz-Date: %w", err)
+		}
+		return requestTime, nil
+	}
+
+	if date := request.Header.Get("Date"); len(date) > 0 {
+		requestTime, err := http.ParseTime(date)
+		if err != nil {
+			// some clients send numeric time zones
+			requestTime, err = time.Parse(time.RFC1123Z, date)
+			if err != nil {
+				return time.Time{}, xerrors.Errorf("failed to parse Date: %w", err)
+			}
+		}
+		return requestTime.UTC(), nil
+	}
+
+	return time.Time{}, xerrors.Errorf("request time is not given")
+}
+
+// checkCredentialScope validates the credential scope and the request time before checking the signature
+func checkCredentialScope(request *http.Request, credential *AWSCredential, serviceType string, regions []string, clockSkewMax time.Duration) error {
+	malformedErr := ErrAuthorizationHeaderMalformed
+	if isPresignedRequest(request) {
+		malformedErr = ErrAuthorizationQueryParametersError
+	}
+
+	if credential.RequestVersion != requestVersion {
+		return malformedErr.WithMessage("The authorization is malformed; incorrect terminal %q. This endpoint uses %q.", credential.RequestVersion, requestVersion)
+	}
+
+	if credential.ServiceType != serviceType {
+		return malformedErr.WithMessage("The authorization is malformed; incorrect service %q. This endpoint belongs to %q.", credential.ServiceType, serviceType)
+	}
+
+	regionAccepted := false
+	for _, region := range regions {
+		if credential.Region == region {
+			regionAccepted = true
+			break
+		}
+	}
+
+	if !regionAccepted {
+		return malformedErr.WithMessage("The authorization is malformed; the region %q is wrong; expecting %q", credential.Region, strings.Join(regions, ", "))
+	}
+
+	requestTime, err := getRequestTime(request)
+	if err != nil {
+		return ErrAccessDenied.WithMessage("%s", err.Error())
+	}
+
+	if credential.RequestDate != requestTime.Format(yyyymmdd) {
+		return malformedErr.WithMessage("The authorization is malformed; invalid date %q. This date is not the date of the request %q.", credential.RequestDate, requestTime.Format(yyyymmdd))
+	}
+
+	skew := time.Since(requestTime)
+	if isPresignedRequest(request) {
+		// presigned URLs are used long after signing, only the future is limited
+		if -skew > clockSkewMax {
+			return ErrRequestTimeTooSkewed
+		}
+		return nil
+	}
+
+	if skew > clockSkewMax || -skew > clockSkewMax {
+		return ErrRequestTimeTooSkewed
+	}
+
+	return nil
+}
+
+// checkSignature checks the signature of the request with the signing key derived for the credential
+func checkSignature(request *http.Request, credential *AWSCredential, signingKey []byte) (bool, error) {
 	logger := log.WithFields(log.Fields{
 		"package":  "s3",
 		"function": "checkSignature",
 	})
 
-	queryString := request.Form.Encode()
+	query := request.URL.Query()
+	presigned := isPresignedRequest(request)
 
 	signedHeaderFields := getSignedHeaderFields(request)
 	contentCheckSum := request.Header.Get("X-Amz-Content-SHA256")
 
+	if presigned {
+		// signature is not a part of canonical query string
+		query.Del("X-Amz-Signature")
+		contentCheckSum = unsignedPayload
+	} else if len(contentCheckSum) == 0 {
+		if credential.ServiceType != serviceTypeSTS {
+			// S3 bodies are streamed, clients sign the hash or UNSIGNED-PAYLOAD in the header
+			return false, ErrInvalidRequest.WithMessage("Missing required header for this request: x-amz-content-sha256")
+		}
+
+		payloadHash, err := getPayloadHash(request)
+		if err != nil {
+			return false, err
+		}
+		contentCheckSum = payloadHash
+	}
+
+	queryString := query.Encode()
+
 	canonicalRequest := getCanonicalRequest(signedHeaderFields, contentCheckSum, queryString, request.URL.Path, request.Method)
 	logger.Debugf("canonical request: %s", canonicalRequest)
 
-	requestDate := request.Header.Get("X-Amz-Date")
-	requestTime, err := time.Parse(iso8601Format, requestDate)
+	requestTime, err := getRequestTime(request)
 	if err != nil {
 		return false, err
 	}
 
-	credential := getCredential(request)
-	if credential == nil {
-		return false, xerrors.Errorf("failed to get credential from request")
+	if presigned {
+		expires, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+		if err != nil {
+			return false, xerrors.Errorf("failed to parse X-Amz-Expires: %w", err)
+		}
+
+		expiresDuration := time.Duration(expires) * time.Second
+		if expiresDuration <= 0 || expiresDuration > presignedExpiresMax {
+			return false, xerrors.Errorf("X-Amz-Expires must be between 1 and %d seconds", int64(presignedExpiresMax.Seconds()))
+		}
+
+		if time.Now().After(requestTime.Add(expiresDuration)) {
+			return false, xerrors.Errorf("request has expired")
+		}
 	}
 
 	stringToSign := getStringToSign(canonicalRequest, requestTime, credential.GetScopeString())
 	logger.Debugf("string to sign: %s", stringToSign)
 
-	signingKey := getSigningKey(secretKey, requestTime, credential.Region, credential.ServiceType)
-	logger.Debugf("signing key: %s", signingKey)
-
 	newSignature := generateSignature(signingKey, stringToSign)
 	logger.Debugf("new signature: %s", newSignature)
 
 	oldSignature := getSignature(request)
 	logger.Debugf("old signature: %s", oldSignature)
 
-	return newSignature == oldSignature, nil
+	return hmac.Equal([]byte(newSignature), []byte(oldSignature)), nil
+}
+
+// GetPresignedURL returns a presigned URL for the bucket or the object
+func GetPresignedURL(endpoint string, method string, bucket string, key string, query url.Values, accessKey string, secretKey string, region string, expires time.Duration) (string, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return "", xerrors.Errorf("failed to parse endpoint %s: %w", endpoint, err)
+	}
+
+	if expires <= 0 || expires > presignedExpiresMax {
+		return "", xerrors.Errorf("expiry must be between 1 second and %s", presignedExpiresMax)
+	}
+
+	urlPath := "/" + bucket
+	if len(key) > 0 {
+		urlPath += "/" + key
+	}
+
+	requestTime := time.Now().UTC()
+	credential := AWSCredential{
+		Username:       accessKey,
+		RequestDate:    requestTime.Format(yyyymmdd),
+		Region:         region,
+		ServiceType:    "s3",
+		RequestVersion: "aws4_request",
+	}
+
+	presignQuery := url.Values{}
+	for k, vs := range query {
+		presignQuery[k] = vs
+	}
+	presignQuery.Set("X-Amz-Algorithm", signV4Algorithm)
+	presignQuery.Set("X-Amz-Credential", credential.Username+"/"+credential.GetScopeString())
+	presignQuery.Set("X-Amz-Date", requestTime.Format(iso8601Format))
+	presignQuery.Set("X-Amz-Expires", strconv.FormatInt(int64(expires.Seconds()), 10))
+	presignQuery.Set("X-Amz-SignedHeaders", "host")
+
+	signedHeaderFields := map[string]string{
+		"Host": endpointURL.Host,
+	}
+
+	canonicalRequest := getCanonicalRequest(signedHeaderFields, unsignedPayload, presignQuery.Encode(), urlPath, method)
+	stringToSign := getStringToSign(canonicalRequest, requestTime, credential.GetScopeString())
+	signingKey := getSigningKey(secretKey, credential.RequestDate, credential.Region, credential.ServiceType)
+	presignQuery.Set("X-Amz-Signature", generateSignature(signingKey, stringToSign))
+
+	presignedURL := *endpointURL
+	presignedURL.Path = urlPath
+	presignedURL.RawQuery = strings.ReplaceAll(presignQuery.Encode(), "+", "%20")
+	return presignedURL.String(), nil
 }
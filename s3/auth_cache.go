@@ -0,0 +1,138 @@
+package s3
+
+import (
+	"sync"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// AuthCache caches derived SigV4 signing keys and unknown access keys
+// signing keys are cached per access key, so revoking an access key drops all its scopes at once
+type AuthCache struct {
+	signingKeys       *gocache.Cache
+	unknownAccessKeys *gocache.Cache
+	enabled           bool
+	negativeEnabled   bool
+	mutex             sync.Mutex
+}
+
+// NewAuthCache creates a new AuthCache, zero timeouts disable caching
+func NewAuthCache(timeout time.Duration, negativeTimeout time.Duration) *AuthCache {
+	cache := &AuthCache{}
+	cache.setTimeouts(timeout, negativeTimeout)
+	return cache
+}
+
+// SetTimeouts changes timeouts, cached entries are dropped
+func (cache *AuthCache) SetTimeouts(timeout time.Duration, negativeTimeout time.Duration) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.setTimeouts(timeout, negativeTimeout)
+}
+
+func (cache *AuthCache) setTimeouts(timeout time.Duration, negativeTimeout time.Duration) {
+	cache.enabled = timeout > 0
+	cache.negativeEnabled = negativeTimeout > 0
+	cache.signingKeys = nil
+	cache.unknownAccessKeys = nil
+
+	if cache.enabled {
+		cache.signingKeys = gocache.New(timeout, timeout)
+	}
+
+	if cache.negativeEnabled {
+		cache.unknownAccessKeys = gocache.New(negativeTimeout, negativeTimeout)
+	}
+}
+
+// getAccessKey returns a cache key of the access key, temporary access keys never share entries with usernames
+func getAccessKey(credential *AWSCredential) string {
+	if credential.Temporary {
+		return "sts:" + credential.AccessKey
+	}
+	return credential.AccessKey
+}
+
+// getScopeKey returns a cache key of the credential scope, (date, region, service)
+func getScopeKey(credential *AWSCredential) string {
+	return credential.RequestDate + "/" + credential.Region + "/" + credential.ServiceType
+}
+
+// GetSigningKey returns a cached signing key of the credential
+func (cache *AuthCache) GetSigningKey(credential *AWSCredential) ([]byte, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if !cache.enabled {
+		return nil, false
+	}
+
+	scopes, ok := cache.signingKeys.Get(getAccessKey(credential))
+	if !ok {
+		return nil, false
+	}
+
+	signingKey, ok := scopes.(map[string][]byte)[getScopeKey(credential)]
+	return signingKey, ok
+}
+
+// AddSigningKey caches a signing key of the credential
+func (cache *AuthCache) AddSigningKey(credential *AWSCredential, signingKey []byte) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if !cache.enabled {
+		return
+	}
+
+	if scopes, ok := cache.signingKeys.Get(getAccessKey(credential)); ok {
+		// expires with the access key entry
+		scopes.(map[string][]byte)[getScopeKey(credential)] = signingKey
+		return
+	}
+
+	cache.signingKeys.SetDefault(getAccessKey(credential), map[string][]byte{
+		getScopeKey(credential): signingKey,
+	})
+}
+
+// IsUnknownAccessKey checks if the access key was not found recently
+func (cache *AuthCache) IsUnknownAccessKey(accessKey string) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if !cache.negativeEnabled {
+		return false
+	}
+
+	_, ok := cache.unknownAccessKeys.Get(accessKey)
+	return ok
+}
+
+// AddUnknownAccessKey caches an access key not found
+func (cache *AuthCache) AddUnknownAccessKey(accessKey string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if !cache.negativeEnabled {
+		return
+	}
+
+	cache.unknownAccessKeys.SetDefault(accessKey, true)
+}
+
+// InvalidateAccessKey drops cached entries of the access key, called when the key is created or revoked
+func (cache *AuthCache) InvalidateAccessKey(accessKey string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.enabled {
+		cache.signingKeys.Delete(accessKey)
+	}
+
+	if cache.negativeEnabled {
+		cache.unknownAccessKeys.Delete(accessKey)
+	}
+}
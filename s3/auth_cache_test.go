@@ -0,0 +1,147 @@
+package s3
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestCredential(accessKey string, requestDate string, region string, temporary bool) *AWSCredential {
+	return &AWSCredential{
+		AccessKey:      accessKey,
+		Username:       accessKey,
+		RequestDate:    requestDate,
+		Region:         region,
+		ServiceType:    serviceTypeS3,
+		RequestVersion: requestVersion,
+		Temporary:      temporary,
+	}
+}
+
+func TestAuthCacheSigningKeys(t *testing.T) {
+	cache := NewAuthCache(time.Minute, time.Minute)
+
+	alice := newTestCredential("alice", "20240301", testRegion, false)
+	aliceOtherScope := newTestCredential("alice", "20240302", testRegion, false)
+	aliceOtherRegion := newTestCredential("alice", "20240301", "us-west-2", false)
+	aliceTemporary := newTestCredential("alice", "20240301", testRegion, true)
+	bob := newTestCredential("bob", "20240301", testRegion, false)
+
+	cache.AddSigningKey(alice, []byte("alice-key"))
+	cache.AddSigningKey(aliceOtherScope, []byte("alice-key-2"))
+
+	tests := []struct {
+		name       string
+		credential *AWSCredential
+		expected   string
+	}{
+		{"cached", alice, "alice-key"},
+		{"other scope of the same key", aliceOtherScope, "alice-key-2"},
+		{"other region", aliceOtherRegion, ""},
+		{"temporary key with the same name", aliceTemporary, ""},
+		{"other access key", bob, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signingKey, ok := cache.GetSigningKey(test.credential)
+			if ok != (len(test.expected) > 0) || string(signingKey) != test.expected {
+				t.Errorf("expected %q, got %q (found %t)", test.expected, signingKey, ok)
+			}
+		})
+	}
+
+	cache.AddSigningKey(aliceTemporary, []byte("sts-key"))
+	if signingKey, _ := cache.GetSigningKey(alice); string(signingKey) != "alice-key" {
+		t.Errorf("temporary key overwrote the long-term key, got %q", signingKey)
+	}
+
+	cache.InvalidateAccessKey("alice")
+	for _, credential := range []*AWSCredential{alice, aliceOtherScope} {
+		if _, ok := cache.GetSigningKey(credential); ok {
+			t.Errorf("signing key of scope %s is cached after invalidation", credential.GetScopeString())
+		}
+	}
+}
+
+func TestAuthCacheUnknownAccessKeys(t *testing.T) {
+	cache := NewAuthCache(time.Minute, time.Minute)
+
+	if cache.IsUnknownAccessKey("mallory") {
+		t.Errorf("access key is unknown before it is added")
+	}
+
+	cache.AddUnknownAccessKey("mallory")
+	if !cache.IsUnknownAccessKey("mallory") {
+		t.Errorf("access key is not cached as unknown")
+	}
+
+	if cache.IsUnknownAccessKey("alice") {
+		t.Errorf("other access key is cached as unknown")
+	}
+
+	// created access keys must be usable right away
+	cache.InvalidateAccessKey("mallory")
+	if cache.IsUnknownAccessKey("mallory") {
+		t.Errorf("access key is cached as unknown after invalidation")
+	}
+}
+
+func TestAuthCacheTimeouts(t *testing.T) {
+	credential := newTestCredential("alice", "20240301", testRegion, false)
+
+	tests := []struct {
+		name            string
+		timeout         time.Duration
+		negativeTimeout time.Duration
+		wait            time.Duration
+		signingKey      bool
+		unknown         bool
+	}{
+		{"enabled", time.Minute, time.Minute, 0, true, true},
+		{"disabled", 0, 0, 0, false, false},
+		{"negative disabled", time.Minute, 0, 0, true, false},
+		{"expired", 50 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, false, false},
+		{"negative expired", time.Minute, 50 * time.Millisecond, 100 * time.Millisecond, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewAuthCache(test.timeout, test.negativeTimeout)
+			cache.AddSigningKey(credential, []byte("alice-key"))
+			cache.AddUnknownAccessKey("mallory")
+
+			time.Sleep(test.wait)
+
+			if _, ok := cache.GetSigningKey(credential); ok != test.signingKey {
+				t.Errorf("expected signing key cached %t, got %t", test.signingKey, ok)
+			}
+
+			if ok := cache.IsUnknownAccessKey("mallory"); ok != test.unknown {
+				t.Errorf("expected unknown access key cached %t, got %t", test.unknown, ok)
+			}
+		})
+	}
+}
+
+func TestAuthCacheSetTimeouts(t *testing.T) {
+	credential := newTestCredential("alice", "20240301", testRegion, false)
+
+	cache := NewAuthCache(time.Minute, time.Minute)
+	cache.AddSigningKey(credential, []byte("alice-key"))
+	cache.AddUnknownAccessKey("mallory")
+
+	cache.SetTimeouts(time.Minute, time.Minute)
+	if _, ok := cache.GetSigningKey(credential); ok {
+		t.Errorf("signing key is cached after timeouts change")
+	}
+
+	if cache.IsUnknownAccessKey("mallory") {
+		t.Errorf("unknown access key is cached after timeouts change")
+	}
+
+	cache.SetTimeouts(0, 0)
+	cache.AddSigningKey(credential, []byte("alice-key"))
+	if _, ok := cache.GetSigningKey(credential); ok {
+		t.Errorf("signing key is cached while caching is disabled")
+	}
+}
@@ -0,0 +1,238 @@
+package s3
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	testAccessKey = "alice"
+	testSecretKey = "alice-secret"
+	testRegion    = "us-east-1"
+	testEndpoint  = "http://s3.example.com"
+)
+
+// getS3ErrorCode returns the S3 error code of the error, empty if it is not an S3 error
+func getS3ErrorCode(err error) string {
+	var s3Error *S3Error
+	if xerrors.As(err, &s3Error) {
+		return s3Error.Code
+	}
+	return ""
+}
+
+// newSignedRequest returns a request signed in the Authorization header
+// the Date header is used for the request time instead of X-Amz-Date if useDate is set
+func newSignedRequest(t *testing.T, requestTime time.Time, scopeDate string, useDate bool) *http.Request {
+	t.Helper()
+
+	request := httptest.NewRequest(http.MethodGet, testEndpoint+"/bucket/key?list-type=2", nil)
+	request.Header.Set("X-Amz-Content-SHA256", unsignedPayload)
+
+	dateHeader := "x-amz-date"
+	if useDate {
+		dateHeader = "date"
+		request.Header.Set("Date", requestTime.Format(http.TimeFormat))
+	} else {
+		request.Header.Set("X-Amz-Date", requestTime.Format(iso8601Format))
+	}
+
+	credential := AWSCredential{
+		RequestDate:    scopeDate,
+		Region:         testRegion,
+		ServiceType:    serviceTypeS3,
+		RequestVersion: requestVersion,
+	}
+
+	authorization := signV4Algorithm + " Credential=" + testAccessKey + "/" + credential.GetScopeString() + ", SignedHeaders=host;x-amz-content-sha256;" + dateHeader
+	request.Header.Set("Authorization", authorization+", Signature=")
+
+	canonicalRequest := getCanonicalRequest(getSignedHeaderFields(request), unsignedPayload, request.URL.Query().Encode(), request.URL.Path, request.Method)
+	stringToSign := getStringToSign(canonicalRequest, requestTime, credential.GetScopeString())
+	signingKey := getSigningKey(testSecretKey, credential.RequestDate, credential.Region, credential.ServiceType)
+
+	request.Header.Set("Authorization", authorization+", Signature="+generateSignature(signingKey, stringToSign))
+	return request
+}
+
+// newPresignedRequest returns a presigned request with the X-Amz-Date and X-Amz-Expires replaced
+// the signature is not valid anymore if they are replaced
+func newPresignedRequest(t *testing.T, requestTime time.Time, expires string) *http.Request {
+	t.Helper()
+
+	presignedURL, err := GetPresignedURL(testEndpoint, http.MethodGet, "bucket", "key", nil, testAccessKey, testSecretKey, testRegion, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to get presigned URL: %v", err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, presignedURL, nil)
+	if requestTime.IsZero() && len(expires) == 0 {
+		return request
+	}
+
+	query := request.URL.Query()
+	if !requestTime.IsZero() {
+		query.Set("X-Amz-Date", requestTime.Format(iso8601Format))
+		credential := getCredential(request)
+		credential.RequestDate = requestTime.Format(yyyymmdd)
+		query.Set("X-Amz-Credential", credential.AccessKey+"/"+credential.GetScopeString())
+	}
+	if len(expires) > 0 {
+		query.Set("X-Amz-Expires", expires)
+	}
+	request.URL.RawQuery = query.Encode()
+	return request
+}
+
+func TestGetRequestTime(t *testing.T) {
+	requestTime := time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		query    url.Values
+		headers  map[string]string
+		expected time.Time
+		fail     bool
+	}{
+		{"X-Amz-Date", nil, map[string]string{"X-Amz-Date": "20240301T123045Z"}, requestTime, false},
+		{"X-Amz-Date preferred", nil, map[string]string{"X-Amz-Date": "20240301T123045Z", "Date": "Sat, 02 Mar 2024 00:00:00 GMT"}, requestTime, false},
+		{"Date", nil, map[string]string{"Date": "Fri, 01 Mar 2024 12:30:45 GMT"}, requestTime, false},
+		{"Date with numeric zone", nil, map[string]string{"Date": "Fri, 01 Mar 2024 21:30:45 +0900"}, requestTime, false},
+		{"presigned", url.Values{"X-Amz-Algorithm": {signV4Algorithm}, "X-Amz-Date": {"20240301T123045Z"}}, nil, requestTime, false},
+		{"presigned ignores headers", url.Values{"X-Amz-Algorithm": {signV4Algorithm}}, map[string]string{"X-Amz-Date": "20240301T123045Z"}, time.Time{}, true},
+		{"malformed X-Amz-Date", nil, map[string]string{"X-Amz-Date": "2024-03-01T12:30:45Z"}, time.Time{}, true},
+		{"malformed Date", nil, map[string]string{"Date": "yesterday"}, time.Time{}, true},
+		{"missing", nil, nil, time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, testEndpoint+"/bucket?"+test.query.Encode(), nil)
+			for name, value := range test.headers {
+				request.Header.Set(name, value)
+			}
+
+			actual, err := getRequestTime(request)
+			if test.fail {
+				if err == nil {
+					t.Errorf("expected an error, got %v", actual)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to get request time: %v", err)
+			}
+
+			if !actual.Equal(test.expected) || actual.Location() != time.UTC {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCheckCredentialScope(t *testing.T) {
+	now := time.Now().UTC()
+	clockSkewMax := 15 * time.Minute
+	regions := []string{testRegion, "us-west-2"}
+
+	withCredential := func(modify func(credential *AWSCredential)) func(request *http.Request) *AWSCredential {
+		return func(request *http.Request) *AWSCredential {
+			credential := getCredential(request)
+			modify(credential)
+			return credential
+		}
+	}
+
+	tests := []struct {
+		name       string
+		request    *http.Request
+		credential func(request *http.Request) *AWSCredential
+		expected   string
+	}{
+		{"valid", newSignedRequest(t, now, now.Format(yyyymmdd), false), getCredential, ""},
+		{"valid with Date header", newSignedRequest(t, now, now.Format(yyyymmdd), true), getCredential, ""},
+		{"other accepted region", newSignedRequest(t, now, now.Format(yyyymmdd), false), withCredential(func(credential *AWSCredential) { credential.Region = "us-west-2" }), ""},
+		{"wrong terminal", newSignedRequest(t, now, now.Format(yyyymmdd), false), withCredential(func(credential *AWSCredential) { credential.RequestVersion = "aws5_request" }), ErrAuthorizationHeaderMalformed.Code},
+		{"wrong service", newSignedRequest(t, now, now.Format(yyyymmdd), false), withCredential(func(credential *AWSCredential) { credential.ServiceType = serviceTypeSTS }), ErrAuthorizationHeaderMalformed.Code},
+		{"wrong region", newSignedRequest(t, now, now.Format(yyyymmdd), false), withCredential(func(credential *AWSCredential) { credential.Region = "eu-west-1" }), ErrAuthorizationHeaderMalformed.Code},
+		{"scope date mismatch", newSignedRequest(t, now, now.Add(-48*time.Hour).Format(yyyymmdd), false), getCredential, ErrAuthorizationHeaderMalformed.Code},
+		{"scope date mismatch with Date header", newSignedRequest(t, now, now.Add(-48*time.Hour).Format(yyyymmdd), true), getCredential, ErrAuthorizationHeaderMalformed.Code},
+		{"skewed past", newSignedRequest(t, now.Add(-time.Hour), now.Add(-time.Hour).Format(yyyymmdd), false), getCredential, ErrRequestTimeTooSkewed.Code},
+		{"skewed future", newSignedRequest(t, now.Add(time.Hour), now.Add(time.Hour).Format(yyyymmdd), false), getCredential, ErrRequestTimeTooSkewed.Code},
+		{"skewed past with Date header", newSignedRequest(t, now.Add(-time.Hour), now.Add(-time.Hour).Format(yyyymmdd), true), getCredential, ErrRequestTimeTooSkewed.Code},
+		{"presigned", newPresignedRequest(t, time.Time{}, ""), getCredential, ""},
+		{"presigned signed long ago", newPresignedRequest(t, now.Add(-24*time.Hour), ""), getCredential, ""},
+		{"presigned skewed future", newPresignedRequest(t, now.Add(time.Hour), ""), getCredential, ErrRequestTimeTooSkewed.Code},
+		{"presigned wrong region", newPresignedRequest(t, time.Time{}, ""), withCredential(func(credential *AWSCredential) { credential.Region = "eu-west-1" }), ErrAuthorizationQueryParametersError.Code},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkCredentialScope(test.request, test.credential(test.request), serviceTypeS3, regions, clockSkewMax)
+			if getS3ErrorCode(err) != test.expected || (len(test.expected) == 0 && err != nil) {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestCheckSignature(t *testing.T) {
+	now := time.Now().UTC()
+	signingKey := getSigningKey(testSecretKey, now.Format(yyyymmdd), testRegion, serviceTypeS3)
+
+	tampered := newSignedRequest(t, now, now.Format(yyyymmdd), false)
+	tampered.URL.Path = "/bucket/other"
+
+	missingHash := newSignedRequest(t, now, now.Format(yyyymmdd), false)
+	missingHash.Header.Del("X-Amz-Content-SHA256")
+
+	tests := []struct {
+		name     string
+		request  *http.Request
+		expected bool
+		fail     bool
+	}{
+		{"header", newSignedRequest(t, now, now.Format(yyyymmdd), false), true, false},
+		{"header with Date header", newSignedRequest(t, now, now.Format(yyyymmdd), true), true, false},
+		{"header tampered", tampered, false, false},
+		{"header without content hash", missingHash, false, true},
+		{"presigned", newPresignedRequest(t, time.Time{}, ""), true, false},
+		{"presigned expired", newPresignedRequest(t, now.Add(-2*time.Hour), "3600"), false, true},
+		{"presigned zero expiry", newPresignedRequest(t, time.Time{}, "0"), false, true},
+		{"presigned expiry over max", newPresignedRequest(t, time.Time{}, strconv.FormatInt(int64(presignedExpiresMax.Seconds())+1, 10)), false, true},
+		{"presigned malformed expiry", newPresignedRequest(t, time.Time{}, "soon"), false, true},
+		{"presigned extended expiry", newPresignedRequest(t, time.Time{}, "7200"), false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			credential := getCredential(test.request)
+			if credential == nil {
+				t.Fatalf("failed to get credential")
+			}
+
+			ok, err := checkSignature(test.request, credential, signingKey)
+			if test.fail {
+				if err == nil {
+					t.Errorf("expected an error, got %t", ok)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to check signature: %v", err)
+			}
+
+			if ok != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package s3
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type bandwidthEntry struct {
+	bucket         *tokenBucket
+	lastAccessTime time.Time
+}
+
+// BandwidthLimiter limits byte rates of object streams per user and globally
+type BandwidthLimiter struct {
+	global     *tokenBucket
+	userRate   float64
+	userBurst  int
+	users      map[string]*bandwidthEntry
+	terminated bool
+	terminate  chan bool
+	mutex      sync.Mutex
+}
+
+// NewBandwidthLimiter creates a new BandwidthLimiter, rates are in bytes per second and zero disables the limit
+// bursts default to a second of the rate
+func NewBandwidthLimiter(globalRate int64, globalBurst int64, userRate int64, userBurst int64) *BandwidthLimiter {
+	limiter := &BandwidthLimiter{
+		users:      map[string]*bandwidthEntry{},
+		terminated: false,
+		terminate:  make(chan bool),
+	}
+
+	limiter.setLimits(globalRate, globalBurst, userRate, userBurst)
+
+	go limiter.cleanupIdleEntries()
+
+	return limiter
+}
+
+// IsEnabled checks if any limit is set
+func (limiter *BandwidthLimiter) IsEnabled() bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	return limiter.global != nil || limiter.userRate > 0
+}
+
+// SetLimits changes limits, applied to streams being throttled at once
+func (limiter *BandwidthLimiter) SetLimits(globalRate int64, globalBurst int64, userRate int64, userBurst int64) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	limiter.setLimits(globalRate, globalBurst, userRate, userBurst)
+}
+
+// setLimits sets limits, the caller must lock the limiter after it is created
+func (limiter *BandwidthLimiter) setLimits(globalRate int64, globalBurst int64, userRate int64, userBurst int64) {
+	if globalBurst <= 0 {
+		globalBurst = globalRate
+	}
+
+	switch {
+	case globalRate <= 0:
+		limiter.global = nil
+	case limiter.global == nil:
+		limiter.global = newTokenBucket(float64(globalRate), int(globalBurst))
+	default:
+		limiter.global.setLimits(float64(globalRate), int(globalBurst))
+	}
+
+	if userBurst <= 0 {
+		userBurst = userRate
+	}
+
+	limiter.userRate = float64(userRate)
+	limiter.userBurst = int(userBurst)
+
+	for username, entry := range limiter.users {
+		if userRate <= 0 {
+			delete(limiter.users, username)
+			continue
+		}
+
+		entry.bucket.setLimits(limiter.userRate, limiter.userBurst)
+	}
+}
+
+// Release stops the limiter
+func (limiter *BandwidthLimiter) Release() {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if !limiter.terminated {
+		limiter.terminated = true
+		close(limiter.terminate)
+	}
+}
+
+// reserve takes n bytes from the user and the global buckets and returns how long the stream must pause
+func (limiter *BandwidthLimiter) reserve(username string, n int) time.Duration {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	var wait time.Duration
+	if limiter.global != nil {
+		wait = limiter.global.reserve(float64(n))
+	}
+
+	if limiter.userRate > 0 {
+		entry, ok := limiter.users[username]
+		if !ok {
+			entry = &bandwidthEntry{
+				bucket: newTokenBucket(limiter.userRate, limiter.userBurst),
+			}
+			limiter.users[username] = entry
+		}
+
+		entry.lastAccessTime = time.Now()
+
+		if userWait := entry.bucket.reserve(float64(n)); userWait > wait {
+			wait = userWait
+		}
+	}
+
+	return wait
+}
+
+func (limiter *BandwidthLimiter) cleanupIdleEntries() {
+	ticker := time.NewTicker(rateLimitCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-limiter.terminate:
+			return
+		case <-ticker.C:
+			limiter.mutex.Lock()
+			for username, entry := range limiter.users {
+				if time.Since(entry.lastAccessTime) > rateLimitIdleTimeout {
+					delete(limiter.users, username)
+				}
+			}
+			limiter.mutex.Unlock()
+		}
+	}
+}
+
+// streamThrottle paces a single request stream
+// the user is resolved lazily since streams are read or written only after authentication
+type streamThrottle struct {
+	service  *S3Service
+	context  *gin.Context
+	resolved bool
+	exempt   bool
+	username string
+}
+
+func (throttle *streamThrottle) throttle(n int) {
+	if n <= 0 {
+		return
+	}
+
+	if !throttle.resolved {
+		credentialValue, ok := throttle.context.Get(credentialContextKey)
+		if !ok {
+			// not authenticated yet, e.g., hashing the payload for signature check
+			return
+		}
+
+		throttle.resolved = true
+		throttle.username = credentialValue.(*AWSCredential).Username
+		throttle.exempt = throttle.service.config.IsAdminUser(throttle.username)
+	}
+
+	if throttle.exempt {
+		return
+	}
+
+	wait := throttle.service.bandwidthLimiter.reserve(throttle.username, n)
+	if wait <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-throttle.context.Request.Context().Done():
+	}
+}
+
+type throttledReader struct {
+	reader   io.ReadCloser
+	throttle *streamThrottle
+}
+
+func (reader *throttledReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	reader.throttle.throttle(n)
+	return n, err
+}
+
+func (reader *throttledReader) Close() error {
+	return reader.reader.Close()
+}
+
+type throttledResponseWriter struct {
+	gin.ResponseWriter
+	throttle *streamThrottle
+}
+
+func (writer *throttledResponseWriter) Write(data []byte) (int, error) {
+	n, err := writer.ResponseWriter.Write(data)
+	writer.throttle.throttle(n)
+	return n, err
+}
+
+func (writer *throttledResponseWriter) WriteString(data string) (int, error) {
+	n, err := writer.ResponseWriter.WriteString(data)
+	writer.throttle.throttle(n)
+	return n, err
+}
+
+// bandwidthLimitMiddleware throttles object read and write streams
+func (service *S3Service) bandwidthLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !service.bandwidthLimiter.IsEnabled() {
+			c.Next()
+			return
+		}
+
+		switch getS3Operation(c.Request).Name {
+		case "GetObject", "PutObject", "UploadPart":
+		default:
+			c.Next()
+			return
+		}
+
+		throttle := &streamThrottle{
+			service: service,
+			context: c,
+		}
+
+		if c.Request.Body != nil {
+			c.Request.Body = &throttledReader{
+				reader:   c.Request.Body,
+				throttle: throttle,
+			}
+		}
+
+		c.Writer = &throttledResponseWriter{
+			ResponseWriter: c.Writer,
+			throttle:       throttle,
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,113 @@
+package s3
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cyverse/s3rods/commons"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testBandwidthLimit = 64 * 1024
+	testObjectSize     = 96 * 1024
+)
+
+func newTestBandwidthRouter(t *testing.T, username string) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	config := commons.NewDefaultConfig()
+	config.IrodsAdminUsername = "rods"
+
+	// a burst of a quarter second, the rest of the object waits for the rate
+	limiter := NewBandwidthLimiter(0, 0, testBandwidthLimit, testBandwidthLimit/4)
+	t.Cleanup(limiter.Release)
+
+	service := &S3Service{
+		config:           config,
+		bandwidthLimiter: limiter,
+	}
+
+	authenticate := func(c *gin.Context) {
+		c.Set(credentialContextKey, &AWSCredential{Username: username})
+	}
+
+	router := gin.New()
+	router.Use(service.bandwidthLimitMiddleware())
+	router.GET("/:bucket/*key", func(c *gin.Context) {
+		authenticate(c)
+		c.Data(http.StatusOK, defaultObjectContentType, make([]byte, testObjectSize))
+	})
+	router.PUT("/:bucket/*key", func(c *gin.Context) {
+		authenticate(c)
+		written, err := io.Copy(io.Discard, c.Request.Body)
+		if err != nil || written != testObjectSize {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	router.GET("/:bucket", func(c *gin.Context) {
+		authenticate(c)
+		c.Data(http.StatusOK, "application/xml", make([]byte, testObjectSize))
+	})
+
+	return router
+}
+
+func serveTimed(router *gin.Engine, method string, target string) (int, time.Duration) {
+	var body io.Reader
+	if method == http.MethodPut {
+		body = bytes.NewReader(make([]byte, testObjectSize))
+	}
+
+	request := httptest.NewRequest(method, target, body)
+	recorder := httptest.NewRecorder()
+
+	start := time.Now()
+	router.ServeHTTP(recorder, request)
+	return recorder.Code, time.Since(start)
+}
+
+func TestBandwidthLimitMiddleware(t *testing.T) {
+	// 96KB at 64KB/s with a 16KB burst takes 1.25s
+	throttled := time.Second
+
+	tests := []struct {
+		name      string
+		username  string
+		method    string
+		target    string
+		throttled bool
+	}{
+		{"GetObject", "alice", http.MethodGet, "/bucket/object", true},
+		{"PutObject", "alice", http.MethodPut, "/bucket/object", true},
+		{"admin GetObject", "rods", http.MethodGet, "/bucket/object", false},
+		{"ListObjects", "alice", http.MethodGet, "/bucket", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := newTestBandwidthRouter(t, test.username)
+
+			code, elapsed := serveTimed(router, test.method, test.target)
+			if code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", code)
+			}
+
+			if test.throttled && elapsed < throttled {
+				t.Errorf("expected the stream to be throttled, took %s", elapsed)
+			}
+
+			if !test.throttled && elapsed >= throttled {
+				t.Errorf("expected the stream not to be throttled, took %s", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/cyverse/s3rods/irods"
+	"github.com/cyverse/s3rods/s3/types"
+	"github.com/gin-gonic/gin"
+	gocache "github.com/patrickmn/go-cache"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// bucketLoggingSizeMax is the max size of a PutBucketLogging request body
+	bucketLoggingSizeMax = 64 * 1024
+	// bucketLoggingCacheTimeout is the time a logging configuration of a bucket is cached
+	bucketLoggingCacheTimeout = 1 * time.Minute
+	// bucketLogQueueSize is the number of records waiting for delivery, records are dropped when full
+	bucketLogQueueSize = 4096
+	// bucketLogObjectSizeMax is the size of buffered records that triggers writing a log object before the interval
+	bucketLogObjectSizeMax = 4 * 1024 * 1024
+
+	bucketLogObjectTimeFormat = "2006-01-02-15-04-05"
+)
+
+type bucketLogBuffer struct {
+	targetBucket string
+	targetPrefix string
+	data         bytes.Buffer
+}
+
+// BucketLogDelivery batches server access log records of buckets with logging enabled
+// and writes them into target buckets periodically
+type BucketLogDelivery struct {
+	irodsController *irods.IrodsController
+	flushInterval   time.Duration
+	configs         *gocache.Cache
+	records         chan *AccessLogRecord
+	buffers         map[string]*bucketLogBuffer
+	terminated      bool
+	terminate       chan bool
+	done            chan bool
+	mutex           sync.Mutex
+}
+
+// NewBucketLogDelivery creates a new BucketLogDelivery
+func NewBucketLogDelivery(irodsController *irods.IrodsController, flushInterval time.Duration) *BucketLogDelivery {
+	delivery := &BucketLogDelivery{
+		irodsController: irodsController,
+		flushInterval:   flushInterval,
+		configs:         gocache.New(bucketLoggingCacheTimeout, bucketLoggingCacheTimeout),
+		records:         make(chan *AccessLogRecord, bucketLogQueueSize),
+		buffers:         map[string]*bucketLogBuffer{},
+		terminated:      false,
+		terminate:       make(chan bool),
+		done:            make(chan bool),
+	}
+
+	go delivery.run()
+
+	return delivery
+}
+
+// Release stops the delivery after writing records buffered
+func (delivery *BucketLogDelivery) Release() {
+	delivery.mutex.Lock()
+	if delivery.terminated {
+		delivery.mutex.Unlock()
+		return
+	}
+
+	delivery.terminated = true
+	close(delivery.terminate)
+	delivery.mutex.Unlock()
+
+	<-delivery.done
+}
+
+// Add queues a record for delivery, never blocks
+func (delivery *BucketLogDelivery) Add(record *AccessLogRecord) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "BucketLogDelivery",
+		"function": "Add",
+	})
+
+	if len(record.Bucket) == 0 {
+		return
+	}
+
+	select {
+	case delivery.records <- record:
+	default:
+		logger.Warnf("dropped an access log record of bucket %s, delivery queue is full", record.Bucket)
+	}
+}
+
+// InvalidateBucket drops a cached logging configuration of the bucket
+func (delivery *BucketLogDelivery) InvalidateBucket(bucket string) {
+	delivery.configs.Delete(bucket)
+}
+
+func (delivery *BucketLogDelivery) run() {
+	ticker := time.NewTicker(delivery.flushInterval)
+	defer ticker.Stop()
+	defer close(delivery.done)
+
+	for {
+		select {
+		case record := <-delivery.records:
+			delivery.buffer(record)
+		case <-ticker.C:
+			delivery.flushAll()
+		case <-delivery.terminate:
+			// drain records queued
+			for {
+				select {
+				case record := <-delivery.records:
+					delivery.buffer(record)
+				default:
+					delivery.flushAll()
+					return
+				}
+			}
+		}
+	}
+}
+
+// getConfig returns a logging configuration of the bucket, nil if logging is disabled
+func (delivery *BucketLogDelivery) getConfig(bucket string) *irods.BucketLogging {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "BucketLogDelivery",
+		"function": "getConfig",
+	})
+
+	if logging, ok := delivery.configs.Get(bucket); ok {
+		return logging.(*irods.BucketLogging)
+	}
+
+	logging, err := delivery.irodsController.GetBucketLogging(context.Background(), bucket)
+	if err != nil {
+		if !irodsclient_types.IsFileNotFoundError(err) {
+			logger.Errorf("failed to get logging configuration of bucket %s: %+v", bucket, err)
+		}
+		logging = nil
+	}
+
+	delivery.configs.SetDefault(bucket, logging)
+	return logging
+}
+
+func (delivery *BucketLogDelivery) buffer(record *AccessLogRecord) {
+	logging := delivery.getConfig(record.Bucket)
+	if logging == nil {
+		return
+	}
+
+	// records of a source bucket are kept in its own log objects
+	bufferKey := record.Bucket + "\x00" + logging.TargetBucket + "\x00" + logging.TargetPrefix
+	buffer, ok := delivery.buffers[bufferKey]
+	if !ok {
+		buffer = &bucketLogBuffer{
+			targetBucket: logging.TargetBucket,
+			targetPrefix: logging.TargetPrefix,
+		}
+		delivery.buffers[bufferKey] = buffer
+	}
+
+	buffer.data.WriteString(record.String())
+	buffer.data.WriteString("\n")
+
+	if buffer.data.Len() >= bucketLogObjectSizeMax {
+		delivery.flush(buffer)
+		delete(delivery.buffers, bufferKey)
+	}
+}
+
+func (delivery *BucketLogDelivery) flushAll() {
+	for bufferKey, buffer := range delivery.buffers {
+		delivery.flush(buffer)
+		delete(delivery.buffers, bufferKey)
+	}
+}
+
+// flush writes a log object, records are dropped on failure so that a broken target can't grow the buffer
+func (delivery *BucketLogDelivery) flush(buffer *bucketLogBuffer) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "BucketLogDelivery",
+		"function": "flush",
+	})
+
+	if buffer.data.Len() == 0 {
+		return
+	}
+
+	key, err := makeBucketLogObjectKey(buffer.targetPrefix, time.Now())
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return
+	}
+
+	err = delivery.irodsController.PutBucketLogObject(context.Background(), buffer.targetBucket, key, buffer.data.Bytes())
+	if err != nil {
+		logger.Errorf("failed to write access logs of %d bytes to %s/%s: %+v", buffer.data.Len(), buffer.targetBucket, key, err)
+		return
+	}
+}
+
+// makeBucketLogObjectKey makes a log object key, TargetPrefixYYYY-mm-DD-HH-MM-SS-UniqueString
+func makeBucketLogObjectKey(prefix string, now time.Time) (string, error) {
+	uniqueBytes := make([]byte, 8)
+	_, err := rand.Read(uniqueBytes)
+	if err != nil {
+		return "", xerrors.Errorf("failed to generate a log object key: %w", err)
+	}
+
+	return prefix + now.UTC().Format(bucketLogObjectTimeFormat) + "-" + strings.ToUpper(hex.EncodeToString(uniqueBytes)), nil
+}
+
+func (service *S3Service) handleGetBucketLogging(c *gin.Context, credential *AWSCredential, operation S3Operation) {
+	logging, err := service.irodsController.GetBucketLogging(c.Request.Context(), operation.Bucket)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			service.writeError(c, ErrNoSuchBucket)
+			return
+		}
+		service.writeError(c, err)
+		return
+	}
+
+	output := types.NewBucketLoggingStatus("", "")
+	if logging != nil {
+		output = types.NewBucketLoggingStatus(logging.TargetBucket, logging.TargetPrefix)
+	}
+
+	service.setResponseHeader(c)
+	c.XML(http.StatusOK, output)
+}
+
+func (service *S3Service) handlePutBucketLogging(c *gin.Context, credential *AWSCredential, operation S3Operation) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handlePutBucketLogging",
+	})
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, bucketLoggingSizeMax+1))
+	if err != nil {
+		service.writeError(c, xerrors.Errorf("failed to read logging configuration: %w", err))
+		return
+	}
+
+	if len(body) > bucketLoggingSizeMax {
+		service.writeError(c, ErrMalformedXML)
+		return
+	}
+
+	input := types.BucketLoggingStatus{}
+	err = xml.Unmarshal(body, &input)
+	if err != nil {
+		logger.Debugf("%+v", err)
+		service.writeError(c, ErrMalformedXML)
+		return
+	}
+
+	if input.LoggingEnabled == nil {
+		err = service.irodsController.DeleteBucketLogging(c.Request.Context(), operation.Bucket)
+		if err != nil {
+			if irodsclient_types.IsFileNotFoundError(err) {
+				service.writeError(c, ErrNoSuchBucket)
+				return
+			}
+			service.writeError(c, err)
+			return
+		}
+
+		service.bucketLogDelivery.InvalidateBucket(operation.Bucket)
+		logger.Infof("disabled logging of bucket %s by %s", operation.Bucket, credential.Username)
+
+		service.setResponseHeader(c)
+		c.Status(http.StatusOK)
+		return
+	}
+
+	targetBucket := input.LoggingEnabled.TargetBucket
+	targetPrefix := input.LoggingEnabled.TargetPrefix
+	if len(targetBucket) == 0 || strings.Contains(targetBucket, "/") {
+		service.writeError(c, ErrInvalidTargetBucketForLogging)
+		return
+	}
+
+	if strings.HasPrefix(targetPrefix, "/") || strings.Contains("/"+targetPrefix, "/../") || strings.HasSuffix("/"+targetPrefix, "/..") {
+		service.writeError(c, ErrInvalidArgument.WithMessage("The target prefix for logging is invalid"))
+		return
+	}
+
+	// logs are written as the owner of the target bucket, only its owner can direct logs to it
+	owner, err := service.irodsController.IsBucketOwner(c.Request.Context(), credential.Username, targetBucket)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			service.writeError(c, ErrInvalidTargetBucketForLogging)
+			return
+		}
+		service.writeError(c, err)
+		return
+	}
+
+	if !owner && !service.config.IsAdminUser(credential.Username) {
+		service.writeError(c, ErrInvalidTargetBucketForLogging)
+		return
+	}
+
+	err = service.irodsController.SetBucketLogging(c.Request.Context(), operation.Bucket, &irods.BucketLogging{
+		TargetBucket: targetBucket,
+		TargetPrefix: targetPrefix,
+	})
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			service.writeError(c, ErrNoSuchBucket)
+			return
+		}
+		service.writeError(c, err)
+		return
+	}
+
+	service.bucketLogDelivery.InvalidateBucket(operation.Bucket)
+	logger.Infof("enabled logging of bucket %s into %s/%s by %s", operation.Bucket, targetBucket, targetPrefix, credential.Username)
+
+	service.setResponseHeader(c)
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,257 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/cyverse/s3rods/irods"
+	"github.com/cyverse/s3rods/s3/policy"
+	"github.com/cyverse/s3rods/s3/sts"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// bucketPolicySizeMax is the max size of a bucket policy document, same as AWS S3
+	bucketPolicySizeMax = 20 * 1024
+
+	policyDecisionContextKey = "s3rods.policy_decision"
+)
+
+// getPolicyConditionContext returns condition keys of the request for policy evaluation
+func (service *S3Service) getPolicyConditionContext(c *gin.Context, credential *AWSCredential) map[string][]string {
+	now := time.Now().UTC()
+
+	context := map[string][]string{
+		policy.ConditionKeySourceIP:        {c.ClientIP()},
+		policy.ConditionKeySecureTransport: {strconv.FormatBool(isSecureTransport(c))},
+		policy.ConditionKeyCurrentTime:     {now.Format(time.RFC3339)},
+		policy.ConditionKeyEpochTime:       {strconv.FormatInt(now.Unix(), 10)},
+		policy.ConditionKeyUsername:        {credential.Username},
+	}
+
+	if userAgent := c.Request.UserAgent(); len(userAgent) > 0 {
+		context[policy.ConditionKeyUserAgent] = []string{userAgent}
+	}
+
+	if referer := c.Request.Referer(); len(referer) > 0 {
+		context[policy.ConditionKeyReferer] = []string{referer}
+	}
+
+	query := c.Request.URL.Query()
+	queryConditionKeys := map[string]string{
+		"prefix":    policy.ConditionKeyPrefix,
+		"delimiter": policy.ConditionKeyDelimiter,
+		"max-keys":  policy.ConditionKeyMaxKeys,
+	}
+
+	for param, conditionKey := range queryConditionKeys {
+		if values, ok := query[param]; ok {
+			context[conditionKey] = values
+		}
+	}
+
+	return context
+}
+
+// authorizeRequest evaluates the bucket policy before the request reaches iRODS
+// an explicit deny rejects the request, an explicit allow is recorded in the context,
+// otherwise iRODS ACLs decide
+func (service *S3Service) authorizeRequest(c *gin.Context, credential *AWSCredential, operation S3Operation) (_ policy.Decision, returnErr error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "authorizeRequest",
+	})
+
+	ctx, span := tracer.Start(c.Request.Context(), "authorizeRequest")
+	defer func() { endSpan(span, returnErr) }()
+
+	if sessionValue, ok := c.Get(sessionContextKey); ok {
+		err := service.authorizeSessionRequest(c, credential, sessionValue.(*sts.Claims), operation)
+		if err != nil {
+			return policy.DecisionDeny, err
+		}
+	}
+
+	if len(operation.Bucket) == 0 {
+		return policy.DecisionNotApplicable, nil
+	}
+
+	if ticketValue, ok := c.Get(ticketContextKey); ok {
+		err := service.authorizeTicketRequest(c, ticketValue.(*irods.Ticket), operation)
+		if err != nil {
+			return policy.DecisionDeny, err
+		}
+	}
+
+	switch operation.Name {
+	case "GetBucketPolicy", "PutBucketPolicy", "DeleteBucketPolicy", "GetBucketLogging", "PutBucketLogging":
+		// the bucket owner can't be locked out by its own policy
+		owner, err := service.irodsController.IsBucketOwner(ctx, credential.Username, operation.Bucket)
+		if err != nil {
+			if irodsclient_types.IsFileNotFoundError(err) {
+				return policy.DecisionNotApplicable, ErrNoSuchBucket
+			}
+			return policy.DecisionNotApplicable, err
+		}
+
+		if owner {
+			return policy.DecisionAllow, nil
+		}
+	}
+
+	bucketPolicy, err := service.getBucketPolicy(ctx, operation.Bucket)
+	if err != nil {
+		return policy.DecisionNotApplicable, err
+	}
+
+	if bucketPolicy == nil {
+		return policy.DecisionNotApplicable, nil
+	}
+
+	policyRequest := &policy.Request{
+		Username: credential.Username,
+		Action:   operation.Action,
+		Resource: policy.GetResource(operation.Bucket, operation.Key),
+		Context:  service.getPolicyConditionContext(c, credential),
+	}
+
+	decision := bucketPolicy.Evaluate(policyRequest)
+	logger.Debugf("bucket policy decision for %s on %s by %s: %s", policyRequest.Action, policyRequest.Resource, policyRequest.Username, decision)
+
+	c.Set(policyDecisionContextKey, decision)
+
+	if decision == policy.DecisionDeny {
+		return decision, ErrAccessDenied
+	}
+
+	return decision, nil
+}
+
+// getBucketPolicy loads a bucket policy, returns nil if not set
+func (service *S3Service) getBucketPolicy(ctx context.Context, bucket string) (*policy.Policy, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "getBucketPolicy",
+	})
+
+	policyBytes, err := service.irodsController.GetBucketPolicy(ctx, bucket)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			return nil, ErrNoSuchBucket
+		}
+		return nil, err
+	}
+
+	if policyBytes == nil {
+		return nil, nil
+	}
+
+	bucketPolicy, err := policy.ParsePolicy(policyBytes)
+	if err != nil {
+		// stored policy is broken, fail closed
+		logger.Errorf("%+v", err)
+		return nil, xerrors.Errorf("failed to parse stored policy of bucket %s: %w", bucket, err)
+	}
+
+	return bucketPolicy, nil
+}
+
+func (service *S3Service) handleGetBucketPolicy(c *gin.Context, credential *AWSCredential, operation S3Operation) {
+	bucketPolicy, err := service.getBucketPolicy(c.Request.Context(), operation.Bucket)
+	if err != nil {
+		service.writeError(c, err)
+		return
+	}
+
+	if bucketPolicy == nil {
+		service.writeError(c, ErrNoSuchBucketPolicy)
+		return
+	}
+
+	policyBytes, err := bucketPolicy.JSON()
+	if err != nil {
+		service.writeError(c, err)
+		return
+	}
+
+	service.setResponseHeader(c)
+	c.Data(http.StatusOK, "application/json", policyBytes)
+}
+
+func (service *S3Service) handlePutBucketPolicy(c *gin.Context, credential *AWSCredential, operation S3Operation) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handlePutBucketPolicy",
+	})
+
+	policyBytes, err := io.ReadAll(io.LimitReader(c.Request.Body, bucketPolicySizeMax+1))
+	if err != nil {
+		service.writeError(c, xerrors.Errorf("failed to read policy: %w", err))
+		return
+	}
+
+	if len(policyBytes) > bucketPolicySizeMax {
+		service.writeError(c, ErrMalformedPolicy.WithMessage("Policy exceeds the maximum allowed document size"))
+		return
+	}
+
+	bucketPolicy, err := policy.ParseBucketPolicy(operation.Bucket, policyBytes)
+	if err != nil {
+		logger.Debugf("%+v", err)
+		service.writeError(c, ErrMalformedPolicy.WithMessage("%s", err.Error()))
+		return
+	}
+
+	compactPolicyBytes, err := bucketPolicy.JSON()
+	if err != nil {
+		service.writeError(c, err)
+		return
+	}
+
+	err = service.irodsController.SetBucketPolicy(c.Request.Context(), operation.Bucket, compactPolicyBytes)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			service.writeError(c, ErrNoSuchBucket)
+			return
+		}
+		service.writeError(c, err)
+		return
+	}
+
+	logger.Infof("set bucket policy of %s by %s", operation.Bucket, credential.Username)
+
+	service.setResponseHeader(c)
+	c.Status(http.StatusNoContent)
+}
+
+func (service *S3Service) handleDeleteBucketPolicy(c *gin.Context, credential *AWSCredential, operation S3Operation) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleDeleteBucketPolicy",
+	})
+
+	err := service.irodsController.DeleteBucketPolicy(c.Request.Context(), operation.Bucket)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			service.writeError(c, ErrNoSuchBucket)
+			return
+		}
+		service.writeError(c, err)
+		return
+	}
+
+	logger.Infof("deleted bucket policy of %s by %s", operation.Bucket, credential.Username)
+
+	service.setResponseHeader(c)
+	c.Status(http.StatusNoContent)
+}
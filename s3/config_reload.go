@@ -0,0 +1,118 @@
+package s3
+
+import (
+	"net/http"
+
+	"github.com/cyverse/s3rods/commons"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// ReloadConfig re-reads the config file and applies settings that can change live
+// settings requiring restart are logged and keep their current values
+func (service *S3Service) ReloadConfig() (*commons.ConfigChanges, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "ReloadConfig",
+	})
+
+	service.reloadMutex.Lock()
+	defer service.reloadMutex.Unlock()
+
+	configPath := service.config.ConfigFilePath
+	if len(configPath) == 0 {
+		// started without a config file, only certificates can be reloaded
+		logger.Info("No config file to reload, reloading TLS certificate only")
+		return &commons.ConfigChanges{}, service.ReloadCertificate()
+	}
+
+	updated, err := commons.LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	updated.Foreground = service.config.Foreground
+	updated.ChildProcess = service.config.ChildProcess
+	updated.ConfigFilePath = configPath
+
+	err = updated.Validate()
+	if err != nil {
+		return nil, xerrors.Errorf("invalid configuration in %s: %w", configPath, err)
+	}
+
+	changes := commons.GetConfigChanges(service.config, updated)
+
+	for _, field := range changes.RestartRequired {
+		logger.Warnf("%s is changed in %s, but requires restart, keeping the current value", field, configPath)
+	}
+
+	if service.certificateReloader != nil && updated.IsTlsEnabled() {
+		// files may be replaced under the same paths, so certificates are always reloaded
+		err = service.certificateReloader.ReloadFrom(updated.TlsCertPath, updated.TlsKeyPath)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to reload TLS certificate, keeping the current one: %w", err)
+		}
+
+		service.config.TlsCertPath = updated.TlsCertPath
+		service.config.TlsKeyPath = updated.TlsKeyPath
+	}
+
+	if changes.IsLive("debug") {
+		service.config.Debug = updated.Debug
+		if updated.Debug {
+			log.SetLevel(log.DebugLevel)
+		} else {
+			log.SetLevel(log.InfoLevel)
+		}
+	}
+
+	service.config.RateLimitPerUser = updated.RateLimitPerUser
+	service.config.RateLimitBurstPerUser = updated.RateLimitBurstPerUser
+	service.config.MaxConcurrentRequestsPerUser = updated.MaxConcurrentRequestsPerUser
+	service.userRateLimiter.SetLimits(updated.RateLimitPerUser, updated.RateLimitBurstPerUser, updated.MaxConcurrentRequestsPerUser)
+
+	service.config.RateLimitPerIP = updated.RateLimitPerIP
+	service.config.RateLimitBurstPerIP = updated.RateLimitBurstPerIP
+	service.config.MaxConcurrentRequestsPerIP = updated.MaxConcurrentRequestsPerIP
+	service.ipRateLimiter.SetLimits(updated.RateLimitPerIP, updated.RateLimitBurstPerIP, updated.MaxConcurrentRequestsPerIP)
+
+	service.config.BandwidthLimit = updated.BandwidthLimit
+	service.config.BandwidthBurst = updated.BandwidthBurst
+	service.config.BandwidthLimitPerUser = updated.BandwidthLimitPerUser
+	service.config.BandwidthBurstPerUser = updated.BandwidthBurstPerUser
+	service.bandwidthLimiter.SetLimits(updated.BandwidthLimit, updated.BandwidthBurst, updated.BandwidthLimitPerUser, updated.BandwidthBurstPerUser)
+
+	if changes.IsLive("auth_cache_timeout") || changes.IsLive("auth_negative_cache_timeout") {
+		// cached keys are dropped
+		service.config.AuthCacheTimeout = updated.AuthCacheTimeout
+		service.config.AuthNegativeCacheTimeout = updated.AuthNegativeCacheTimeout
+		service.authCache.SetTimeouts(updated.AuthCacheTimeout, updated.AuthNegativeCacheTimeout)
+	}
+
+	logger.Infof("Reloaded %s, applied %v, requires restart %v", configPath, changes.Live, changes.RestartRequired)
+	return changes, nil
+}
+
+// handleAdminReloadConfig reloads the config file like SIGHUP
+func (service *S3Service) handleAdminReloadConfig(c *gin.Context) {
+	changes, err := service.ReloadConfig()
+	if err != nil {
+		service.writeAdminError(c, ErrInvalidArgument.WithMessage(err.Error()))
+		return
+	}
+
+	type reloadOutput struct {
+		ConfigFilePath  string   `json:"config_file_path"`
+		Applied         []string `json:"applied"`
+		RestartRequired []string `json:"restart_required"`
+	}
+
+	service.setResponseHeader(c)
+	c.JSON(http.StatusOK, reloadOutput{
+		ConfigFilePath:  service.config.ConfigFilePath,
+		Applied:         changes.Live,
+		RestartRequired: changes.RestartRequired,
+	})
+}
@@ -0,0 +1,138 @@
+package s3
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtime_pprof "runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/cyverse/s3rods/commons"
+	"github.com/cyverse/s3rods/irods"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DiagnosticsPathPrefix is the path prefix of pprof and runtime diagnostics, served by admin listeners only
+	DiagnosticsPathPrefix = AdminPathPrefix + "/debug"
+)
+
+// DiagnosticsStats is a snapshot of runtime and pool usage
+type DiagnosticsStats struct {
+	ClientPool       irods.ClientPoolStats `json:"client_pool"`
+	InFlightRequests int                   `json:"in_flight_requests"`
+	Goroutines       int                   `json:"goroutines"`
+	HeapAllocBytes   uint64                `json:"heap_alloc_bytes"`
+	HeapObjects      uint64                `json:"heap_objects"`
+	SysBytes         uint64                `json:"sys_bytes"`
+	NumGC            uint32                `json:"num_gc"`
+}
+
+// InFlightRequestOutput is an in-flight request in diagnostics
+type InFlightRequestOutput struct {
+	RequestID     string    `json:"request_id"`
+	Operation     string    `json:"operation"`
+	Bucket        string    `json:"bucket,omitempty"`
+	Key           string    `json:"key,omitempty"`
+	Username      string    `json:"username,omitempty"`
+	RemoteIP      string    `json:"remote_ip"`
+	ContentLength int64     `json:"content_length"`
+	StartTime     time.Time `json:"start_time"`
+	Duration      string    `json:"duration"`
+	Upload        bool      `json:"upload"`
+}
+
+func isDiagnosticsPath(path string) bool {
+	return strings.HasPrefix(path, DiagnosticsPathPrefix+"/")
+}
+
+// setupDiagnosticsRouter setup diagnostics endpoints under the admin endpoints, sharing their authentication
+func (service *S3Service) setupDiagnosticsRouter(admin *gin.RouterGroup) {
+	debug := admin.Group("/debug")
+	debug.GET("/pprof/*profile", service.handleDiagnosticsPprof)
+	debug.POST("/pprof/*profile", service.handleDiagnosticsPprof)
+	debug.GET("/goroutines", service.handleDiagnosticsGoroutines)
+	debug.GET("/version", service.handleDiagnosticsVersion)
+	debug.GET("/stats", service.handleDiagnosticsStats)
+	debug.GET("/requests", service.handleDiagnosticsRequests)
+}
+
+// handleDiagnosticsPprof serves net/http/pprof, profiles are given by names, e.g., heap, goroutine
+func (service *S3Service) handleDiagnosticsPprof(c *gin.Context) {
+	profile := strings.Trim(c.Param("profile"), "/")
+
+	switch profile {
+	case "":
+		pprof.Index(c.Writer, c.Request)
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		if runtime_pprof.Lookup(profile) == nil {
+			service.writeAdminError(c, ErrInvalidArgument.WithMessage("unknown profile %s", profile))
+			return
+		}
+		pprof.Handler(profile).ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// handleDiagnosticsGoroutines dumps stacks of all goroutines in text
+func (service *S3Service) handleDiagnosticsGoroutines(c *gin.Context) {
+	service.setResponseHeader(c)
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+	runtime_pprof.Lookup("goroutine").WriteTo(c.Writer, 2)
+}
+
+func (service *S3Service) handleDiagnosticsVersion(c *gin.Context) {
+	service.setResponseHeader(c)
+	c.JSON(http.StatusOK, commons.GetVersion())
+}
+
+func (service *S3Service) handleDiagnosticsStats(c *gin.Context) {
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+
+	stats := DiagnosticsStats{
+		ClientPool:       service.irodsController.GetClientPoolStats(),
+		InFlightRequests: service.inFlightTracker.Count(),
+		Goroutines:       runtime.NumGoroutine(),
+		HeapAllocBytes:   memStats.HeapAlloc,
+		HeapObjects:      memStats.HeapObjects,
+		SysBytes:         memStats.Sys,
+		NumGC:            memStats.NumGC,
+	}
+
+	service.setResponseHeader(c)
+	c.JSON(http.StatusOK, stats)
+}
+
+// handleDiagnosticsRequests lists in-flight requests, oldest first
+func (service *S3Service) handleDiagnosticsRequests(c *gin.Context) {
+	requests := service.inFlightTracker.List()
+
+	outputs := make([]InFlightRequestOutput, 0, len(requests))
+	for _, request := range requests {
+		outputs = append(outputs, InFlightRequestOutput{
+			RequestID:     request.RequestID,
+			Operation:     request.Operation,
+			Bucket:        request.Bucket,
+			Key:           request.Key,
+			Username:      request.GetUsername(),
+			RemoteIP:      request.RemoteIP,
+			ContentLength: request.ContentLength,
+			StartTime:     request.StartTime,
+			Duration:      time.Since(request.StartTime).Round(time.Millisecond).String(),
+			Upload:        request.IsUpload(),
+		})
+	}
+
+	service.setResponseHeader(c)
+	c.JSON(http.StatusOK, outputs)
+}
@@ -0,0 +1,266 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cyverse/s3rods/irods"
+	"github.com/cyverse/s3rods/s3/types"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// S3Error is an error that is returned to S3 clients
+type S3Error struct {
+	Code           string
+	Message        string
+	HTTPStatusCode int
+}
+
+// Error returns error message
+func (err *S3Error) Error() string {
+	return fmt.Sprintf("%s: %s", err.Code, err.Message)
+}
+
+// WithMessage returns a copy of the error with a new message
+func (err *S3Error) WithMessage(format string, v ...interface{}) *S3Error {
+	return &S3Error{
+		Code:           err.Code,
+		Message:        fmt.Sprintf(format, v...),
+		HTTPStatusCode: err.HTTPStatusCode,
+	}
+}
+
+var (
+	ErrAccessDenied = &S3Error{
+		Code:           "AccessDenied",
+		Message:        "Access Denied",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	ErrInvalidAccessKeyID = &S3Error{
+		Code:           "InvalidAccessKeyId",
+		Message:        "The AWS access key Id you provided does not exist in our records.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	ErrSignatureDoesNotMatch = &S3Error{
+		Code:           "SignatureDoesNotMatch",
+		Message:        "The request signature we calculated does not match the signature you provided.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	ErrRequestTimeTooSkewed = &S3Error{
+		Code:           "RequestTimeTooSkewed",
+		Message:        "The difference between the request time and the server's time is too large.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	ErrAuthorizationHeaderMalformed = &S3Error{
+		Code:           "AuthorizationHeaderMalformed",
+		Message:        "The authorization header you provided is invalid.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrAuthorizationQueryParametersError = &S3Error{
+		Code:           "AuthorizationQueryParametersError",
+		Message:        "Error parsing the X-Amz-Credential parameter.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrMalformedPolicy = &S3Error{
+		Code:           "MalformedPolicy",
+		Message:        "Policies must be valid JSON and the first byte must be '{'",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrMalformedXML = &S3Error{
+		Code:           "MalformedXML",
+		Message:        "The XML you provided was not well-formed or did not validate against our published schema.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrInvalidTargetBucketForLogging = &S3Error{
+		Code:           "InvalidTargetBucketForLogging",
+		Message:        "The target bucket for logging does not exist, is not owned by you, or does not have the appropriate grants for the log-delivery group.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrNoSuchBucketPolicy = &S3Error{
+		Code:           "NoSuchBucketPolicy",
+		Message:        "The bucket policy does not exist",
+		HTTPStatusCode: http.StatusNotFound,
+	}
+	ErrNoSuchBucket = &S3Error{
+		Code:           "NoSuchBucket",
+		Message:        "The specified bucket does not exist",
+		HTTPStatusCode: http.StatusNotFound,
+	}
+	ErrNotImplemented = &S3Error{
+		Code:           "NotImplemented",
+		Message:        "A header or query you provided implies functionality that is not implemented",
+		HTTPStatusCode: http.StatusNotImplemented,
+	}
+	ErrInvalidToken = &S3Error{
+		Code:           "InvalidToken",
+		Message:        "The provided token is malformed or otherwise invalid.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrExpiredToken = &S3Error{
+		Code:           "ExpiredToken",
+		Message:        "The provided token has expired.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrInvalidParameterValue = &S3Error{
+		Code:           "InvalidParameterValue",
+		Message:        "An invalid or out-of-range value was supplied for the input parameter.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrMissingParameter = &S3Error{
+		Code:           "MissingParameter",
+		Message:        "A required parameter for the specified action is not supplied.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrInvalidAction = &S3Error{
+		Code:           "InvalidAction",
+		Message:        "The action or operation requested is invalid.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrMalformedPolicyDocument = &S3Error{
+		Code:           "MalformedPolicyDocument",
+		Message:        "The request was rejected because the policy document was malformed.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrPackedPolicyTooLarge = &S3Error{
+		Code:           "PackedPolicyTooLarge",
+		Message:        "The request was rejected because the total packed size of the session policies exceeds the limit.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrInvalidIdentityToken = &S3Error{
+		Code:           "InvalidIdentityToken",
+		Message:        "The web identity token that was passed could not be validated.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrExpiredWebIdentityToken = &S3Error{
+		Code:           "ExpiredTokenException",
+		Message:        "The web identity token that was passed is expired.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrIDPRejectedClaim = &S3Error{
+		Code:           "IDPRejectedClaim",
+		Message:        "The identity provider rejected the claim.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	ErrNoSuchKey = &S3Error{
+		Code:           "NoSuchKey",
+		Message:        "The specified key does not exist.",
+		HTTPStatusCode: http.StatusNotFound,
+	}
+	ErrInvalidArgument = &S3Error{
+		Code:           "InvalidArgument",
+		Message:        "Invalid Argument",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrMissingContentLength = &S3Error{
+		Code:           "MissingContentLength",
+		Message:        "You must provide the Content-Length HTTP header.",
+		HTTPStatusCode: http.StatusLengthRequired,
+	}
+	ErrBadDigest = &S3Error{
+		Code:           "BadDigest",
+		Message:        "The Content-MD5 you specified did not match what we received.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrXAmzContentSHA256Mismatch = &S3Error{
+		Code:           "XAmzContentSHA256Mismatch",
+		Message:        "The provided 'x-amz-content-sha256' header does not match what was computed.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrInvalidRequest = &S3Error{
+		Code:           "InvalidRequest",
+		Message:        "Invalid Request",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	ErrQuotaExceeded = &S3Error{
+		Code:           "QuotaExceeded",
+		Message:        "The write would exceed the storage quota.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	ErrSlowDown = &S3Error{
+		Code:           "SlowDown",
+		Message:        "Please reduce your request rate.",
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	}
+	ErrNoSuchEntity = &S3Error{
+		Code:           "NoSuchEntity",
+		Message:        "The specified access key does not exist.",
+		HTTPStatusCode: http.StatusNotFound,
+	}
+	ErrInternalError = &S3Error{
+		Code:           "InternalError",
+		Message:        "We encountered an internal error. Please try again.",
+		HTTPStatusCode: http.StatusInternalServerError,
+	}
+)
+
+// toAuthError converts an authentication failure into an S3 error
+func toAuthError(err error) error {
+	var s3Error *S3Error
+	if xerrors.As(err, &s3Error) {
+		return s3Error
+	}
+
+	return ErrAccessDenied.WithMessage("%s", err.Error())
+}
+
+// writeError writes an error response in S3 XML format
+func (service *S3Service) writeError(c *gin.Context, err error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "writeError",
+	})
+
+	var s3Error *S3Error
+	if !xerrors.As(err, &s3Error) {
+		if irods.IsQuotaExceededError(err) {
+			s3Error = ErrQuotaExceeded
+		} else {
+			logger.Errorf("%+v", err)
+			s3Error = ErrInternalError
+		}
+	}
+
+	c.Set(errorCodeContextKey, s3Error.Code)
+	service.setResponseHeader(c)
+	requestID := c.Writer.Header().Get("X-Amz-Request-Id")
+
+	output := types.NewErrorResponse(s3Error.Code, s3Error.Message, c.Request.URL.Path, requestID)
+	c.XML(s3Error.HTTPStatusCode, output)
+}
+
+// writeSTSError writes an error response in STS XML format
+func (service *S3Service) writeSTSError(c *gin.Context, err error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "writeSTSError",
+	})
+
+	var s3Error *S3Error
+	if !xerrors.As(err, &s3Error) {
+		logger.Errorf("%+v", err)
+		s3Error = ErrInternalError
+	}
+
+	errorType := "Sender"
+	if s3Error.HTTPStatusCode >= http.StatusInternalServerError {
+		errorType = "Receiver"
+	}
+
+	c.Set(errorCodeContextKey, s3Error.Code)
+	service.setResponseHeader(c)
+	requestID := c.Writer.Header().Get("X-Amz-Request-Id")
+
+	output := types.STSErrorResponse{
+		Error: types.STSError{
+			Type:    errorType,
+			Code:    s3Error.Code,
+			Message: s3Error.Message,
+		},
+		RequestID: requestID,
+	}
+	c.XML(s3Error.HTTPStatusCode, output)
+}
@@ -1,8 +1,13 @@
 package s3
 
 import (
+	"context"
 	"net/http"
 
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	"github.com/cyverse/s3rods/irods"
+	"github.com/cyverse/s3rods/s3/policy"
+	"github.com/cyverse/s3rods/s3/sts"
 	"github.com/cyverse/s3rods/s3/types"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/xid"
@@ -12,8 +17,33 @@ import (
 
 // setupRouter setup http request router
 func (service *S3Service) setupRouter() {
+	service.router.Use(service.forwardedMiddleware())
+	service.router.Use(service.listenerRoleMiddleware())
+	service.router.Use(service.tracingMiddleware())
+	service.router.Use(service.inFlightMiddleware())
+	service.router.Use(service.metricsMiddleware())
+	service.router.Use(service.accessLogMiddleware())
+	service.router.Use(service.rateLimitMiddleware())
+	service.router.Use(service.bandwidthLimitMiddleware())
+
 	service.router.GET("/ping", service.handlePing)
 	service.router.GET("/", service.handleRoot)
+	service.router.POST("/", service.handleSTS)
+	service.router.GET("/:bucket", service.handleBucket)
+	service.router.PUT("/:bucket", service.handleBucket)
+	service.router.DELETE("/:bucket", service.handleBucket)
+	service.router.GET("/:bucket/*key", service.handleObject)
+	service.router.HEAD("/:bucket/*key", service.handleObject)
+	service.router.PUT("/:bucket/*key", service.handleObject)
+	service.router.POST("/:bucket/*key", service.handleObject)
+	service.router.DELETE("/:bucket/*key", service.handleObject)
+
+	service.setupAdminRouter()
+	service.setupHealthRouter()
+
+	if len(service.config.MetricsPath) > 0 {
+		service.router.GET(service.config.MetricsPath, gin.WrapH(service.metrics.GetHandler()))
+	}
 }
 
 func (service *S3Service) handlePing(c *gin.Context) {
@@ -23,7 +53,7 @@ func (service *S3Service) handlePing(c *gin.Context) {
 		"function": "handlePing",
 	})
 
-	logger.Infof("access request to %s", c.Request.URL)
+	logger.Infof("access request to %s", getRedactedRequestURI(c.Request.URL))
 
 	type pingOutput struct {
 		Message string `json:"message"`
@@ -38,38 +68,141 @@ func (service *S3Service) handlePing(c *gin.Context) {
 func (service *S3Service) setResponseHeader(c *gin.Context) {
 	header := c.Writer.Header()
 	header.Set("Server", "S3Rods")
-	header.Set("X-Amz-Request-Id", xid.New().String()) // new iD
+	if len(header.Get("X-Amz-Request-Id")) == 0 {
+		header.Set("X-Amz-Request-Id", xid.New().String()) // new iD
+	}
 	header.Set("X-Content-Type-Options", "nosniff")
 	header.Set("X-Xss-Protection", "1; mode=block")
 }
 
-func (service *S3Service) authenticateUser(c *gin.Context) (*AWSCredential, error) {
+func (service *S3Service) authenticateUser(c *gin.Context, serviceType string) (_ *AWSCredential, returnErr error) {
 	logger := log.WithFields(log.Fields{
 		"package":  "s3",
 		"struct":   "S3Service",
 		"function": "authenticateUser",
 	})
 
+	ctx, span := tracer.Start(c.Request.Context(), "authenticateUser")
+	defer func() {
+		if returnErr != nil && returnErr != ErrSlowDown {
+			service.metrics.AddAuthFailure(returnErr)
+		}
+		endSpan(span, returnErr)
+	}()
+
 	credential := getCredential(c.Request)
 	if credential == nil {
 		return nil, xerrors.Errorf("failed to get credential from request")
 	}
 
-	secretKey, err := service.irodsController.GetUserSecretKey(credential.Username)
+	err := checkCredentialScope(c.Request, credential, serviceType, service.config.Regions, service.config.ClockSkewMax)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionClaims *sts.Claims
+	if credential.Temporary {
+		if !sts.IsTemporaryAccessKeyID(credential.AccessKey) {
+			return nil, ErrInvalidAccessKeyID
+		}
+
+		claims, err := service.verifySessionToken(c, credential)
+		if err != nil {
+			return nil, err
+		}
+
+		credential.Username = claims.Username
+		sessionClaims = claims
+	}
+
+	signingKey, err := service.getCredentialSigningKey(ctx, credential)
 	if err != nil {
 		return nil, err
 	}
 
 	// auth
-	checked, err := checkSignature(c.Request, secretKey)
+	checked, err := checkSignature(c.Request, credential, signingKey)
 	if err != nil {
 		return nil, err
 	}
 
 	logger.Infof("authenticateUser %s result: %t", credential.Username, checked)
+	if !checked {
+		return nil, ErrSignatureDoesNotMatch
+	}
+
+	if sessionClaims != nil {
+		c.Set(sessionContextKey, sessionClaims)
+	}
+
+	if len(credential.Ticket) > 0 {
+		ticket, err := service.irodsController.CheckTicket(ctx, credential.Ticket, c.ClientIP())
+		if err != nil {
+			return nil, xerrors.Errorf("failed to use ticket: %w", err)
+		}
+
+		c.Set(ticketContextKey, ticket)
+	}
+
+	if len(credential.Ticket) == 0 {
+		disabled, err := service.irodsController.IsUserS3Disabled(ctx, credential.Username)
+		if err != nil {
+			return nil, err
+		}
+
+		if disabled {
+			return nil, ErrAccessDenied.WithMessage("S3 access of user %s is disabled", credential.Username)
+		}
+	}
+
+	err = service.acquireUserRateLimit(c, credential)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set(credentialContextKey, credential)
+
+	if request := getInFlightRequest(c); request != nil {
+		request.SetUsername(credential.Username)
+	}
+
 	return credential, nil
 }
 
+// getCredentialSigningKey returns a signing key of the credential, derived keys are cached
+func (service *S3Service) getCredentialSigningKey(ctx context.Context, credential *AWSCredential) ([]byte, error) {
+	if signingKey, ok := service.authCache.GetSigningKey(credential); ok {
+		return signingKey, nil
+	}
+
+	var secretKey string
+	if len(credential.Ticket) > 0 {
+		// the ticket is sent in the access key, the secret key is only known to servers and the ticket creator
+		secretKey = service.irodsController.GetTicketSecretKey(credential.Ticket)
+	} else if credential.Temporary {
+		secretKey = service.stsIssuer.GetSecretAccessKey(credential.AccessKey)
+	} else {
+		if service.authCache.IsUnknownAccessKey(credential.AccessKey) {
+			return nil, ErrInvalidAccessKeyID
+		}
+
+		userSecretKey, err := service.irodsController.GetUserSecretKey(ctx, credential.Username)
+		if err != nil {
+			if xerrors.Is(err, irods.ErrAccessKeyNotFound) {
+				service.authCache.AddUnknownAccessKey(credential.AccessKey)
+				return nil, ErrInvalidAccessKeyID
+			}
+			return nil, err
+		}
+		secretKey = userSecretKey
+	}
+
+	signingKey := getSigningKey(secretKey, credential.RequestDate, credential.Region, credential.ServiceType)
+	service.authCache.AddSigningKey(credential, signingKey)
+
+	return signingKey, nil
+}
+
 func (service *S3Service) handleRoot(c *gin.Context) {
 	logger := log.WithFields(log.Fields{
 		"package":  "s3",
@@ -77,17 +210,37 @@ func (service *S3Service) handleRoot(c *gin.Context) {
 		"function": "handleRoot",
 	})
 
-	logger.Infof("access request to %s", c.Request.URL)
+	logger.Infof("access request to %s", getRedactedRequestURI(c.Request.URL))
 
-	credential, err := service.authenticateUser(c)
+	if len(c.Query("Action")) > 0 {
+		// STS requests can be sent via GET
+		service.handleSTS(c)
+		return
+	}
+
+	credential, err := service.authenticateUser(c, serviceTypeS3)
 	if err != nil {
-		c.XML(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		service.writeError(c, toAuthError(err))
 		return
 	}
 
-	rootDirStats, err := service.irodsController.ListRootDirStats(credential.Username)
+	operation := getS3Operation(c.Request)
+
+	_, err = service.authorizeRequest(c, credential, operation)
 	if err != nil {
-		c.XML(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		service.writeError(c, err)
+		return
+	}
+
+	var rootDirStats []*irodsclient_fs.Entry
+	if len(credential.Ticket) > 0 {
+		rootDirStats, err = service.irodsController.ListTicketRootDirStats(c.Request.Context(), credential.Ticket)
+	} else {
+		rootDirStats, err = service.irodsController.ListRootDirStats(c.Request.Context(), credential.Username)
+	}
+
+	if err != nil {
+		service.writeError(c, err)
 		return
 	}
 
@@ -108,3 +261,92 @@ func (service *S3Service) handleRoot(c *gin.Context) {
 	}
 	c.XML(http.StatusOK, output)
 }
+
+func (service *S3Service) handleBucket(c *gin.Context) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleBucket",
+	})
+
+	logger.Infof("access request to %s", getRedactedRequestURI(c.Request.URL))
+
+	credential, err := service.authenticateUser(c, serviceTypeS3)
+	if err != nil {
+		service.writeError(c, toAuthError(err))
+		return
+	}
+
+	operation := getS3Operation(c.Request)
+
+	decision, err := service.authorizeRequest(c, credential, operation)
+	if err != nil {
+		service.writeError(c, err)
+		return
+	}
+
+	switch operation.Name {
+	case "GetBucketPolicy", "PutBucketPolicy", "DeleteBucketPolicy", "GetBucketLogging", "PutBucketLogging":
+		// bucket configurations are accessed as the admin user, iRODS ACLs can't decide
+		if decision != policy.DecisionAllow {
+			service.writeError(c, ErrAccessDenied)
+			return
+		}
+	}
+
+	switch operation.Name {
+	case "GetBucketPolicy":
+		service.handleGetBucketPolicy(c, credential, operation)
+	case "PutBucketPolicy":
+		service.handlePutBucketPolicy(c, credential, operation)
+	case "DeleteBucketPolicy":
+		service.handleDeleteBucketPolicy(c, credential, operation)
+	case "GetBucketLogging":
+		service.handleGetBucketLogging(c, credential, operation)
+	case "PutBucketLogging":
+		service.handlePutBucketLogging(c, credential, operation)
+	default:
+		service.writeError(c, ErrNotImplemented)
+	}
+}
+
+func (service *S3Service) handleObject(c *gin.Context) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleObject",
+	})
+
+	logger.Infof("access request to %s", getRedactedRequestURI(c.Request.URL))
+
+	credential, err := service.authenticateUser(c, serviceTypeS3)
+	if err != nil {
+		service.writeError(c, toAuthError(err))
+		return
+	}
+
+	operation := getS3Operation(c.Request)
+
+	_, err = service.authorizeRequest(c, credential, operation)
+	if err != nil {
+		service.writeError(c, err)
+		return
+	}
+
+	err = service.checkQuota(c, credential, operation)
+	if err != nil {
+		service.writeError(c, err)
+		return
+	}
+
+	switch operation.Name {
+	case "GetObject":
+		service.handleGetObject(c, credential, operation)
+	case "HeadObject":
+		service.handleHeadObject(c, credential, operation)
+	case "PutObject":
+		service.handlePutObject(c, credential, operation)
+	default:
+		service.writeError(c, ErrNotImplemented)
+	}
+}
@@ -0,0 +1,199 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyverse/s3rods/commons"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// HealthPathPrefix is the path prefix of health endpoints for load balancers, never a valid bucket name
+	HealthPathPrefix = commons.ReservedPathPrefix + "health"
+
+	healthStatusOK   = "ok"
+	healthStatusFail = "fail"
+)
+
+// HealthCheckResult is a result of a readiness check
+type HealthCheckResult struct {
+	Status   string                 `json:"status"`
+	Error    string                 `json:"error,omitempty"`
+	Duration string                 `json:"duration"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+}
+
+// HealthOutput is a response of health endpoints
+type HealthOutput struct {
+	Status string                        `json:"status"`
+	Checks map[string]*HealthCheckResult `json:"checks,omitempty"`
+}
+
+// healthCheck returns details to report, an error fails the check
+type healthCheck func(ctx context.Context) (map[string]interface{}, error)
+
+func isHealthPath(path string) bool {
+	return strings.HasPrefix(path, HealthPathPrefix+"/")
+}
+
+// setupHealthRouter setup health endpoints, no authentication is required
+func (service *S3Service) setupHealthRouter() {
+	health := service.router.Group(HealthPathPrefix)
+	health.GET("/live", service.handleHealthLive)
+	health.GET("/ready", service.handleHealthReady)
+}
+
+// handleHealthLive reports the process is serving requests, it never checks dependencies
+func (service *S3Service) handleHealthLive(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthOutput{
+		Status: healthStatusOK,
+	})
+}
+
+// handleHealthReady runs readiness checks, responds 503 if any fails
+func (service *S3Service) handleHealthReady(c *gin.Context) {
+	output := service.checkReadiness(c.Request.Context())
+
+	status := http.StatusOK
+	if output.Status != healthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.JSON(status, output)
+}
+
+// checkReadiness runs readiness checks concurrently, fails if any fails
+func (service *S3Service) checkReadiness(ctx context.Context) *HealthOutput {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "checkReadiness",
+	})
+
+	checks := map[string]healthCheck{
+		"irods":    service.checkIrodsHealth,
+		"keystore": service.checkKeyStoreHealth,
+		"disk":     service.checkDiskHealth,
+	}
+
+	output := &HealthOutput{
+		Status: healthStatusOK,
+		Checks: map[string]*HealthCheckResult{},
+	}
+
+	wg := sync.WaitGroup{}
+	mutex := sync.Mutex{}
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check healthCheck) {
+			defer wg.Done()
+
+			result := service.runHealthCheck(ctx, check)
+
+			mutex.Lock()
+			output.Checks[name] = result
+			mutex.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	for name, result := range output.Checks {
+		if result.Status != healthStatusOK {
+			logger.Warnf("readiness check %s failed: %s", name, result.Error)
+			output.Status = healthStatusFail
+		}
+	}
+
+	return output
+}
+
+// runHealthCheck runs a check with the timeout, a check still running is abandoned and fails
+func (service *S3Service) runHealthCheck(ctx context.Context, check healthCheck) *HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, service.config.HealthCheckTimeout)
+	defer cancel()
+
+	type checkOutput struct {
+		details map[string]interface{}
+		err     error
+	}
+
+	startTime := time.Now()
+	done := make(chan checkOutput, 1)
+	go func() {
+		details, err := check(ctx)
+		done <- checkOutput{
+			details: details,
+			err:     err,
+		}
+	}()
+
+	result := &HealthCheckResult{
+		Status: healthStatusOK,
+	}
+
+	select {
+	case output := <-done:
+		result.Details = output.details
+		if output.err != nil {
+			result.Status = healthStatusFail
+			result.Error = output.err.Error()
+		}
+	case <-ctx.Done():
+		result.Status = healthStatusFail
+		result.Error = xerrors.Errorf("timed out after %s", service.config.HealthCheckTimeout).Error()
+	}
+
+	result.Duration = time.Since(startTime).String()
+	return result
+}
+
+func (service *S3Service) checkIrodsHealth(ctx context.Context) (map[string]interface{}, error) {
+	details := map[string]interface{}{
+		"host": service.config.IrodsHost,
+		"port": service.config.IrodsPort,
+		"zone": service.config.IrodsZone,
+	}
+
+	return details, service.irodsController.CheckConnection(ctx)
+}
+
+// checkKeyStoreHealth checks the secret key store and the STS signing key that other instances share
+func (service *S3Service) checkKeyStoreHealth(ctx context.Context) (map[string]interface{}, error) {
+	stsKeyPath := service.config.GetStsKeyPath()
+	keyHex, err := os.ReadFile(stsKeyPath)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read STS signing key %s: %w", stsKeyPath, err)
+	}
+
+	if len(strings.TrimSpace(string(keyHex))) == 0 {
+		return nil, xerrors.Errorf("STS signing key %s is empty", stsKeyPath)
+	}
+
+	return nil, service.irodsController.CheckKeyStore(ctx)
+}
+
+func (service *S3Service) checkDiskHealth(ctx context.Context) (map[string]interface{}, error) {
+	usage, err := commons.GetDiskUsage(service.config.DataRootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{
+		"path":        service.config.DataRootPath,
+		"free_bytes":  usage.FreeBytes,
+		"total_bytes": usage.TotalBytes,
+	}
+
+	if usage.FreeBytes < uint64(service.config.HealthDiskFreeMin) {
+		return details, xerrors.Errorf("%d bytes free in %s, requires %d bytes", usage.FreeBytes, service.config.DataRootPath, service.config.HealthDiskFreeMin)
+	}
+
+	return details, nil
+}
@@ -0,0 +1,165 @@
+package s3
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// inFlightContextKey is a gin context key of the InFlightRequest of the request
+	inFlightContextKey = "s3rods.in_flight"
+
+	// inFlightCheckInterval is the interval of checking if in-flight requests are done
+	inFlightCheckInterval = 100 * time.Millisecond
+	// inFlightCleanupTimeout is the time given to requests cut off on shutdown to clean up
+	inFlightCleanupTimeout = 5 * time.Second
+)
+
+// InFlightRequest is a request being served
+type InFlightRequest struct {
+	RequestID     string
+	Operation     string
+	Bucket        string
+	Key           string
+	RemoteIP      string
+	ContentLength int64
+	StartTime     time.Time
+
+	username string
+	mutex    sync.Mutex
+}
+
+// SetUsername sets the user once the request is authenticated
+func (request *InFlightRequest) SetUsername(username string) {
+	request.mutex.Lock()
+	defer request.mutex.Unlock()
+
+	request.username = username
+}
+
+// GetUsername returns the user, empty if not authenticated yet
+func (request *InFlightRequest) GetUsername() string {
+	request.mutex.Lock()
+	defer request.mutex.Unlock()
+
+	return request.username
+}
+
+// IsUpload checks if the request writes object data that is left partial when cut off
+func (request *InFlightRequest) IsUpload() bool {
+	switch request.Operation {
+	case "PutObject", "UploadPart", "UploadPartCopy", "CopyObject", "CompleteMultipartUpload":
+		return true
+	}
+	return false
+}
+
+// InFlightTracker tracks requests being served
+type InFlightTracker struct {
+	requests map[*InFlightRequest]bool
+	mutex    sync.Mutex
+}
+
+// NewInFlightTracker creates a new InFlightTracker
+func NewInFlightTracker() *InFlightTracker {
+	return &InFlightTracker{
+		requests: map[*InFlightRequest]bool{},
+	}
+}
+
+// Add adds a request
+func (tracker *InFlightTracker) Add(request *InFlightRequest) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.requests[request] = true
+}
+
+// Remove removes a request done
+func (tracker *InFlightTracker) Remove(request *InFlightRequest) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	delete(tracker.requests, request)
+}
+
+// Count returns the number of requests being served
+func (tracker *InFlightTracker) Count() int {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	return len(tracker.requests)
+}
+
+// List returns requests being served, oldest first
+func (tracker *InFlightTracker) List() []*InFlightRequest {
+	tracker.mutex.Lock()
+	requests := make([]*InFlightRequest, 0, len(tracker.requests))
+	for request := range tracker.requests {
+		requests = append(requests, request)
+	}
+	tracker.mutex.Unlock()
+
+	sort.Slice(requests, func(i int, j int) bool {
+		return requests[i].StartTime.Before(requests[j].StartTime)
+	})
+
+	return requests
+}
+
+// Wait waits until all requests are done, returns false if ctx is done first
+func (tracker *InFlightTracker) Wait(ctx context.Context) bool {
+	ticker := time.NewTicker(inFlightCheckInterval)
+	defer ticker.Stop()
+
+	for tracker.Count() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+// getInFlightRequest returns the InFlightRequest of the request, nil if not tracked
+func getInFlightRequest(c *gin.Context) *InFlightRequest {
+	if requestValue, ok := c.Get(inFlightContextKey); ok {
+		return requestValue.(*InFlightRequest)
+	}
+	return nil
+}
+
+// inFlightMiddleware tracks requests so that shutdown can wait for them and report those cut off
+func (service *S3Service) inFlightMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// diagnostics would list themselves
+		if c.Request.URL.Path == service.config.MetricsPath || isHealthPath(c.Request.URL.Path) || isDiagnosticsPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		operation := getS3Operation(c.Request)
+		request := &InFlightRequest{
+			RequestID:     c.Writer.Header().Get("X-Amz-Request-Id"),
+			Operation:     getRequestOperationName(c),
+			Bucket:        operation.Bucket,
+			Key:           operation.Key,
+			RemoteIP:      c.ClientIP(),
+			ContentLength: c.Request.ContentLength,
+			StartTime:     time.Now(),
+		}
+
+		c.Set(inFlightContextKey, request)
+
+		service.inFlightTracker.Add(request)
+		defer service.inFlightTracker.Remove(request)
+
+		c.Next()
+	}
+}
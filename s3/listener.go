@@ -0,0 +1,198 @@
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/cyverse/s3rods/commons"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// listenerContextKey is a request context key of the ListenerConfig accepting the connection
+type listenerContextKey struct{}
+
+// serviceListener is a listener being served
+type serviceListener struct {
+	config   commons.ListenerConfig
+	listener net.Listener
+	server   *http.Server
+}
+
+// getListenerKey returns a key matching sockets passed by systemd, tcp:port or unix:path
+// tcp sockets are matched by ports as systemd may bind other forms of the same interface, e.g., [::]
+func getListenerKey(network string, address string) string {
+	if network == "unix" {
+		return fmt.Sprintf("unix:%s", address)
+	}
+
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Sprintf("tcp:%s", address)
+	}
+	return fmt.Sprintf("tcp:%s", port)
+}
+
+// listen returns the socket passed by systemd for the listener, or binds the address
+func listen(listenerConfig commons.ListenerConfig, systemdListeners map[string]net.Listener) (net.Listener, error) {
+	key := getListenerKey(listenerConfig.GetNetwork(), listenerConfig.GetAddress())
+	if listener, ok := systemdListeners[key]; ok {
+		delete(systemdListeners, key)
+		return listener, nil
+	}
+
+	if listenerConfig.IsUnixSocket() {
+		return listenUnixSocket(listenerConfig)
+	}
+
+	listener, err := net.Listen("tcp", listenerConfig.Address)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to listen on %s: %w", listenerConfig.Address, err)
+	}
+
+	return listener, nil
+}
+
+// listenUnixSocket binds the unix socket, a socket file left by a previous process is replaced
+func listenUnixSocket(listenerConfig commons.ListenerConfig) (net.Listener, error) {
+	socketPath := listenerConfig.UnixSocketPath
+
+	mode, err := listenerConfig.GetUnixSocketMode()
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := os.Lstat(socketPath)
+	if err == nil {
+		if fileInfo.Mode()&os.ModeSocket == 0 {
+			return nil, xerrors.Errorf("failed to listen on %s: not a socket file", socketPath)
+		}
+
+		// refuse to take over a socket still served
+		conn, dialErr := net.Dial("unix", socketPath)
+		if dialErr == nil {
+			conn.Close()
+			return nil, xerrors.Errorf("failed to listen on %s: another process is listening", socketPath)
+		}
+
+		err = os.Remove(socketPath)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to remove stale socket file %s: %w", socketPath, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+
+	err = os.Chmod(socketPath, mode)
+	if err != nil {
+		listener.Close()
+		return nil, xerrors.Errorf("failed to change mode of socket file %s to %o: %w", socketPath, mode, err)
+	}
+
+	return listener, nil
+}
+
+// newServiceListener creates a server of the router for the listener
+// requests are given contexts canceled on shutdown and the listener config
+func (service *S3Service) newServiceListener(listenerConfig commons.ListenerConfig, listener net.Listener) *serviceListener {
+	var tlsConfig *tls.Config
+	if listenerConfig.Tls {
+		tlsConfig = service.certificateReloader.GetTLSConfig()
+	}
+
+	server := &http.Server{
+		Handler:   service.router,
+		TLSConfig: tlsConfig,
+		BaseContext: func(listener net.Listener) context.Context {
+			return service.requestContext
+		},
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, listenerContextKey{}, &listenerConfig)
+		},
+	}
+
+	return &serviceListener{
+		config:   listenerConfig,
+		listener: listener,
+		server:   server,
+	}
+}
+
+// serve serves the listener in background
+func (serviceListener *serviceListener) serve() {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "serviceListener",
+		"function": "serve",
+	})
+
+	fmt.Printf("Starting S3 service at %s\n", serviceListener.config.String())
+	logger.Infof("Starting S3 service at %s", serviceListener.config.String())
+
+	go func() {
+		var err error
+		if serviceListener.config.Tls {
+			// the certificate is given by TLSConfig.GetCertificate
+			err = serviceListener.server.ServeTLS(serviceListener.listener, "", "")
+		} else {
+			err = serviceListener.server.Serve(serviceListener.listener)
+		}
+
+		// ErrServerClosed is returned on Stop, the process exits after cleaning up
+		if err != nil && !xerrors.Is(err, http.ErrServerClosed) {
+			logger.Fatal(err)
+		}
+	}()
+}
+
+// getListenerConfig returns the config of the listener accepting the request
+func getListenerConfig(c *gin.Context) *commons.ListenerConfig {
+	if listenerConfig, ok := c.Request.Context().Value(listenerContextKey{}).(*commons.ListenerConfig); ok {
+		return listenerConfig
+	}
+	return nil
+}
+
+// isAdminPath checks if the path is served by listeners of the admin role
+func (service *S3Service) isAdminPath(path string) bool {
+	if strings.HasPrefix(path, AdminPathPrefix+"/") {
+		return true
+	}
+
+	return len(service.config.MetricsPath) > 0 && path == service.config.MetricsPath
+}
+
+// listenerRoleMiddleware rejects requests to paths not served by the role of the listener
+func (service *S3Service) listenerRoleMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listenerConfig := getListenerConfig(c)
+		if listenerConfig == nil || isHealthPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		served := listenerConfig.IsS3Served()
+		if isDiagnosticsPath(c.Request.URL.Path) {
+			served = listenerConfig.IsDiagnosticsServed()
+		} else if service.isAdminPath(c.Request.URL.Path) {
+			served = listenerConfig.IsAdminServed()
+		}
+
+		if !served {
+			service.writeError(c, ErrAccessDenied.WithMessage("%s is not served on this listener", c.Request.URL.Path))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,212 @@
+package s3
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "s3rods"
+)
+
+// Metrics holds prometheus collectors of the service
+type Metrics struct {
+	registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestDurations *prometheus.HistogramVec
+	requestsInFlight prometheus.Gauge
+	bytesReceived    *prometheus.CounterVec
+	bytesSent        *prometheus.CounterVec
+	authFailures     *prometheus.CounterVec
+
+	// multipart uploads created but not yet completed or aborted since the service started
+	multipartUploads int64
+	mutex            sync.Mutex
+}
+
+// NewMetrics creates a new Metrics, pool stats are read from the iRODS controller at scrape time
+func NewMetrics(service *S3Service) *Metrics {
+	metrics := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Number of requests by S3 operation and HTTP status code.",
+		}, []string{"operation", "status"}),
+		requestDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Request latencies by S3 operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		requestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_in_flight",
+			Help:      "Number of requests being served.",
+		}),
+		bytesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "bytes_received_total",
+			Help:      "Bytes of request bodies received by S3 operation.",
+		}, []string{"operation"}),
+		bytesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "bytes_sent_total",
+			Help:      "Bytes of response bodies sent by S3 operation.",
+		}, []string{"operation"}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "auth_failures_total",
+			Help:      "Number of authentication failures by reason.",
+		}, []string{"reason"}),
+	}
+
+	metrics.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metrics.requests,
+		metrics.requestDurations,
+		metrics.requestsInFlight,
+		metrics.bytesReceived,
+		metrics.bytesSent,
+		metrics.authFailures,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "irods_pool_clients",
+			Help:      "Number of iRODS clients opened in the client pool.",
+		}, func() float64 {
+			return float64(service.irodsController.GetClientPoolStats().Clients)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "irods_pool_connections",
+			Help:      "Number of iRODS connections opened by clients in the client pool.",
+		}, func() float64 {
+			return float64(service.irodsController.GetClientPoolStats().Connections)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "multipart_uploads_in_flight",
+			Help:      "Number of multipart uploads created but not yet completed or aborted.",
+		}, func() float64 {
+			metrics.mutex.Lock()
+			defer metrics.mutex.Unlock()
+			return float64(metrics.multipartUploads)
+		}),
+	)
+
+	return metrics
+}
+
+// GetHandler returns an HTTP handler exposing the metrics
+func (metrics *Metrics) GetHandler() http.Handler {
+	return promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{})
+}
+
+// AddAuthFailure counts an authentication failure, the reason is the S3 error code returned
+func (metrics *Metrics) AddAuthFailure(err error) {
+	var reason string
+	if s3Error, ok := toAuthError(err).(*S3Error); ok {
+		reason = s3Error.Code
+	}
+
+	metrics.authFailures.WithLabelValues(reason).Inc()
+}
+
+// trackMultipartUpload follows multipart upload lifecycles by successful operations
+func (metrics *Metrics) trackMultipartUpload(operation string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	switch operation {
+	case "CreateMultipartUpload":
+		metrics.multipartUploads++
+	case "CompleteMultipartUpload", "AbortMultipartUpload":
+		// uploads created before the service started are not counted
+		if metrics.multipartUploads > 0 {
+			metrics.multipartUploads--
+		}
+	}
+}
+
+type countingReader struct {
+	reader io.ReadCloser
+	count  int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	reader.count += int64(n)
+	return n, err
+}
+
+func (reader *countingReader) Close() error {
+	return reader.reader.Close()
+}
+
+// getRequestOperationName returns an operation name of the request for metrics and traces
+func getRequestOperationName(c *gin.Context) string {
+	switch {
+	case c.Request.URL.Path == "/ping":
+		return "Ping"
+	case isHealthPath(c.Request.URL.Path):
+		return "Health"
+	case strings.HasPrefix(c.Request.URL.Path, AdminPathPrefix+"/"):
+		return "Admin"
+	case c.Request.URL.Path == "/" && (c.Request.Method == http.MethodPost || len(c.Query("Action")) > 0):
+		return "STS"
+	}
+
+	return getS3Operation(c.Request).Name
+}
+
+// metricsMiddleware records request counts, latencies and bytes transferred
+func (service *S3Service) metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.URL.Path == service.config.MetricsPath {
+			c.Next()
+			return
+		}
+
+		operation := getRequestOperationName(c)
+		startTime := time.Now()
+
+		service.metrics.requestsInFlight.Inc()
+		defer service.metrics.requestsInFlight.Dec()
+
+		var body *countingReader
+		if c.Request.Body != nil {
+			body = &countingReader{
+				reader: c.Request.Body,
+			}
+			c.Request.Body = body
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		service.metrics.requests.WithLabelValues(operation, strconv.Itoa(status)).Inc()
+		service.metrics.requestDurations.WithLabelValues(operation).Observe(time.Since(startTime).Seconds())
+
+		if body != nil {
+			service.metrics.bytesReceived.WithLabelValues(operation).Add(float64(body.count))
+		}
+
+		if size := c.Writer.Size(); size > 0 {
+			service.metrics.bytesSent.WithLabelValues(operation).Add(float64(size))
+		}
+
+		if status >= 200 && status < 300 {
+			service.metrics.trackMultipartUpload(operation)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/cyverse/s3rods/irods"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultObjectContentType = "application/octet-stream"
+)
+
+// toObjectError converts an iRODS error of an object access into an S3 error
+func toObjectError(err error) error {
+	if irodsclient_types.IsFileNotFoundError(err) {
+		return ErrNoSuchKey
+	}
+
+	if irods.IsAccessDeniedError(err) {
+		return ErrAccessDenied
+	}
+
+	return err
+}
+
+// getObjectHeaders returns response headers describing the object
+func getObjectHeaders(entry *irodsclient_fs.Entry) map[string]string {
+	contentType := mime.TypeByExtension(path.Ext(entry.Name))
+	if len(contentType) == 0 {
+		contentType = defaultObjectContentType
+	}
+
+	return map[string]string{
+		"Content-Type":   contentType,
+		"Content-Length": strconv.FormatInt(entry.Size, 10),
+		"Last-Modified":  entry.ModifyTime.UTC().Format(http.TimeFormat),
+		"Accept-Ranges":  "none",
+	}
+}
+
+func (service *S3Service) handleHeadObject(c *gin.Context, credential *AWSCredential, operation S3Operation) {
+	entry, err := service.irodsController.StatObject(c.Request.Context(), credential.Username, credential.Ticket, operation.Bucket, operation.Key)
+	if err != nil {
+		service.writeError(c, toObjectError(err))
+		return
+	}
+
+	service.setResponseHeader(c)
+	for name, value := range getObjectHeaders(entry) {
+		c.Header(name, value)
+	}
+	c.Status(http.StatusOK)
+}
+
+// handleGetObject streams the object read as the requester, range requests are served with the whole object
+func (service *S3Service) handleGetObject(c *gin.Context, credential *AWSCredential, operation S3Operation) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleGetObject",
+	})
+
+	reader, err := service.irodsController.OpenObject(c.Request.Context(), credential.Username, credential.Ticket, operation.Bucket, operation.Key)
+	if err != nil {
+		service.writeError(c, toObjectError(err))
+		return
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			logger.Errorf("%+v", err)
+		}
+	}()
+
+	entry := reader.GetEntry()
+	headers := getObjectHeaders(entry)
+	contentType := headers["Content-Type"]
+	delete(headers, "Content-Type")
+	delete(headers, "Content-Length")
+
+	service.setResponseHeader(c)
+	c.DataFromReader(http.StatusOK, entry.Size, contentType, reader, headers)
+}
+
+// handlePutObject writes the request body to the object as the requester
+// the written object is deleted if the body doesn't match the signed payload hash or Content-MD5
+func (service *S3Service) handlePutObject(c *gin.Context, credential *AWSCredential, operation S3Operation) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handlePutObject",
+	})
+
+	contentSHA256 := c.GetHeader("X-Amz-Content-SHA256")
+	if strings.HasPrefix(contentSHA256, "STREAMING-") {
+		service.writeError(c, ErrNotImplemented.WithMessage("aws-chunked payloads are not supported, send UNSIGNED-PAYLOAD or the payload hash"))
+		return
+	}
+
+	if c.Request.ContentLength < 0 {
+		service.writeError(c, ErrMissingContentLength)
+		return
+	}
+
+	md5Hasher := md5.New()
+	body := io.TeeReader(c.Request.Body, md5Hasher)
+
+	var sha256Hasher hash.Hash
+	if len(contentSHA256) > 0 && contentSHA256 != unsignedPayload {
+		sha256Hasher = sha256.New()
+		body = io.TeeReader(body, sha256Hasher)
+	}
+
+	written, err := service.irodsController.PutObject(c.Request.Context(), credential.Username, credential.Ticket, operation.Bucket, operation.Key, body)
+	if err != nil {
+		service.writeError(c, toObjectError(err))
+		return
+	}
+
+	var digestErr error
+	if written != c.Request.ContentLength {
+		digestErr = ErrInvalidRequest.WithMessage("The request body is shorter than Content-Length")
+	}
+
+	md5Sum := md5Hasher.Sum(nil)
+	if contentMD5 := c.GetHeader("Content-MD5"); len(contentMD5) > 0 && contentMD5 != base64.StdEncoding.EncodeToString(md5Sum) {
+		digestErr = ErrBadDigest
+	}
+
+	if sha256Hasher != nil && hex.EncodeToString(sha256Hasher.Sum(nil)) != strings.ToLower(contentSHA256) {
+		digestErr = ErrXAmzContentSHA256Mismatch
+	}
+
+	if digestErr != nil {
+		err = service.irodsController.DeleteObject(c.Request.Context(), credential.Username, credential.Ticket, operation.Bucket, operation.Key)
+		if err != nil {
+			logger.Errorf("%+v", err)
+		}
+
+		service.writeError(c, digestErr)
+		return
+	}
+
+	logger.Debugf("wrote object %s/%s of %d bytes by %s", operation.Bucket, operation.Key, written, credential.Username)
+
+	service.setResponseHeader(c)
+	c.Header("ETag", "\""+hex.EncodeToString(md5Sum)+"\"")
+	c.Status(http.StatusOK)
+}
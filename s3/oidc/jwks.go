@@ -0,0 +1,283 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// jwksSizeMax is the max size of a JWKS document
+	jwksSizeMax = 1024 * 1024
+	// jwksFetchTimeout is the timeout of fetching a remote JWKS
+	jwksFetchTimeout = 10 * time.Second
+	// jwksRefreshInterval is the interval of refreshing a remote JWKS
+	jwksRefreshInterval = 1 * time.Hour
+	// jwksRefetchIntervalMin limits refetching a remote JWKS on an unknown key id
+	jwksRefetchIntervalMin = 1 * time.Minute
+)
+
+// KeySet provides public keys verifying JWT signatures
+type KeySet interface {
+	// GetKeys returns keys with the key id, all keys if the key id is empty
+	GetKeys(keyID string) ([]crypto.PublicKey, error)
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type publicKey struct {
+	keyID string
+	key   crypto.PublicKey
+}
+
+// StaticKeySet is a KeySet loaded once, e.g., from a local file
+type StaticKeySet struct {
+	keys []publicKey
+}
+
+// NewStaticKeySetFromFile loads a JWKS file
+func NewStaticKeySetFromFile(jwksPath string) (*StaticKeySet, error) {
+	jwksBytes, err := os.ReadFile(jwksPath)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read jwks %s: %w", jwksPath, err)
+	}
+
+	keys, err := parseJWKS(jwksBytes)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse jwks %s: %w", jwksPath, err)
+	}
+
+	return &StaticKeySet{
+		keys: keys,
+	}, nil
+}
+
+// GetKeys returns keys with the key id
+func (keySet *StaticKeySet) GetKeys(keyID string) ([]crypto.PublicKey, error) {
+	return findKeys(keySet.keys, keyID), nil
+}
+
+// RemoteKeySet is a KeySet fetched from a JWKS URL and refreshed periodically
+type RemoteKeySet struct {
+	jwksURL       string
+	client        *http.Client
+	keys          []publicKey
+	lastFetchTime time.Time
+	mutex         sync.Mutex
+}
+
+// NewRemoteKeySet creates a RemoteKeySet, keys are fetched lazily
+func NewRemoteKeySet(jwksURL string) *RemoteKeySet {
+	return &RemoteKeySet{
+		jwksURL: jwksURL,
+		client: &http.Client{
+			Timeout: jwksFetchTimeout,
+		},
+	}
+}
+
+// GetKeys returns keys with the key id, refetches the JWKS if the key id is unknown
+func (keySet *RemoteKeySet) GetKeys(keyID string) ([]crypto.PublicKey, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "oidc",
+		"struct":   "RemoteKeySet",
+		"function": "GetKeys",
+	})
+
+	keySet.mutex.Lock()
+	defer keySet.mutex.Unlock()
+
+	sinceLastFetch := time.Since(keySet.lastFetchTime)
+	keys := findKeys(keySet.keys, keyID)
+	if len(keys) > 0 && sinceLastFetch < jwksRefreshInterval {
+		return keys, nil
+	}
+
+	if sinceLastFetch < jwksRefetchIntervalMin {
+		// the key is rotated out or forged, do not hammer the provider
+		return keys, nil
+	}
+
+	fetchedKeys, err := keySet.fetch()
+	if err != nil {
+		if len(keys) > 0 {
+			// keep using cached keys while the provider is unreachable
+			logger.Warnf("%+v", err)
+			return keys, nil
+		}
+		return nil, err
+	}
+
+	keySet.keys = fetchedKeys
+	keySet.lastFetchTime = time.Now()
+
+	return findKeys(keySet.keys, keyID), nil
+}
+
+func (keySet *RemoteKeySet) fetch() ([]publicKey, error) {
+	response, err := keySet.client.Get(keySet.jwksURL)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to fetch jwks %s: %w", keySet.jwksURL, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("failed to fetch jwks %s: %s", keySet.jwksURL, response.Status)
+	}
+
+	jwksBytes, err := io.ReadAll(io.LimitReader(response.Body, jwksSizeMax))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read jwks %s: %w", keySet.jwksURL, err)
+	}
+
+	keys, err := parseJWKS(jwksBytes)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse jwks %s: %w", keySet.jwksURL, err)
+	}
+
+	return keys, nil
+}
+
+func findKeys(keys []publicKey, keyID string) []crypto.PublicKey {
+	foundKeys := []crypto.PublicKey{}
+	for _, key := range keys {
+		if len(keyID) == 0 || key.keyID == keyID {
+			foundKeys = append(foundKeys, key.key)
+		}
+	}
+	return foundKeys
+}
+
+// parseJWKS parses RSA and EC signing keys in a JWKS, other keys are ignored
+func parseJWKS(jwksBytes []byte) ([]publicKey, error) {
+	jwks := jsonWebKeySet{}
+	err := json.Unmarshal(jwksBytes, &jwks)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal jwks: %w", err)
+	}
+
+	keys := []publicKey{}
+	for _, jwk := range jwks.Keys {
+		if len(jwk.Use) > 0 && jwk.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		switch jwk.KeyType {
+		case "RSA":
+			key, err = parseRSAKey(jwk)
+		case "EC":
+			key, err = parseECKey(jwk)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse key %q: %w", jwk.KeyID, err)
+		}
+
+		keys = append(keys, publicKey{
+			keyID: jwk.KeyID,
+			key:   key,
+		})
+	}
+
+	if len(keys) == 0 {
+		return nil, xerrors.Errorf("no signing keys found in jwks")
+	}
+
+	return keys, nil
+}
+
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(jwk.N)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode modulus: %w", err)
+	}
+
+	e, err := decodeBigInt(jwk.E)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode exponent: %w", err)
+	}
+
+	if !e.IsInt64() || e.Int64() > int64(^uint32(0)>>1) {
+		return nil, xerrors.Errorf("exponent is too large")
+	}
+
+	return &rsa.PublicKey{
+		N: n,
+		E: int(e.Int64()),
+	}, nil
+}
+
+func parseECKey(jwk jsonWebKey) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch jwk.Curve {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, xerrors.Errorf("unsupported curve %q", jwk.Curve)
+	}
+
+	x, err := decodeBigInt(jwk.X)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode x: %w", err)
+	}
+
+	y, err := decodeBigInt(jwk.Y)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode y: %w", err)
+	}
+
+	if !curve.IsOnCurve(x, y) {
+		return nil, xerrors.Errorf("point is not on curve %s", jwk.Curve)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     x,
+		Y:     y,
+	}, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	if len(value) == 0 {
+		return nil, xerrors.Errorf("empty value")
+	}
+
+	valueBytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(valueBytes), nil
+}
@@ -0,0 +1,69 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestParseJWKS(t *testing.T) {
+	rsaSigner, ecSigner := newTestSigners(t)
+	rsaJWK := rsaSigner.getJWK()
+	ecJWK := ecSigner.getJWK()
+
+	keys, err := parseJWKS([]byte(`{"keys": [
+		{"kty": "RSA", "kid": "rsa-key", "use": "sig", "n": "` + rsaJWK["n"] + `", "e": "` + rsaJWK["e"] + `"},
+		{"kty": "RSA", "kid": "rsa-enc", "use": "enc", "n": "` + rsaJWK["n"] + `", "e": "` + rsaJWK["e"] + `"},
+		{"kty": "EC", "kid": "ec-key", "crv": "P-256", "x": "` + ecJWK["x"] + `", "y": "` + ecJWK["y"] + `"},
+		{"kty": "oct", "kid": "hmac-key", "k": "c2VjcmV0"}
+	]}`))
+	if err != nil {
+		t.Fatalf("failed to parse jwks: %v", err)
+	}
+
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 signing keys, got %d", len(keys))
+	}
+
+	if _, ok := findKeys(keys, "rsa-key")[0].(*rsa.PublicKey); !ok {
+		t.Errorf("expected an RSA key for rsa-key")
+	}
+
+	if _, ok := findKeys(keys, "ec-key")[0].(*ecdsa.PublicKey); !ok {
+		t.Errorf("expected an EC key for ec-key")
+	}
+
+	if len(findKeys(keys, "")) != 2 {
+		t.Errorf("expected all keys for an empty key id")
+	}
+
+	if len(findKeys(keys, "rsa-enc")) != 0 {
+		t.Errorf("expected no keys for an encryption key id")
+	}
+}
+
+func TestParseJWKSInvalid(t *testing.T) {
+	_, ecSigner := newTestSigners(t)
+	ecJWK := ecSigner.getJWK()
+
+	tests := []struct {
+		name string
+		jwks string
+	}{
+		{"not json", `keys`},
+		{"no keys", `{"keys": []}`},
+		{"no signing keys", `{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`},
+		{"RSA without modulus", `{"keys": [{"kty": "RSA", "e": "AQAB"}]}`},
+		{"unsupported curve", `{"keys": [{"kty": "EC", "crv": "P-192", "x": "` + ecJWK["x"] + `", "y": "` + ecJWK["y"] + `"}]}`},
+		{"point not on curve", `{"keys": [{"kty": "EC", "crv": "P-256", "x": "` + ecJWK["y"] + `", "y": "` + ecJWK["x"] + `"}]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseJWKS([]byte(test.jwks))
+			if err == nil {
+				t.Errorf("expected the jwks to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package oidc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// clockSkewLeeway tolerates clock differences between the provider and s3rods
+	clockSkewLeeway = 1 * time.Minute
+)
+
+var (
+	// ErrInvalidToken is returned when a JWT is malformed, forged or issued for others
+	ErrInvalidToken = xerrors.New("invalid web identity token")
+	// ErrExpiredToken is returned when a JWT is expired
+	ErrExpiredToken = xerrors.New("expired web identity token")
+)
+
+type signingAlgorithm struct {
+	hash  crypto.Hash
+	isRSA bool
+	isPSS bool
+}
+
+var signingAlgorithms = map[string]signingAlgorithm{
+	"RS256": {hash: crypto.SHA256, isRSA: true},
+	"RS384": {hash: crypto.SHA384, isRSA: true},
+	"RS512": {hash: crypto.SHA512, isRSA: true},
+	"PS256": {hash: crypto.SHA256, isRSA: true, isPSS: true},
+	"PS384": {hash: crypto.SHA384, isRSA: true, isPSS: true},
+	"PS512": {hash: crypto.SHA512, isRSA: true, isPSS: true},
+	"ES256": {hash: crypto.SHA256},
+	"ES384": {hash: crypto.SHA384},
+	"ES512": {hash: crypto.SHA512},
+}
+
+// Claims are claims of a verified JWT
+type Claims map[string]interface{}
+
+// GetString returns a string claim
+func (claims Claims) GetString(name string) string {
+	if value, ok := claims[name].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// GetSubject returns sub claim
+func (claims Claims) GetSubject() string {
+	return claims.GetString("sub")
+}
+
+// GetIssuer returns iss claim
+func (claims Claims) GetIssuer() string {
+	return claims.GetString("iss")
+}
+
+// GetAudiences returns aud claim, which can be a string or an array
+func (claims Claims) GetAudiences() []string {
+	switch audience := claims["aud"].(type) {
+	case string:
+		return []string{audience}
+	case []interface{}:
+		audiences := []string{}
+		for _, value := range audience {
+			if valueString, ok := value.(string); ok {
+				audiences = append(audiences, valueString)
+			}
+		}
+		return audiences
+	}
+	return nil
+}
+
+func (claims Claims) getTime(name string) (time.Time, bool) {
+	number, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(seconds), 0), true
+}
+
+// Verifier verifies JWTs issued by an OIDC provider
+type Verifier struct {
+	keySet   KeySet
+	issuer   string
+	audience string
+}
+
+// NewVerifier creates a new Verifier
+func NewVerifier(keySet KeySet, issuer string, audience string) *Verifier {
+	return &Verifier{
+		keySet:   keySet,
+		issuer:   issuer,
+		audience: audience,
+	}
+}
+
+// GetIssuer returns the issuer trusted
+func (verifier *Verifier) GetIssuer() string {
+	return verifier.issuer
+}
+
+// GetAudience returns the audience accepted
+func (verifier *Verifier) GetAudience() string {
+	return verifier.audience
+}
+
+// Verify verifies the signature and registered claims of the JWT and returns its claims
+func (verifier *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, xerrors.Errorf("token must have 3 parts: %w", ErrInvalidToken)
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode token header: %w", ErrInvalidToken)
+	}
+
+	header := struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}{}
+
+	err = json.Unmarshal(headerBytes, &header)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal token header: %w", ErrInvalidToken)
+	}
+
+	// only asymmetric algorithms, "none" and HMAC are never accepted
+	algorithm, ok := signingAlgorithms[header.Algorithm]
+	if !ok {
+		return nil, xerrors.Errorf("unsupported signing algorithm %q: %w", header.Algorithm, ErrInvalidToken)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode token signature: %w", ErrInvalidToken)
+	}
+
+	keys, err := verifier.keySet.GetKeys(header.KeyID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get keys: %w", err)
+	}
+
+	hasher := algorithm.hash.New()
+	hasher.Write([]byte(parts[0] + "." + parts[1]))
+	digest := hasher.Sum(nil)
+
+	verified := false
+	for _, key := range keys {
+		if verifySignature(algorithm, key, digest, signature) {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		return nil, xerrors.Errorf("signature mismatch: %w", ErrInvalidToken)
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode token payload: %w", ErrInvalidToken)
+	}
+
+	claims := Claims{}
+	decoder := json.NewDecoder(bytes.NewReader(payloadBytes))
+	decoder.UseNumber()
+	err = decoder.Decode(&claims)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal token payload: %w", ErrInvalidToken)
+	}
+
+	err = verifier.verifyClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (verifier *Verifier) verifyClaims(claims Claims) error {
+	now := time.Now()
+
+	expiration, ok := claims.getTime("exp")
+	if !ok {
+		return xerrors.Errorf("token has no expiration: %w", ErrInvalidToken)
+	}
+
+	if now.After(expiration.Add(clockSkewLeeway)) {
+		return ErrExpiredToken
+	}
+
+	if notBefore, ok := claims.getTime("nbf"); ok && now.Add(clockSkewLeeway).Before(notBefore) {
+		return xerrors.Errorf("token is not valid yet: %w", ErrInvalidToken)
+	}
+
+	if issuedAt, ok := claims.getTime("iat"); ok && now.Add(clockSkewLeeway).Before(issuedAt) {
+		return xerrors.Errorf("token is issued in the future: %w", ErrInvalidToken)
+	}
+
+	if claims.GetIssuer() != verifier.issuer {
+		return xerrors.Errorf("token is issued by %q: %w", claims.GetIssuer(), ErrInvalidToken)
+	}
+
+	for _, audience := range claims.GetAudiences() {
+		if audience == verifier.audience {
+			return nil
+		}
+	}
+
+	return xerrors.Errorf("token is not issued for %q: %w", verifier.audience, ErrInvalidToken)
+}
+
+func verifySignature(algorithm signingAlgorithm, key crypto.PublicKey, digest []byte, signature []byte) bool {
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		if !algorithm.isRSA {
+			return false
+		}
+
+		if algorithm.isPSS {
+			return rsa.VerifyPSS(publicKey, algorithm.hash, digest, signature, nil) == nil
+		}
+		return rsa.VerifyPKCS1v15(publicKey, algorithm.hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		if algorithm.isRSA {
+			return false
+		}
+
+		// JWS ECDSA signatures are r || s in fixed size
+		keySize := (publicKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*keySize {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:keySize])
+		s := new(big.Int).SetBytes(signature[keySize:])
+		return ecdsa.Verify(publicKey, digest, r, s)
+	}
+
+	return false
+}
@@ -0,0 +1,229 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "s3rods"
+)
+
+type testSigner struct {
+	keyID     string
+	algorithm string
+	rsaKey    *rsa.PrivateKey
+	ecKey     *ecdsa.PrivateKey
+}
+
+func (signer *testSigner) getJWK() map[string]string {
+	if signer.rsaKey != nil {
+		return map[string]string{
+			"kty": "RSA",
+			"kid": signer.keyID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(signer.rsaKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(signer.rsaKey.E)).Bytes()),
+		}
+	}
+
+	keySize := (signer.ecKey.Curve.Params().BitSize + 7) / 8
+	return map[string]string{
+		"kty": "EC",
+		"kid": signer.keyID,
+		"crv": signer.ecKey.Curve.Params().Name,
+		"x":   base64.RawURLEncoding.EncodeToString(signer.ecKey.X.FillBytes(make([]byte, keySize))),
+		"y":   base64.RawURLEncoding.EncodeToString(signer.ecKey.Y.FillBytes(make([]byte, keySize))),
+	}
+}
+
+func (signer *testSigner) sign(t *testing.T, header map[string]interface{}, claims map[string]interface{}) string {
+	t.Helper()
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("failed to marshal header: %v", err)
+	}
+
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to marshal claims: %v", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerBytes) + "." + base64.RawURLEncoding.EncodeToString(claimsBytes)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signingInput))
+
+	var signature []byte
+	switch header["alg"] {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, signer.rsaKey, crypto.SHA256, digest.Sum(nil))
+	case "PS256":
+		signature, err = rsa.SignPSS(rand.Reader, signer.rsaKey, crypto.SHA256, digest.Sum(nil), nil)
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, signer.ecKey, digest.Sum(nil))
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	default:
+		signature = []byte("signature")
+	}
+
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (signer *testSigner) signClaims(t *testing.T, claims map[string]interface{}) string {
+	return signer.sign(t, map[string]interface{}{"alg": signer.algorithm, "kid": signer.keyID}, claims)
+}
+
+func newTestSigners(t *testing.T) (*testSigner, *testSigner) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+
+	return &testSigner{keyID: "rsa-key", algorithm: "RS256", rsaKey: rsaKey}, &testSigner{keyID: "ec-key", algorithm: "ES256", ecKey: ecKey}
+}
+
+func newTestVerifier(t *testing.T, signers ...*testSigner) *Verifier {
+	t.Helper()
+
+	keys := []map[string]string{}
+	for _, signer := range signers {
+		keys = append(keys, signer.getJWK())
+	}
+
+	jwksBytes, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatalf("failed to marshal jwks: %v", err)
+	}
+
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	err = os.WriteFile(jwksPath, jwksBytes, 0600)
+	if err != nil {
+		t.Fatalf("failed to write jwks: %v", err)
+	}
+
+	keySet, err := NewStaticKeySetFromFile(jwksPath)
+	if err != nil {
+		t.Fatalf("failed to load jwks: %v", err)
+	}
+
+	return NewVerifier(keySet, testIssuer, testAudience)
+}
+
+func newTestClaims(overrides map[string]interface{}) map[string]interface{} {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": testIssuer,
+		"aud": testAudience,
+		"sub": "alice",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestVerify(t *testing.T) {
+	rsaSigner, ecSigner := newTestSigners(t)
+	verifier := newTestVerifier(t, rsaSigner, ecSigner)
+
+	pssHeader := map[string]interface{}{"alg": "PS256", "kid": rsaSigner.keyID}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"RS256", rsaSigner.signClaims(t, newTestClaims(nil))},
+		{"PS256", rsaSigner.sign(t, pssHeader, newTestClaims(nil))},
+		{"ES256", ecSigner.signClaims(t, newTestClaims(nil))},
+		{"without key id", rsaSigner.sign(t, map[string]interface{}{"alg": "RS256"}, newTestClaims(nil))},
+		{"audience array", rsaSigner.signClaims(t, newTestClaims(map[string]interface{}{"aud": []string{"other", testAudience}}))},
+		{"expired within leeway", rsaSigner.signClaims(t, newTestClaims(map[string]interface{}{"exp": time.Now().Add(-30 * time.Second).Unix()}))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := verifier.Verify(test.token)
+			if err != nil {
+				t.Fatalf("failed to verify token: %v", err)
+			}
+
+			if claims.GetSubject() != "alice" {
+				t.Errorf("expected subject alice, got %q", claims.GetSubject())
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	rsaSigner, ecSigner := newTestSigners(t)
+	verifier := newTestVerifier(t, rsaSigner, ecSigner)
+
+	otherSigner, _ := newTestSigners(t)
+	validParts := strings.Split(rsaSigner.signClaims(t, newTestClaims(nil)), ".")
+	otherParts := strings.Split(rsaSigner.signClaims(t, newTestClaims(map[string]interface{}{"sub": "rods"})), ".")
+
+	tests := []struct {
+		name     string
+		token    string
+		expected error
+	}{
+		{"malformed", "not-a-token", ErrInvalidToken},
+		{"alg none", rsaSigner.sign(t, map[string]interface{}{"alg": "none"}, newTestClaims(nil)), ErrInvalidToken},
+		{"alg HS256", rsaSigner.sign(t, map[string]interface{}{"alg": "HS256"}, newTestClaims(nil)), ErrInvalidToken},
+		{"swapped payload", validParts[0] + "." + otherParts[1] + "." + validParts[2], ErrInvalidToken},
+		{"unknown signer", otherSigner.signClaims(t, newTestClaims(nil)), ErrInvalidToken},
+		{"RSA signature with EC key id", rsaSigner.sign(t, map[string]interface{}{"alg": "RS256", "kid": ecSigner.keyID}, newTestClaims(nil)), ErrInvalidToken},
+		{"wrong issuer", rsaSigner.signClaims(t, newTestClaims(map[string]interface{}{"iss": "https://evil.example.com"})), ErrInvalidToken},
+		{"wrong audience", rsaSigner.signClaims(t, newTestClaims(map[string]interface{}{"aud": "other"})), ErrInvalidToken},
+		{"wrong audience array", rsaSigner.signClaims(t, newTestClaims(map[string]interface{}{"aud": []string{"other"}})), ErrInvalidToken},
+		{"no expiration", rsaSigner.signClaims(t, newTestClaims(map[string]interface{}{"exp": nil})), ErrInvalidToken},
+		{"expired", rsaSigner.signClaims(t, newTestClaims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})), ErrExpiredToken},
+		{"not valid yet", rsaSigner.signClaims(t, newTestClaims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})), ErrInvalidToken},
+		{"issued in the future", rsaSigner.signClaims(t, newTestClaims(map[string]interface{}{"iat": time.Now().Add(time.Hour).Unix()})), ErrInvalidToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := verifier.Verify(test.token)
+			if !xerrors.Is(err, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
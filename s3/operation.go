@@ -0,0 +1,133 @@
+package s3
+
+import (
+	"net/http"
+	"strings"
+)
+
+// S3Operation describes an S3 API operation requested
+type S3Operation struct {
+	Name   string // GetObject
+	Action string // s3:GetObject
+	Bucket string
+	Key    string
+}
+
+func newS3Operation(name string, action string, bucket string, key string) S3Operation {
+	return S3Operation{
+		Name:   name,
+		Action: action,
+		Bucket: bucket,
+		Key:    key,
+	}
+}
+
+// getS3Operation resolves S3 API operation from the path-style request
+func getS3Operation(request *http.Request) S3Operation {
+	bucket, key := splitBucketKey(request.URL.Path)
+	query := request.URL.Query()
+
+	has := func(param string) bool {
+		_, ok := query[param]
+		return ok
+	}
+
+	if len(bucket) == 0 {
+		return newS3Operation("ListBuckets", "s3:ListAllMyBuckets", "", "")
+	}
+
+	if len(key) == 0 {
+		// bucket operations
+		switch request.Method {
+		case http.MethodGet:
+			switch {
+			case has("policy"):
+				return newS3Operation("GetBucketPolicy", "s3:GetBucketPolicy", bucket, "")
+			case has("logging"):
+				return newS3Operation("GetBucketLogging", "s3:GetBucketLogging", bucket, "")
+			case has("uploads"):
+				return newS3Operation("ListMultipartUploads", "s3:ListBucketMultipartUploads", bucket, "")
+			case has("location"):
+				return newS3Operation("GetBucketLocation", "s3:GetBucketLocation", bucket, "")
+			default:
+				return newS3Operation("ListObjects", "s3:ListBucket", bucket, "")
+			}
+		case http.MethodHead:
+			return newS3Operation("HeadBucket", "s3:ListBucket", bucket, "")
+		case http.MethodPut:
+			switch {
+			case has("policy"):
+				return newS3Operation("PutBucketPolicy", "s3:PutBucketPolicy", bucket, "")
+			case has("logging"):
+				return newS3Operation("PutBucketLogging", "s3:PutBucketLogging", bucket, "")
+			default:
+				return newS3Operation("CreateBucket", "s3:CreateBucket", bucket, "")
+			}
+		case http.MethodDelete:
+			switch {
+			case has("policy"):
+				return newS3Operation("DeleteBucketPolicy", "s3:DeleteBucketPolicy", bucket, "")
+			default:
+				return newS3Operation("DeleteBucket", "s3:DeleteBucket", bucket, "")
+			}
+		case http.MethodPost:
+			if has("delete") {
+				return newS3Operation("DeleteObjects", "s3:DeleteObject", bucket, "")
+			}
+		}
+
+		return newS3Operation("Unknown", "", bucket, "")
+	}
+
+	// object operations
+	switch request.Method {
+	case http.MethodGet:
+		if has("uploadId") {
+			return newS3Operation("ListParts", "s3:ListMultipartUploadParts", bucket, key)
+		}
+		return newS3Operation("GetObject", "s3:GetObject", bucket, key)
+	case http.MethodHead:
+		return newS3Operation("HeadObject", "s3:GetObject", bucket, key)
+	case http.MethodPut:
+		copySource := request.Header.Get("X-Amz-Copy-Source")
+		if has("uploadId") && has("partNumber") {
+			if len(copySource) > 0 {
+				return newS3Operation("UploadPartCopy", "s3:PutObject", bucket, key)
+			}
+			return newS3Operation("UploadPart", "s3:PutObject", bucket, key)
+		}
+
+		if len(copySource) > 0 {
+			return newS3Operation("CopyObject", "s3:PutObject", bucket, key)
+		}
+		return newS3Operation("PutObject", "s3:PutObject", bucket, key)
+	case http.MethodDelete:
+		if has("uploadId") {
+			return newS3Operation("AbortMultipartUpload", "s3:AbortMultipartUpload", bucket, key)
+		}
+		return newS3Operation("DeleteObject", "s3:DeleteObject", bucket, key)
+	case http.MethodPost:
+		if has("uploads") {
+			return newS3Operation("CreateMultipartUpload", "s3:PutObject", bucket, key)
+		}
+		if has("uploadId") {
+			return newS3Operation("CompleteMultipartUpload", "s3:PutObject", bucket, key)
+		}
+	}
+
+	return newS3Operation("Unknown", "", bucket, key)
+}
+
+// splitBucketKey splits path-style URL path into bucket and key
+func splitBucketKey(urlPath string) (string, string) {
+	trimmed := strings.TrimPrefix(urlPath, "/")
+	parts := strings.SplitN(trimmed, "/", 2)
+
+	bucket := parts[0]
+	key := ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+
+	return bucket, key
+}
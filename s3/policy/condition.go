@@ -0,0 +1,294 @@
+package policy
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// ConditionKeySourceIP is the IP address of the requester
+	ConditionKeySourceIP = "aws:SourceIp"
+	// ConditionKeySecureTransport is "true" when the request is sent over TLS
+	ConditionKeySecureTransport = "aws:SecureTransport"
+	// ConditionKeyCurrentTime is the request time in ISO 8601
+	ConditionKeyCurrentTime = "aws:CurrentTime"
+	// ConditionKeyEpochTime is the request time in seconds since epoch
+	ConditionKeyEpochTime = "aws:EpochTime"
+	// ConditionKeyUsername is the name of the requester
+	ConditionKeyUsername = "aws:username"
+	// ConditionKeyUserAgent is the user agent of the requester
+	ConditionKeyUserAgent = "aws:UserAgent"
+	// ConditionKeyReferer is the referer of the request
+	ConditionKeyReferer = "aws:Referer"
+	// ConditionKeyPrefix is the prefix parameter of ListObjects
+	ConditionKeyPrefix = "s3:prefix"
+	// ConditionKeyDelimiter is the delimiter parameter of ListObjects
+	ConditionKeyDelimiter = "s3:delimiter"
+	// ConditionKeyMaxKeys is the max-keys parameter of ListObjects
+	ConditionKeyMaxKeys = "s3:max-keys"
+
+	ifExistsSuffix = "IfExists"
+)
+
+type conditionFunc func(requestValues []string, policyValues []string) (bool, error)
+
+var conditionFuncs = map[string]conditionFunc{
+	"StringEquals":              matchAny(stringEquals),
+	"StringNotEquals":           negate(matchAny(stringEquals)),
+	"StringEqualsIgnoreCase":    matchAny(strings.EqualFold),
+	"StringNotEqualsIgnoreCase": negate(matchAny(strings.EqualFold)),
+	"StringLike":                matchAny(stringLike),
+	"StringNotLike":             negate(matchAny(stringLike)),
+	"NumericEquals":             matchAnyWithError(numericCompare(func(a, b float64) bool { return a == b })),
+	"NumericNotEquals":          negate(matchAnyWithError(numericCompare(func(a, b float64) bool { return a == b }))),
+	"NumericLessThan":           matchAnyWithError(numericCompare(func(a, b float64) bool { return a < b })),
+	"NumericLessThanEquals":     matchAnyWithError(numericCompare(func(a, b float64) bool { return a <= b })),
+	"NumericGreaterThan":        matchAnyWithError(numericCompare(func(a, b float64) bool { return a > b })),
+	"NumericGreaterThanEquals":  matchAnyWithError(numericCompare(func(a, b float64) bool { return a >= b })),
+	"DateEquals":                matchAnyWithError(dateCompare(func(a, b time.Time) bool { return a.Equal(b) })),
+	"DateNotEquals":             negate(matchAnyWithError(dateCompare(func(a, b time.Time) bool { return a.Equal(b) }))),
+	"DateLessThan":              matchAnyWithError(dateCompare(func(a, b time.Time) bool { return a.Before(b) })),
+	"DateLessThanEquals":        matchAnyWithError(dateCompare(func(a, b time.Time) bool { return !a.After(b) })),
+	"DateGreaterThan":           matchAnyWithError(dateCompare(func(a, b time.Time) bool { return a.After(b) })),
+	"DateGreaterThanEquals":     matchAnyWithError(dateCompare(func(a, b time.Time) bool { return !a.Before(b) })),
+	"Bool":                      matchAny(strings.EqualFold),
+	"IpAddress":                 matchAnyWithError(ipAddressInRange),
+	"NotIpAddress":              negate(matchAnyWithError(ipAddressInRange)),
+}
+
+// negatedOperators are satisfied when the condition key is missing from the request
+var negatedOperators = map[string]bool{
+	"StringNotEquals":           true,
+	"StringNotEqualsIgnoreCase": true,
+	"StringNotLike":             true,
+	"NumericNotEquals":          true,
+	"DateNotEquals":             true,
+	"NotIpAddress":              true,
+}
+
+// Condition is a condition block of a statement, operator -> condition key -> values
+type Condition map[string]map[string]StringList
+
+// Validate validates the condition block
+func (condition Condition) Validate() error {
+	for operator, keyValues := range condition {
+		if operator == "Null" {
+			for key, values := range keyValues {
+				for _, value := range values {
+					if _, err := strconv.ParseBool(value); err != nil {
+						return xerrors.Errorf("invalid value %q for Null condition on %q", value, key)
+					}
+				}
+			}
+			continue
+		}
+
+		baseOperator := strings.TrimSuffix(operator, ifExistsSuffix)
+		if _, ok := conditionFuncs[baseOperator]; !ok {
+			return xerrors.Errorf("unsupported condition operator %q", operator)
+		}
+
+		for key, values := range keyValues {
+			if len(values) == 0 {
+				return xerrors.Errorf("no values given for condition key %q", key)
+			}
+
+			// check if policy values are parsable, request values are ignored
+			_, err := conditionFuncs[baseOperator](nil, values)
+			if err != nil {
+				return xerrors.Errorf("invalid value for condition key %q: %w", key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Evaluate evaluates the condition block against request context
+// all operators and keys must be satisfied
+func (condition Condition) Evaluate(context map[string][]string) (bool, error) {
+	for operator, keyValues := range condition {
+		for key, policyValues := range keyValues {
+			// a key without values is missing, nil request values are only for validation
+			requestValues := context[key]
+			hasKey := len(requestValues) > 0
+
+			if operator == "Null" {
+				for _, policyValue := range policyValues {
+					expectNull, _ := strconv.ParseBool(policyValue)
+					if expectNull == hasKey {
+						return false, nil
+					}
+				}
+				continue
+			}
+
+			baseOperator := strings.TrimSuffix(operator, ifExistsSuffix)
+			if !hasKey {
+				if baseOperator != operator || negatedOperators[baseOperator] {
+					// IfExists, or a missing value never equals the policy values
+					continue
+				}
+				return false, nil
+			}
+
+			matchFunc, ok := conditionFuncs[baseOperator]
+			if !ok {
+				return false, xerrors.Errorf("unsupported condition operator %q", operator)
+			}
+
+			matched, err := matchFunc(requestValues, policyValues)
+			if err != nil {
+				return false, err
+			}
+
+			if !matched {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+func matchAny(match func(requestValue string, policyValue string) bool) conditionFunc {
+	return matchAnyWithError(func(requestValue string, policyValue string) (bool, error) {
+		return match(requestValue, policyValue), nil
+	})
+}
+
+func matchAnyWithError(match func(requestValue string, policyValue string) (bool, error)) conditionFunc {
+	return func(requestValues []string, policyValues []string) (bool, error) {
+		if requestValues == nil {
+			// validation only
+			for _, policyValue := range policyValues {
+				_, err := match("", policyValue)
+				if err != nil && !xerrors.Is(err, errInvalidRequestValue) {
+					return false, err
+				}
+			}
+			return false, nil
+		}
+
+		for _, requestValue := range requestValues {
+			for _, policyValue := range policyValues {
+				matched, err := match(requestValue, policyValue)
+				if err != nil {
+					if xerrors.Is(err, errInvalidRequestValue) {
+						continue
+					}
+					return false, err
+				}
+
+				if matched {
+					return true, nil
+				}
+			}
+		}
+
+		return false, nil
+	}
+}
+
+func negate(condition conditionFunc) conditionFunc {
+	return func(requestValues []string, policyValues []string) (bool, error) {
+		matched, err := condition(requestValues, policyValues)
+		if err != nil {
+			return false, err
+		}
+
+		return !matched, nil
+	}
+}
+
+var errInvalidRequestValue = xerrors.New("invalid request value")
+
+func stringEquals(requestValue string, policyValue string) bool {
+	return requestValue == policyValue
+}
+
+func stringLike(requestValue string, policyValue string) bool {
+	return matchWildcard(policyValue, requestValue)
+}
+
+func numericCompare(compare func(a, b float64) bool) func(requestValue string, policyValue string) (bool, error) {
+	return func(requestValue string, policyValue string) (bool, error) {
+		policyNumber, err := strconv.ParseFloat(policyValue, 64)
+		if err != nil {
+			return false, xerrors.Errorf("failed to parse number %q: %w", policyValue, err)
+		}
+
+		requestNumber, err := strconv.ParseFloat(requestValue, 64)
+		if err != nil {
+			return false, errInvalidRequestValue
+		}
+
+		return compare(requestNumber, policyNumber), nil
+	}
+}
+
+func dateCompare(compare func(a, b time.Time) bool) func(requestValue string, policyValue string) (bool, error) {
+	return func(requestValue string, policyValue string) (bool, error) {
+		policyTime, err := parseDate(policyValue)
+		if err != nil {
+			return false, err
+		}
+
+		requestTime, err := parseDate(requestValue)
+		if err != nil {
+			return false, errInvalidRequestValue
+		}
+
+		return compare(requestTime, policyTime), nil
+	}
+}
+
+func parseDate(value string) (time.Time, error) {
+	layouts := []string{
+		time.RFC3339,
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02",
+		"20060102T150405Z",
+	}
+
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return time.Unix(epoch, 0).UTC(), nil
+	}
+
+	return time.Time{}, xerrors.Errorf("failed to parse date %q", value)
+}
+
+func ipAddressInRange(requestValue string, policyValue string) (bool, error) {
+	cidr := policyValue
+	if !strings.Contains(cidr, "/") {
+		if strings.Contains(cidr, ":") {
+			cidr += "/128"
+		} else {
+			cidr += "/32"
+		}
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, xerrors.Errorf("failed to parse IP address range %q: %w", policyValue, err)
+	}
+
+	ip := net.ParseIP(requestValue)
+	if ip == nil {
+		return false, errInvalidRequestValue
+	}
+
+	return ipNet.Contains(ip), nil
+}
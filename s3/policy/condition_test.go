@@ -0,0 +1,130 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestConditionEvaluate(t *testing.T) {
+	requestContext := map[string][]string{
+		ConditionKeySourceIP:        {"192.168.1.10"},
+		ConditionKeySecureTransport: {"true"},
+		ConditionKeyCurrentTime:     {"2024-05-01T12:00:00Z"},
+		ConditionKeyUsername:        {"alice"},
+		ConditionKeyPrefix:          {"home/alice/"},
+		ConditionKeyMaxKeys:         {"100"},
+	}
+
+	tests := []struct {
+		name      string
+		condition Condition
+		expected  bool
+	}{
+		{"empty", Condition{}, true},
+		{"StringEquals", Condition{"StringEquals": {ConditionKeyUsername: {"bob", "alice"}}}, true},
+		{"StringEquals mismatch", Condition{"StringEquals": {ConditionKeyUsername: {"bob"}}}, false},
+		{"StringNotEquals", Condition{"StringNotEquals": {ConditionKeyUsername: {"bob"}}}, true},
+		{"StringNotEquals mismatch", Condition{"StringNotEquals": {ConditionKeyUsername: {"alice"}}}, false},
+		{"StringEqualsIgnoreCase", Condition{"StringEqualsIgnoreCase": {ConditionKeyUsername: {"ALICE"}}}, true},
+		{"StringLike", Condition{"StringLike": {ConditionKeyPrefix: {"home/*"}}}, true},
+		{"StringLike question mark", Condition{"StringLike": {ConditionKeyUsername: {"al?ce"}}}, true},
+		{"StringNotLike", Condition{"StringNotLike": {ConditionKeyPrefix: {"home/*"}}}, false},
+		{"NumericLessThanEquals", Condition{"NumericLessThanEquals": {ConditionKeyMaxKeys: {"100"}}}, true},
+		{"NumericLessThan", Condition{"NumericLessThan": {ConditionKeyMaxKeys: {"100"}}}, false},
+		{"NumericNotEquals", Condition{"NumericNotEquals": {ConditionKeyMaxKeys: {"10"}}}, true},
+		{"DateLessThan", Condition{"DateLessThan": {ConditionKeyCurrentTime: {"2025-01-01T00:00:00Z"}}}, true},
+		{"DateGreaterThan", Condition{"DateGreaterThan": {ConditionKeyCurrentTime: {"2025-01-01"}}}, false},
+		{"Bool", Condition{"Bool": {ConditionKeySecureTransport: {"True"}}}, true},
+		{"Bool false", Condition{"Bool": {ConditionKeySecureTransport: {"false"}}}, false},
+		{"IpAddress", Condition{"IpAddress": {ConditionKeySourceIP: {"192.168.0.0/16"}}}, true},
+		{"IpAddress single", Condition{"IpAddress": {ConditionKeySourceIP: {"192.168.1.11"}}}, false},
+		{"NotIpAddress", Condition{"NotIpAddress": {ConditionKeySourceIP: {"10.0.0.0/8"}}}, true},
+		{"all keys must match", Condition{
+			"StringEquals": {ConditionKeyUsername: {"alice"}},
+			"IpAddress":    {ConditionKeySourceIP: {"10.0.0.0/8"}},
+		}, false},
+
+		// missing keys
+		{"missing StringEquals", Condition{"StringEquals": {ConditionKeyReferer: {"https://example.com/*"}}}, false},
+		{"missing StringLike", Condition{"StringLike": {ConditionKeyReferer: {"https://example.com/*"}}}, false},
+		{"missing StringNotEquals", Condition{"StringNotEquals": {ConditionKeyReferer: {"https://example.com/"}}}, true},
+		{"missing StringNotEqualsIgnoreCase", Condition{"StringNotEqualsIgnoreCase": {ConditionKeyReferer: {"https://example.com/"}}}, true},
+		{"missing StringNotLike", Condition{"StringNotLike": {ConditionKeyReferer: {"https://example.com/*"}}}, true},
+		{"missing NumericNotEquals", Condition{"NumericNotEquals": {ConditionKeyEpochTime: {"0"}}}, true},
+		{"missing DateNotEquals", Condition{"DateNotEquals": {ConditionKeyEpochTime: {"2024-01-01"}}}, true},
+		{"missing NotIpAddress", Condition{"NotIpAddress": {ConditionKeyUserAgent: {"10.0.0.0/8"}}}, true},
+		{"missing NumericLessThan", Condition{"NumericLessThan": {ConditionKeyEpochTime: {"0"}}}, false},
+		{"empty values are missing", Condition{"StringNotLike": {ConditionKeyDelimiter: {"/"}}}, true},
+
+		// IfExists
+		{"missing StringLikeIfExists", Condition{"StringLikeIfExists": {ConditionKeyReferer: {"https://example.com/*"}}}, true},
+		{"missing StringNotLikeIfExists", Condition{"StringNotLikeIfExists": {ConditionKeyReferer: {"https://example.com/*"}}}, true},
+		{"present StringEqualsIfExists", Condition{"StringEqualsIfExists": {ConditionKeyUsername: {"alice"}}}, true},
+		{"present StringEqualsIfExists mismatch", Condition{"StringEqualsIfExists": {ConditionKeyUsername: {"bob"}}}, false},
+
+		// Null
+		{"Null true on missing", Condition{"Null": {ConditionKeyReferer: {"true"}}}, true},
+		{"Null true on present", Condition{"Null": {ConditionKeyUsername: {"true"}}}, false},
+		{"Null false on present", Condition{"Null": {ConditionKeyUsername: {"false"}}}, true},
+		{"Null false on missing", Condition{"Null": {ConditionKeyReferer: {"false"}}}, false},
+	}
+
+	// a key without values
+	requestContext[ConditionKeyDelimiter] = []string{}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.condition.Validate()
+			if err != nil {
+				t.Fatalf("failed to validate condition: %v", err)
+			}
+
+			matched, err := test.condition.Evaluate(requestContext)
+			if err != nil {
+				t.Fatalf("failed to evaluate condition: %v", err)
+			}
+
+			if matched != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, matched)
+			}
+		})
+	}
+}
+
+func TestConditionEvaluateInvalidRequestValue(t *testing.T) {
+	condition := Condition{"NumericLessThan": {ConditionKeyMaxKeys: {"100"}}}
+
+	matched, err := condition.Evaluate(map[string][]string{ConditionKeyMaxKeys: {"many"}})
+	if err != nil {
+		t.Fatalf("failed to evaluate condition: %v", err)
+	}
+
+	if matched {
+		t.Errorf("expected an unparsable request value not to match")
+	}
+}
+
+func TestConditionValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition Condition
+		valid     bool
+	}{
+		{"StringEquals", Condition{"StringEquals": {ConditionKeyUsername: {"alice"}}}, true},
+		{"IfExists", Condition{"NumericLessThanIfExists": {ConditionKeyMaxKeys: {"10"}}}, true},
+		{"unknown operator", Condition{"StringSort": {ConditionKeyUsername: {"alice"}}}, false},
+		{"no values", Condition{"StringEquals": {ConditionKeyUsername: {}}}, false},
+		{"invalid number", Condition{"NumericEquals": {ConditionKeyMaxKeys: {"ten"}}}, false},
+		{"invalid date", Condition{"DateLessThan": {ConditionKeyCurrentTime: {"tomorrow"}}}, false},
+		{"invalid IP", Condition{"IpAddress": {ConditionKeySourceIP: {"300.0.0.0/8"}}}, false},
+		{"invalid Null", Condition{"Null": {ConditionKeyReferer: {"maybe"}}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.condition.Validate()
+			if (err == nil) != test.valid {
+				t.Errorf("expected valid %t, got error %v", test.valid, err)
+			}
+		})
+	}
+}
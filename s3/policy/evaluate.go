@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Decision is a result of policy evaluation
+type Decision int
+
+const (
+	// DecisionNotApplicable means that no statement matched the request
+	DecisionNotApplicable Decision = iota
+	// DecisionAllow means that a statement explicitly allowed the request
+	DecisionAllow
+	// DecisionDeny means that a statement explicitly denied the request
+	DecisionDeny
+)
+
+// String returns a string form of the decision
+func (decision Decision) String() string {
+	switch decision {
+	case DecisionAllow:
+		return "Allow"
+	case DecisionDeny:
+		return "Deny"
+	default:
+		return "NotApplicable"
+	}
+}
+
+// Request is a request to be evaluated against policies
+type Request struct {
+	Username string              // iRODS username of the requester
+	Action   string              // s3:GetObject
+	Resource string              // arn:aws:s3:::bucket/key
+	Context  map[string][]string // condition keys
+}
+
+// Evaluate evaluates the request against the policy
+// an explicit deny overrides any allow
+func (policy *Policy) Evaluate(request *Request) Decision {
+	logger := log.WithFields(log.Fields{
+		"package":  "policy",
+		"struct":   "Policy",
+		"function": "Evaluate",
+	})
+
+	decision := DecisionNotApplicable
+	for _, statement := range policy.Statements {
+		matched, err := statement.matches(request)
+		if err != nil {
+			// a broken deny statement must not grant access, a broken allow statement is not applicable
+			logger.WithError(err).Warnf("failed to evaluate statement %q", statement.Sid)
+			if statement.Effect == EffectDeny {
+				return DecisionDeny
+			}
+			continue
+		}
+
+		if !matched {
+			continue
+		}
+
+		if statement.Effect == EffectDeny {
+			return DecisionDeny
+		}
+
+		decision = DecisionAllow
+	}
+
+	return decision
+}
+
+func (statement *Statement) matches(request *Request) (bool, error) {
+	if statement.Principal != nil && !statement.Principal.Matches(request.Username) {
+		return false, nil
+	}
+
+	if statement.NotPrincipal != nil && statement.NotPrincipal.Matches(request.Username) {
+		return false, nil
+	}
+
+	if len(statement.Action) > 0 && !matchActions(statement.Action, request.Action) {
+		return false, nil
+	}
+
+	if len(statement.NotAction) > 0 && matchActions(statement.NotAction, request.Action) {
+		return false, nil
+	}
+
+	if len(statement.Resource) > 0 && !matchResources(statement.Resource, request.Resource) {
+		return false, nil
+	}
+
+	if len(statement.NotResource) > 0 && matchResources(statement.NotResource, request.Resource) {
+		return false, nil
+	}
+
+	return statement.Condition.Evaluate(request.Context)
+}
+
+func matchActions(actions StringList, action string) bool {
+	for _, pattern := range actions {
+		// action names are case-insensitive
+		if matchWildcard(strings.ToLower(pattern), strings.ToLower(action)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchResources(resources StringList, resource string) bool {
+	for _, pattern := range resources {
+		if matchWildcard(pattern, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard matches the value against the pattern that may contain * and ?
+func matchWildcard(pattern string, value string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	patternRunes := []rune(pattern)
+	valueRunes := []rune(value)
+
+	p, v := 0, 0
+	starP, starV := -1, 0
+	for v < len(valueRunes) {
+		if p < len(patternRunes) && (patternRunes[p] == '?' || patternRunes[p] == valueRunes[v]) {
+			p++
+			v++
+		} else if p < len(patternRunes) && patternRunes[p] == '*' {
+			starP = p
+			starV = v
+			p++
+		} else if starP >= 0 {
+			p = starP + 1
+			starV++
+			v = starV
+		} else {
+			return false
+		}
+	}
+
+	for p < len(patternRunes) && patternRunes[p] == '*' {
+		p++
+	}
+
+	return p == len(patternRunes)
+}
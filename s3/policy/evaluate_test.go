@@ -0,0 +1,251 @@
+package policy
+
+import (
+	"testing"
+)
+
+const testPolicy = `{
+	"Version": "2012-10-17",
+	"Statement": [
+		{
+			"Sid": "PublicRead",
+			"Effect": "Allow",
+			"Principal": "*",
+			"Action": "s3:GetObject",
+			"Resource": "arn:aws:s3:::bucket/public/*"
+		},
+		{
+			"Sid": "BobWrite",
+			"Effect": "Allow",
+			"Principal": {"AWS": "arn:aws:iam:::user/bob"},
+			"Action": ["s3:PutObject", "s3:DeleteObject"],
+			"Resource": "arn:aws:s3:::bucket/*"
+		},
+		{
+			"Sid": "DenyHotlink",
+			"Effect": "Deny",
+			"Principal": "*",
+			"Action": "s3:GetObject",
+			"Resource": "arn:aws:s3:::bucket/public/*",
+			"Condition": {"StringNotLike": {"aws:Referer": "https://example.com/*"}}
+		},
+		{
+			"Sid": "DenyInsecure",
+			"Effect": "Deny",
+			"Principal": "*",
+			"Action": "s3:*",
+			"Resource": ["arn:aws:s3:::bucket", "arn:aws:s3:::bucket/*"],
+			"Condition": {"Bool": {"aws:SecureTransport": "false"}}
+		}
+	]
+}`
+
+func newTestRequest(username string, action string, key string, context map[string][]string) *Request {
+	if context == nil {
+		context = map[string][]string{}
+	}
+
+	if _, ok := context[ConditionKeySecureTransport]; !ok {
+		context[ConditionKeySecureTransport] = []string{"true"}
+	}
+
+	return &Request{
+		Username: username,
+		Action:   action,
+		Resource: GetResource("bucket", key),
+		Context:  context,
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy, err := ParseBucketPolicy("bucket", []byte(testPolicy))
+	if err != nil {
+		t.Fatalf("failed to parse policy: %v", err)
+	}
+
+	referer := map[string][]string{ConditionKeyReferer: {"https://example.com/page"}}
+
+	tests := []struct {
+		name     string
+		request  *Request
+		expected Decision
+	}{
+		{"public read with referer", newTestRequest("alice", "s3:GetObject", "public/a.txt", referer), DecisionAllow},
+		{"public read from other site", newTestRequest("alice", "s3:GetObject", "public/a.txt", map[string][]string{ConditionKeyReferer: {"https://evil.com/"}}), DecisionDeny},
+		{"public read without referer", newTestRequest("alice", "s3:GetObject", "public/a.txt", nil), DecisionDeny},
+		{"private read", newTestRequest("alice", "s3:GetObject", "private/a.txt", referer), DecisionNotApplicable},
+		{"bob write", newTestRequest("bob", "s3:PutObject", "private/a.txt", nil), DecisionAllow},
+		{"action is case-insensitive", newTestRequest("bob", "S3:putobject", "private/a.txt", nil), DecisionAllow},
+		{"alice write", newTestRequest("alice", "s3:PutObject", "private/a.txt", nil), DecisionNotApplicable},
+		{"bob insecure write", newTestRequest("bob", "s3:PutObject", "private/a.txt", map[string][]string{ConditionKeySecureTransport: {"false"}}), DecisionDeny},
+		{"insecure list", newTestRequest("bob", "s3:ListBucket", "", map[string][]string{ConditionKeySecureTransport: {"false"}}), DecisionDeny},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision := policy.Evaluate(test.request)
+			if decision != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, decision)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluateNotElements(t *testing.T) {
+	policy := &Policy{
+		Version: Version20121017,
+		Statements: []Statement{
+			{
+				Sid:          "DenyOthersDelete",
+				Effect:       EffectDeny,
+				NotPrincipal: &Principal{AWS: StringList{"alice"}},
+				Action:       StringList{"s3:DeleteObject"},
+				Resource:     StringList{"arn:aws:s3:::bucket/*"},
+			},
+			{
+				Sid:       "AllowAllButDelete",
+				Effect:    EffectAllow,
+				Principal: &Principal{Wildcard: true},
+				NotAction: StringList{"s3:Delete*"},
+				Resource:  StringList{"arn:aws:s3:::bucket/*"},
+			},
+			{
+				Sid:         "AllowAliceOutsideArchive",
+				Effect:      EffectAllow,
+				Principal:   &Principal{AWS: StringList{"alice"}},
+				Action:      StringList{"s3:*"},
+				NotResource: StringList{"arn:aws:s3:::bucket/archive/*"},
+			},
+		},
+	}
+
+	err := policy.Validate()
+	if err != nil {
+		t.Fatalf("failed to validate policy: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		request  *Request
+		expected Decision
+	}{
+		{"others delete", newTestRequest("bob", "s3:DeleteObject", "a.txt", nil), DecisionDeny},
+		{"alice delete", newTestRequest("alice", "s3:DeleteObject", "a.txt", nil), DecisionAllow},
+		{"alice delete in archive", newTestRequest("alice", "s3:DeleteObject", "archive/a.txt", nil), DecisionNotApplicable},
+		{"others read", newTestRequest("bob", "s3:GetObject", "a.txt", nil), DecisionAllow},
+		{"others delete tagging", newTestRequest("bob", "s3:DeleteObjectTagging", "a.txt", nil), DecisionNotApplicable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision := policy.Evaluate(test.request)
+			if decision != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, decision)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluateError(t *testing.T) {
+	// unsupported operators are rejected by Validate, evaluation fails if it is skipped
+	brokenCondition := Condition{"StringSort": {ConditionKeyUsername: {"alice"}}}
+
+	tests := []struct {
+		name     string
+		effect   Effect
+		expected Decision
+	}{
+		{"broken deny", EffectDeny, DecisionDeny},
+		// the first statement still allows
+		{"broken allow", EffectAllow, DecisionAllow},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := &Policy{
+				Version: Version20121017,
+				Statements: []Statement{
+					{
+						Effect:    EffectAllow,
+						Principal: &Principal{Wildcard: true},
+						Action:    StringList{"s3:GetObject"},
+						Resource:  StringList{"arn:aws:s3:::bucket/*"},
+					},
+					{
+						Effect:    test.effect,
+						Principal: &Principal{Wildcard: true},
+						Action:    StringList{"s3:GetObject"},
+						Resource:  StringList{"arn:aws:s3:::bucket/secret/*"},
+						Condition: brokenCondition,
+					},
+				},
+			}
+
+			requestContext := map[string][]string{ConditionKeyUsername: {"alice"}}
+			decision := policy.Evaluate(newTestRequest("alice", "s3:GetObject", "secret/a.txt", requestContext))
+			if decision != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, decision)
+			}
+		})
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		value    string
+		expected bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"", "", true},
+		{"", "a", false},
+		{"abc", "abc", true},
+		{"abc", "abcd", false},
+		{"a*", "abc", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"*c", "c", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a**c", "ac", true},
+		{"*/public/*", "bucket/public/a", true},
+		{"*/public/*", "bucket/private/a", false},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket", false},
+		{"arn:aws:s3:::bucket*", "arn:aws:s3:::bucket", true},
+		{"日本*", "日本語", true},
+		{"日?語", "日本語", true},
+	}
+
+	for _, test := range tests {
+		matched := matchWildcard(test.pattern, test.value)
+		if matched != test.expected {
+			t.Errorf("matchWildcard(%q, %q): expected %t, got %t", test.pattern, test.value, test.expected, matched)
+		}
+	}
+}
+
+func TestPrincipalMatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal Principal
+		username  string
+		expected  bool
+	}{
+		{"wildcard", Principal{Wildcard: true}, "alice", true},
+		{"AWS wildcard", Principal{AWS: StringList{"*"}}, "alice", true},
+		{"username", Principal{AWS: StringList{"alice"}}, "alice", true},
+		{"user ARN", Principal{AWS: StringList{"arn:aws:iam:::user/alice"}}, "alice", true},
+		{"user ARN wildcard", Principal{AWS: StringList{"arn:aws:iam:::user/al*"}}, "alice", true},
+		{"other user", Principal{AWS: StringList{"bob", "arn:aws:iam:::user/carol"}}, "alice", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matched := test.principal.Matches(test.username)
+			if matched != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, matched)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package policy
+
+import (
+	"encoding/json"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// Version20121017 is the current policy language version
+	Version20121017 = "2012-10-17"
+	// Version20081017 is the previous policy language version
+	Version20081017 = "2008-10-17"
+
+	// ResourceARNPrefix is the prefix of S3 resource ARNs
+	ResourceARNPrefix = "arn:aws:s3:::"
+	// UserARNPrefix is the prefix of IAM user ARNs
+	UserARNPrefix = "arn:aws:iam:::user/"
+)
+
+// Effect is the effect of a statement
+type Effect string
+
+const (
+	// EffectAllow allows access
+	EffectAllow Effect = "Allow"
+	// EffectDeny denies access
+	EffectDeny Effect = "Deny"
+)
+
+// StringList is a list of strings that can be given as a single string or an array in JSON
+type StringList []string
+
+// UnmarshalJSON unmarshals a string or an array of strings
+func (list *StringList) UnmarshalJSON(data []byte) error {
+	var single string
+	err := json.Unmarshal(data, &single)
+	if err == nil {
+		*list = StringList{single}
+		return nil
+	}
+
+	var multi []string
+	err = json.Unmarshal(data, &multi)
+	if err != nil {
+		return xerrors.Errorf("failed to unmarshal a string or an array of strings: %w", err)
+	}
+
+	*list = StringList(multi)
+	return nil
+}
+
+// MarshalJSON marshals a list, a list with a single element is marshalled as a string
+func (list StringList) MarshalJSON() ([]byte, error) {
+	if len(list) == 1 {
+		return json.Marshal(list[0])
+	}
+	return json.Marshal([]string(list))
+}
+
+// Principal is a principal of a statement
+type Principal struct {
+	Wildcard bool
+	AWS      StringList
+}
+
+// UnmarshalJSON unmarshals "*" or {"AWS": ...}
+func (principal *Principal) UnmarshalJSON(data []byte) error {
+	var wildcard string
+	err := json.Unmarshal(data, &wildcard)
+	if err == nil {
+		if wildcard != "*" {
+			return xerrors.Errorf("unknown principal %q", wildcard)
+		}
+
+		principal.Wildcard = true
+		return nil
+	}
+
+	principalMap := map[string]StringList{}
+	err = json.Unmarshal(data, &principalMap)
+	if err != nil {
+		return xerrors.Errorf("failed to unmarshal principal: %w", err)
+	}
+
+	for principalType, principals := range principalMap {
+		if principalType != "AWS" {
+			return xerrors.Errorf("unsupported principal type %q", principalType)
+		}
+
+		principal.AWS = append(principal.AWS, principals...)
+	}
+
+	return nil
+}
+
+// MarshalJSON marshals a principal
+func (principal Principal) MarshalJSON() ([]byte, error) {
+	if principal.Wildcard {
+		return json.Marshal("*")
+	}
+
+	return json.Marshal(map[string]StringList{
+		"AWS": principal.AWS,
+	})
+}
+
+// Matches checks if the principal matches the given username
+func (principal *Principal) Matches(username string) bool {
+	if principal.Wildcard {
+		return true
+	}
+
+	for _, aws := range principal.AWS {
+		if aws == "*" || aws == username {
+			return true
+		}
+
+		if matchWildcard(aws, UserARNPrefix+username) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Statement is a single statement of a policy
+type Statement struct {
+	Sid          string     `json:"Sid,omitempty"`
+	Effect       Effect     `json:"Effect"`
+	Principal    *Principal `json:"Principal,omitempty"`
+	NotPrincipal *Principal `json:"NotPrincipal,omitempty"`
+	Action       StringList `json:"Action,omitempty"`
+	NotAction    StringList `json:"NotAction,omitempty"`
+	Resource     StringList `json:"Resource,omitempty"`
+	NotResource  StringList `json:"NotResource,omitempty"`
+	Condition    Condition  `json:"Condition,omitempty"`
+}
+
+// Policy is a policy document
+type Policy struct {
+	Version    string      `json:"Version"`
+	ID         string      `json:"Id,omitempty"`
+	Statements []Statement `json:"Statement"`
+}
+
+// ParsePolicy parses a policy document in JSON
+func ParsePolicy(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	err := json.Unmarshal(data, policy)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+// ParseBucketPolicy parses a bucket policy document in JSON and validates it against the bucket
+func ParseBucketPolicy(bucket string, data []byte) (*Policy, error) {
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = policy.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, statement := range policy.Statements {
+		if statement.Principal == nil && statement.NotPrincipal == nil {
+			return nil, xerrors.Errorf("statement %q must have a principal", statement.Sid)
+		}
+
+		resources := append(StringList{}, statement.Resource...)
+		resources = append(resources, statement.NotResource...)
+		for _, resource := range resources {
+			if !isBucketResource(bucket, resource) {
+				return nil, xerrors.Errorf("resource %q must be in bucket %q", resource, bucket)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// Validate validates the policy
+func (policy *Policy) Validate() error {
+	if policy.Version != Version20121017 && policy.Version != Version20081017 {
+		return xerrors.Errorf("unsupported policy version %q", policy.Version)
+	}
+
+	if len(policy.Statements) == 0 {
+		return xerrors.Errorf("policy must have at least one statement")
+	}
+
+	for _, statement := range policy.Statements {
+		if statement.Effect != EffectAllow && statement.Effect != EffectDeny {
+			return xerrors.Errorf("invalid effect %q in statement %q", statement.Effect, statement.Sid)
+		}
+
+		if (len(statement.Action) == 0) == (len(statement.NotAction) == 0) {
+			return xerrors.Errorf("statement %q must have either Action or NotAction", statement.Sid)
+		}
+
+		if (len(statement.Resource) == 0) == (len(statement.NotResource) == 0) {
+			return xerrors.Errorf("statement %q must have either Resource or NotResource", statement.Sid)
+		}
+
+		if statement.Principal != nil && statement.NotPrincipal != nil {
+			return xerrors.Errorf("statement %q must not have both Principal and NotPrincipal", statement.Sid)
+		}
+
+		err := statement.Condition.Validate()
+		if err != nil {
+			return xerrors.Errorf("invalid condition in statement %q: %w", statement.Sid, err)
+		}
+	}
+
+	return nil
+}
+
+// JSON returns the policy in compact JSON
+func (policy *Policy) JSON() ([]byte, error) {
+	return json.Marshal(policy)
+}
+
+// GetResource returns a resource ARN for the request target, all buckets when bucket is empty
+func GetResource(bucket string, key string) string {
+	if len(bucket) == 0 {
+		return ResourceARNPrefix + "*"
+	}
+
+	if len(key) == 0 {
+		return GetBucketResource(bucket)
+	}
+
+	return GetObjectResource(bucket, key)
+}
+
+// GetBucketResource returns a resource ARN for the bucket
+func GetBucketResource(bucket string) string {
+	return ResourceARNPrefix + bucket
+}
+
+// GetObjectResource returns a resource ARN for the object
+func GetObjectResource(bucket string, key string) string {
+	return ResourceARNPrefix + bucket + "/" + key
+}
+
+func isBucketResource(bucket string, resource string) bool {
+	bucketResource := GetBucketResource(bucket)
+	if resource == bucketResource {
+		return true
+	}
+
+	if strings.HasPrefix(resource, bucketResource+"/") {
+		return true
+	}
+
+	// e.g., arn:aws:s3:::bucket*
+	if strings.HasPrefix(resource, bucketResource+"*") {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,157 @@
+package s3
+
+import (
+	"net"
+	"strings"
+
+	"github.com/cyverse/s3rods/commons"
+	"github.com/gin-gonic/gin"
+	proxyproto "github.com/pires/go-proxyproto"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// forwardedProtoContextKey is a gin context key of the scheme the client used to reach the proxy
+	forwardedProtoContextKey = "s3rods.forwarded_proto"
+)
+
+// TrustedProxies decides whether to honor headers of reverse proxies
+type TrustedProxies struct {
+	networks []*net.IPNet
+}
+
+// NewTrustedProxies creates TrustedProxies from IPs and CIDRs
+func NewTrustedProxies(proxies []string) (*TrustedProxies, error) {
+	networks, err := commons.ParseTrustedProxies(proxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TrustedProxies{
+		networks: networks,
+	}, nil
+}
+
+// IsTrustedIP checks if the IP is of a trusted proxy
+func (proxies *TrustedProxies) IsTrustedIP(ip net.IP) bool {
+	for _, network := range proxies.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTrustedAddr checks if the peer is a trusted proxy, peers over unix sockets are trusted
+func (proxies *TrustedProxies) IsTrustedAddr(addr net.Addr) bool {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return proxies.IsTrustedIP(addr.IP)
+	case *net.UnixAddr:
+		return true
+	}
+	return false
+}
+
+// wrapProxyProtocolListener reads PROXY protocol headers on connections, the client address becomes RemoteAddr
+// headers are required from trusted proxies and rejected from others, so clients can't spoof their addresses
+func (proxies *TrustedProxies) wrapProxyProtocolListener(listener net.Listener) net.Listener {
+	return &proxyproto.Listener{
+		Listener: listener,
+		Policy: func(upstream net.Addr) (proxyproto.Policy, error) {
+			if proxies.IsTrustedAddr(upstream) {
+				return proxyproto.REQUIRE, nil
+			}
+			return proxyproto.REJECT, nil
+		},
+	}
+}
+
+// getForwardedClientIP returns the client IP in X-Forwarded-For, the rightmost address not of trusted proxies
+// nil is returned if the header is missing or malformed
+func (proxies *TrustedProxies) getForwardedClientIP(forwardedFor []string) net.IP {
+	addresses := []string{}
+	for _, header := range forwardedFor {
+		addresses = append(addresses, strings.Split(header, ",")...)
+	}
+
+	var clientIP net.IP
+	for i := len(addresses) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(addresses[i]))
+		if ip == nil {
+			return nil
+		}
+
+		clientIP = ip
+		if !proxies.IsTrustedIP(ip) {
+			break
+		}
+	}
+
+	return clientIP
+}
+
+// isTrustedPeer checks if the request is sent by a trusted proxy
+func (service *S3Service) isTrustedPeer(c *gin.Context) bool {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			return service.trustedProxies.IsTrustedIP(ip)
+		}
+	}
+
+	// unix socket peers have no addresses
+	listenerConfig := getListenerConfig(c)
+	return listenerConfig != nil && listenerConfig.IsUnixSocket()
+}
+
+// forwardedMiddleware applies X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host of trusted proxies
+// the client IP becomes RemoteAddr and the host becomes Host, so signatures, policies and logs see the client's
+func (service *S3Service) forwardedMiddleware() gin.HandlerFunc {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "forwardedMiddleware",
+	})
+
+	return func(c *gin.Context) {
+		if !service.isTrustedPeer(c) {
+			c.Next()
+			return
+		}
+
+		if forwardedFor := c.Request.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+			clientIP := service.trustedProxies.getForwardedClientIP(forwardedFor)
+			if clientIP != nil {
+				c.Request.RemoteAddr = net.JoinHostPort(clientIP.String(), "0")
+			} else {
+				logger.Debugf("ignoring malformed X-Forwarded-For %q from %s", forwardedFor, c.Request.RemoteAddr)
+			}
+		}
+
+		if forwardedProto := getFirstHeaderValue(c.Request.Header.Get("X-Forwarded-Proto")); len(forwardedProto) > 0 {
+			c.Set(forwardedProtoContextKey, strings.ToLower(forwardedProto))
+		}
+
+		if forwardedHost := getFirstHeaderValue(c.Request.Header.Get("X-Forwarded-Host")); len(forwardedHost) > 0 {
+			c.Request.Host = forwardedHost
+		}
+
+		c.Next()
+	}
+}
+
+// getFirstHeaderValue returns the first of comma-separated values, set by the proxy closest to the client
+func getFirstHeaderValue(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
+
+// isSecureTransport checks if the client connects over TLS, to the service or to a trusted proxy
+func isSecureTransport(c *gin.Context) bool {
+	if forwardedProto := c.GetString(forwardedProtoContextKey); len(forwardedProto) > 0 {
+		return forwardedProto == "https"
+	}
+
+	return c.Request.TLS != nil
+}
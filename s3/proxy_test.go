@@ -0,0 +1,38 @@
+package s3
+
+import (
+	"net"
+	"testing"
+)
+
+func TestGetForwardedClientIP(t *testing.T) {
+	proxies, err := NewTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("failed to create trusted proxies: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		forwardedFor []string
+		expected     net.IP
+	}{
+		{"client only", []string{"203.0.113.7"}, net.ParseIP("203.0.113.7")},
+		{"trusted chain", []string{"203.0.113.7, 10.0.0.2, 192.168.1.1"}, net.ParseIP("203.0.113.7")},
+		{"spoofed leftmost", []string{"1.2.3.4, 203.0.113.7, 10.0.0.2"}, net.ParseIP("203.0.113.7")},
+		{"multiple headers", []string{"1.2.3.4", "203.0.113.7, 10.0.0.2"}, net.ParseIP("203.0.113.7")},
+		{"all trusted", []string{"10.0.0.3, 10.0.0.2"}, net.ParseIP("10.0.0.3")},
+		{"IPv6", []string{"2001:db8::1, 10.0.0.2"}, net.ParseIP("2001:db8::1")},
+		{"malformed", []string{"203.0.113.7, unknown"}, nil},
+		{"malformed behind client", []string{"unknown, 203.0.113.7"}, net.ParseIP("203.0.113.7")},
+		{"empty", []string{}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ip := proxies.getForwardedClientIP(test.forwardedFor)
+			if !ip.Equal(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, ip)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package s3
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/cyverse/s3rods/irods"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// getWriteSize returns bytes the request writes, the payload size or the size of the copy source
+func (service *S3Service) getWriteSize(c *gin.Context, credential *AWSCredential, operation S3Operation) (int64, error) {
+	switch operation.Name {
+	case "PutObject", "UploadPart":
+		// aws-chunked payloads carry the object size separately
+		if decodedLength := c.GetHeader("X-Amz-Decoded-Content-Length"); len(decodedLength) > 0 {
+			size, err := strconv.ParseInt(decodedLength, 10, 64)
+			if err != nil {
+				return 0, ErrInvalidArgument.WithMessage("X-Amz-Decoded-Content-Length is invalid")
+			}
+			return size, nil
+		}
+
+		if c.Request.ContentLength < 0 {
+			return 0, ErrMissingContentLength
+		}
+		return c.Request.ContentLength, nil
+	case "CopyObject", "UploadPartCopy":
+		copySource := strings.TrimPrefix(c.GetHeader("X-Amz-Copy-Source"), "/")
+		if versionIdx := strings.Index(copySource, "?"); versionIdx >= 0 {
+			copySource = copySource[:versionIdx]
+		}
+
+		sourceBucket, sourceKey := splitBucketKey("/" + copySource)
+		if len(sourceBucket) == 0 || len(sourceKey) == 0 {
+			return 0, ErrInvalidArgument.WithMessage("X-Amz-Copy-Source is invalid")
+		}
+
+		// the caller must be able to read the source, or errors tell if others' objects exist
+		sourceOperation := newS3Operation("GetObject", "s3:GetObject", sourceBucket, sourceKey)
+		err := service.authorizeCopySource(c, credential, sourceOperation)
+		if err != nil {
+			return 0, err
+		}
+
+		size, err := service.irodsController.GetObjectSize(c.Request.Context(), credential.Username, credential.Ticket, sourceBucket, sourceKey)
+		if err != nil {
+			if irodsclient_types.IsFileNotFoundError(err) {
+				return 0, ErrNoSuchKey
+			}
+			return 0, err
+		}
+
+		if copyRange := c.GetHeader("X-Amz-Copy-Source-Range"); operation.Name == "UploadPartCopy" && len(copyRange) > 0 {
+			// bytes=first-last, only checked after the source is authorized
+			var first, last int64
+			_, err := fmt.Sscanf(copyRange, "bytes=%d-%d", &first, &last)
+			if err != nil || first < 0 || last < first || last >= size {
+				return 0, ErrInvalidArgument.WithMessage("X-Amz-Copy-Source-Range is invalid")
+			}
+			return last - first + 1, nil
+		}
+		return size, nil
+	}
+
+	return 0, nil
+}
+
+// authorizeCopySource authorizes reading the copy source, keeping the policy decision of the request
+func (service *S3Service) authorizeCopySource(c *gin.Context, credential *AWSCredential, sourceOperation S3Operation) error {
+	decision, hasDecision := c.Get(policyDecisionContextKey)
+
+	_, err := service.authorizeRequest(c, credential, sourceOperation)
+
+	if hasDecision {
+		c.Set(policyDecisionContextKey, decision)
+	}
+	return err
+}
+
+// checkQuota rejects writes exceeding quotas of the user, writes with tickets are charged to the ticket owner
+func (service *S3Service) checkQuota(c *gin.Context, credential *AWSCredential, operation S3Operation) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "checkQuota",
+	})
+
+	switch operation.Name {
+	case "PutObject", "UploadPart", "CopyObject", "UploadPartCopy":
+	default:
+		return nil
+	}
+
+	username := credential.Username
+	if ticketValue, ok := c.Get(ticketContextKey); ok {
+		username = ticketValue.(*irods.Ticket).Owner
+	}
+
+	if service.config.IsAdminUser(username) {
+		return nil
+	}
+
+	size, err := service.getWriteSize(c, credential, operation)
+	if err != nil {
+		return err
+	}
+
+	err = service.irodsController.CheckUserQuota(c.Request.Context(), username, size)
+	if err != nil {
+		if xerrors.Is(err, irods.ErrQuotaExceeded) {
+			logger.Infof("rejected %s of %d bytes: %s", operation.Name, size, err.Error())
+			return ErrQuotaExceeded
+		}
+		return err
+	}
+
+	return nil
+}
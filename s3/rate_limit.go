@@ -0,0 +1,287 @@
+package s3
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// rateLimitIdleTimeout is the time after which an unused limiter entry is dropped
+	rateLimitIdleTimeout = 10 * time.Minute
+	// rateLimitCleanupInterval is the interval of dropping idle limiter entries
+	rateLimitCleanupInterval = 1 * time.Minute
+
+	// userRateLimitContextKey is the access key holding a request slot of the user rate limiter
+	userRateLimitContextKey = "s3rods.user_rate_limit"
+)
+
+// tokenBucket is a token bucket refilled at rate tokens per second up to burst tokens
+type tokenBucket struct {
+	rate       float64
+	burst      float64
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:       rate,
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		lastRefill: time.Now(),
+	}
+}
+
+// setLimits changes the rate and the burst, tokens above the new burst are dropped
+func (bucket *tokenBucket) setLimits(rate float64, burst int) {
+	if burst <= 0 {
+		burst = 1
+	}
+
+	bucket.refill(time.Now())
+	bucket.rate = rate
+	bucket.burst = float64(burst)
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+}
+
+func (bucket *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(bucket.lastRefill).Seconds()
+	if elapsed > 0 {
+		bucket.tokens += elapsed * bucket.rate
+		if bucket.tokens > bucket.burst {
+			bucket.tokens = bucket.burst
+		}
+	}
+	bucket.lastRefill = now
+}
+
+// take takes n tokens if available
+func (bucket *tokenBucket) take(n float64) bool {
+	bucket.refill(time.Now())
+
+	if bucket.tokens < n {
+		return false
+	}
+
+	bucket.tokens -= n
+	return true
+}
+
+// reserve takes n tokens, going into debt if not available, and returns how long to wait until the debt is paid
+func (bucket *tokenBucket) reserve(n float64) time.Duration {
+	bucket.refill(time.Now())
+
+	bucket.tokens -= n
+	if bucket.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+type rateLimitEntry struct {
+	bucket         *tokenBucket
+	inflight       int
+	lastAccessTime time.Time
+}
+
+// RateLimiter limits request rates and concurrent requests per key, e.g., access key or client IP
+type RateLimiter struct {
+	rate          float64
+	burst         int
+	maxConcurrent int
+	entries       map[string]*rateLimitEntry
+	terminated    bool
+	terminate     chan bool
+	mutex         sync.Mutex
+}
+
+// NewRateLimiter creates a new RateLimiter, zero rate or maxConcurrent disables the limit
+func NewRateLimiter(rate float64, burst int, maxConcurrent int) *RateLimiter {
+	limiter := &RateLimiter{
+		rate:          rate,
+		burst:         burst,
+		maxConcurrent: maxConcurrent,
+		entries:       map[string]*rateLimitEntry{},
+		terminated:    false,
+		terminate:     make(chan bool),
+	}
+
+	go limiter.cleanupIdleEntries()
+
+	return limiter
+}
+
+// IsEnabled checks if any limit is set
+func (limiter *RateLimiter) IsEnabled() bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	return limiter.rate > 0 || limiter.maxConcurrent > 0
+}
+
+// SetLimits changes limits, applied to keys being limited at once
+func (limiter *RateLimiter) SetLimits(rate float64, burst int, maxConcurrent int) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	limiter.rate = rate
+	limiter.burst = burst
+	limiter.maxConcurrent = maxConcurrent
+
+	for _, entry := range limiter.entries {
+		switch {
+		case rate <= 0:
+			entry.bucket = nil
+		case entry.bucket == nil:
+			entry.bucket = newTokenBucket(rate, burst)
+		default:
+			entry.bucket.setLimits(rate, burst)
+		}
+	}
+}
+
+// Release stops the limiter
+func (limiter *RateLimiter) Release() {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if !limiter.terminated {
+		limiter.terminated = true
+		close(limiter.terminate)
+	}
+}
+
+// Acquire takes a request slot for the key, returns false if the rate or the concurrency limit is reached
+// a successful Acquire must be followed by Done
+func (limiter *RateLimiter) Acquire(key string) bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	entry, ok := limiter.entries[key]
+	if !ok {
+		entry = &rateLimitEntry{}
+		if limiter.rate > 0 {
+			entry.bucket = newTokenBucket(limiter.rate, limiter.burst)
+		}
+		limiter.entries[key] = entry
+	}
+
+	entry.lastAccessTime = time.Now()
+
+	if limiter.maxConcurrent > 0 && entry.inflight >= limiter.maxConcurrent {
+		return false
+	}
+
+	if entry.bucket != nil && !entry.bucket.take(1) {
+		return false
+	}
+
+	entry.inflight++
+	return true
+}
+
+// Done releases a request slot taken by Acquire
+func (limiter *RateLimiter) Done(key string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if entry, ok := limiter.entries[key]; ok && entry.inflight > 0 {
+		entry.inflight--
+		entry.lastAccessTime = time.Now()
+	}
+}
+
+func (limiter *RateLimiter) cleanupIdleEntries() {
+	ticker := time.NewTicker(rateLimitCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-limiter.terminate:
+			return
+		case <-ticker.C:
+			limiter.mutex.Lock()
+			for key, entry := range limiter.entries {
+				if entry.inflight == 0 && time.Since(entry.lastAccessTime) > rateLimitIdleTimeout {
+					delete(limiter.entries, key)
+				}
+			}
+			limiter.mutex.Unlock()
+		}
+	}
+}
+
+// rateLimitMiddleware rejects requests exceeding limits per client IP with SlowDown
+// limits per access key are applied on authentication, unverified access keys must not use up budgets of others
+func (service *S3Service) rateLimitMiddleware() gin.HandlerFunc {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "rateLimitMiddleware",
+	})
+
+	return func(c *gin.Context) {
+		if isHealthPath(c.Request.URL.Path) {
+			// load balancers probing must not be throttled into marking the instance down
+			c.Next()
+			return
+		}
+
+		clientIP := c.ClientIP()
+		if service.ipRateLimiter.IsEnabled() {
+			if !service.ipRateLimiter.Acquire(clientIP) {
+				logger.Debugf("rate limit reached for client %s", clientIP)
+				service.writeSlowDown(c)
+				return
+			}
+			defer service.ipRateLimiter.Done(clientIP)
+		}
+
+		// the user slot is taken on authentication, released even if the handler panics
+		defer func() {
+			if accessKey := c.GetString(userRateLimitContextKey); len(accessKey) > 0 {
+				service.userRateLimiter.Done(accessKey)
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+// acquireUserRateLimit takes a request slot for the authenticated access key, released when the request is served
+func (service *S3Service) acquireUserRateLimit(c *gin.Context, credential *AWSCredential) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "acquireUserRateLimit",
+	})
+
+	if !service.userRateLimiter.IsEnabled() || len(c.GetString(userRateLimitContextKey)) > 0 {
+		return nil
+	}
+
+	if !service.userRateLimiter.Acquire(credential.AccessKey) {
+		logger.Debugf("rate limit reached for access key %s", getRedactedAccessKey(credential.AccessKey))
+		c.Header("Retry-After", "1")
+		return ErrSlowDown
+	}
+
+	c.Set(userRateLimitContextKey, credential.AccessKey)
+	return nil
+}
+
+func (service *S3Service) writeSlowDown(c *gin.Context) {
+	c.Header("Retry-After", "1")
+	service.writeError(c, ErrSlowDown)
+	c.Abort()
+}
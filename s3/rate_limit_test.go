@@ -0,0 +1,185 @@
+package s3
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyverse/s3rods/commons"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		burst    int
+		start    float64
+		elapsed  time.Duration
+		take     float64
+		expected bool
+		left     float64
+	}{
+		{"within burst", 1, 5, 5, 0, 5, true, 0},
+		{"over burst", 1, 5, 5, 0, 6, false, 5},
+		{"empty", 1, 5, 0, 0, 1, false, 0},
+		{"refilled", 2, 5, 0, 2 * time.Second, 1, true, 3},
+		{"refill capped at burst", 10, 5, 0, time.Minute, 5, true, 0},
+		{"zero burst allows one", 1, 0, 1, 0, 1, true, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bucket := newTokenBucket(test.rate, test.burst)
+			bucket.tokens = test.start
+			bucket.lastRefill = time.Now().Add(-test.elapsed)
+
+			if ok := bucket.take(test.take); ok != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, ok)
+			}
+
+			// allow refills for the time the test takes
+			if bucket.tokens < test.left || bucket.tokens > test.left+0.1 {
+				t.Errorf("expected %v tokens left, got %v", test.left, bucket.tokens)
+			}
+		})
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	bucket := newTokenBucket(1024, 1024)
+
+	if wait := bucket.reserve(1024); wait != 0 {
+		t.Errorf("expected no wait within burst, got %v", wait)
+	}
+
+	// 512 tokens in debt at 1024 tokens per second
+	wait := bucket.reserve(512)
+	if wait < 400*time.Millisecond || wait > 500*time.Millisecond {
+		t.Errorf("expected about 500ms, got %v", wait)
+	}
+
+	bucket.setLimits(1024, 256)
+	if bucket.burst != 256 || bucket.tokens > 256 {
+		t.Errorf("expected tokens capped at the new burst, got %v of %v", bucket.tokens, bucket.burst)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name          string
+		rate          float64
+		burst         int
+		maxConcurrent int
+		done          bool
+		expected      []bool
+	}{
+		{"disabled", 0, 0, 0, false, []bool{true, true, true, true}},
+		{"concurrency", 0, 0, 2, false, []bool{true, true, false, false}},
+		{"concurrency released", 0, 0, 2, true, []bool{true, true, true, true}},
+		{"rate", 0.001, 2, 0, true, []bool{true, true, false, false}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewRateLimiter(test.rate, test.burst, test.maxConcurrent)
+			defer limiter.Release()
+
+			for idx, expected := range test.expected {
+				ok := limiter.Acquire("alice")
+				if ok != expected {
+					t.Errorf("request %d: expected %t, got %t", idx, expected, ok)
+				}
+
+				if ok && test.done {
+					limiter.Done("alice")
+				}
+			}
+
+			if !limiter.Acquire("bob") {
+				t.Errorf("limits of other keys must not be shared")
+			}
+		})
+	}
+}
+
+func TestRateLimiterConcurrentAcquire(t *testing.T) {
+	limiter := NewRateLimiter(0, 0, 5)
+	defer limiter.Release()
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	acquired := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limiter.Acquire("alice") {
+				mutex.Lock()
+				acquired++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 5 {
+		t.Errorf("expected 5 slots, got %d", acquired)
+	}
+
+	// extra Done calls must not free slots that were never taken
+	for i := 0; i < 10; i++ {
+		limiter.Done("alice")
+	}
+
+	if limiter.entries["alice"].inflight != 0 {
+		t.Errorf("expected no slot in use, got %d", limiter.entries["alice"].inflight)
+	}
+
+	limiter.SetLimits(0, 0, 1)
+	if !limiter.Acquire("alice") || limiter.Acquire("alice") {
+		t.Errorf("new concurrency limit is not applied")
+	}
+}
+
+func TestRateLimitMiddlewareReleasesOnPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	service := &S3Service{
+		config:          commons.NewDefaultConfig(),
+		ipRateLimiter:   NewRateLimiter(0, 0, 0),
+		userRateLimiter: NewRateLimiter(0, 0, 1),
+	}
+	defer service.ipRateLimiter.Release()
+	defer service.userRateLimiter.Release()
+
+	credential := &AWSCredential{AccessKey: "alice", Username: "alice"}
+
+	router := gin.New()
+	router.Use(gin.RecoveryWithWriter(io.Discard), service.rateLimitMiddleware())
+	router.GET("/panic", func(c *gin.Context) {
+		err := service.acquireUserRateLimit(c, credential)
+		if err != nil {
+			service.writeError(c, err)
+			return
+		}
+		panic("handler failed")
+	})
+
+	for i := 0; i < 3; i++ {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+		// SlowDown would be returned if the slot of the previous request was not released
+		if recorder.Code != http.StatusInternalServerError {
+			t.Fatalf("request %d: expected %d, got %d", i, http.StatusInternalServerError, recorder.Code)
+		}
+	}
+
+	if inflight := service.userRateLimiter.entries["alice"].inflight; inflight != 0 {
+		t.Errorf("expected no slot in use, got %d", inflight)
+	}
+}
@@ -2,23 +2,45 @@ package s3
 
 import (
 	"context"
-	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/cyverse/s3rods/commons"
 	"github.com/cyverse/s3rods/irods"
+	"github.com/cyverse/s3rods/s3/oidc"
+	"github.com/cyverse/s3rods/s3/sts"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
 )
 
 // S3Service is a service object
 type S3Service struct {
 	config          *commons.Config
 	irodsController *irods.IrodsController
-	address         string
 	router          *gin.Engine
-	httpServer      *http.Server
+	listeners       []*serviceListener
+	trustedProxies  *TrustedProxies
+	stsIssuer       *sts.Issuer
+	oidcVerifier    *oidc.Verifier
+	authCache       *AuthCache
+	userRateLimiter *RateLimiter
+	ipRateLimiter   *RateLimiter
+
+	bandwidthLimiter *BandwidthLimiter
+	metrics          *Metrics
+	accessLogger     *AccessLogger
+	auditLogger      *AuditLogger
+
+	bucketLogDelivery   *BucketLogDelivery
+	certificateReloader *CertificateReloader
+	reloadMutex         sync.Mutex
+
+	inFlightTracker *InFlightTracker
+	// requestContext is the base of request contexts, canceled to cut off requests on shutdown
+	requestContext context.Context
+	cancelRequests context.CancelFunc
 }
 
 // Start starts a new S3 service
@@ -28,36 +50,207 @@ func Start(config *commons.Config, irodsController *irods.IrodsController) (*S3S
 		"function": "Start",
 	})
 
-	addr := fmt.Sprintf(":%d", config.Port)
-	router := gin.Default()
+	// same as gin.Default(), but credentials in query strings are not logged
+	router := gin.New()
+	router.Use(gin.LoggerWithFormatter(redactedLogFormatter), gin.Recovery())
+
+	stsKey, err := sts.LoadOrCreateSigningKey(config.GetStsKeyPath())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load STS signing key: %w", err)
+	}
 
 	service := &S3Service{
 		config:          config,
 		irodsController: irodsController,
-		address:         addr,
 		router:          router,
-		httpServer: &http.Server{
-			Addr:    addr,
-			Handler: router,
-		},
+		stsIssuer:       sts.NewIssuer(stsKey),
+		authCache:       NewAuthCache(config.AuthCacheTimeout, config.AuthNegativeCacheTimeout),
+		userRateLimiter: NewRateLimiter(config.RateLimitPerUser, config.RateLimitBurstPerUser, config.MaxConcurrentRequestsPerUser),
+		ipRateLimiter:   NewRateLimiter(config.RateLimitPerIP, config.RateLimitBurstPerIP, config.MaxConcurrentRequestsPerIP),
+
+		bandwidthLimiter: NewBandwidthLimiter(config.BandwidthLimit, config.BandwidthBurst, config.BandwidthLimitPerUser, config.BandwidthBurstPerUser),
+	}
+
+	trustedProxies, err := NewTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	service.trustedProxies = trustedProxies
+
+	// X-Forwarded-* headers are applied by forwardedMiddleware for trusted proxies only
+	err = router.SetTrustedProxies(nil)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to set trusted proxies: %w", err)
+	}
+
+	service.inFlightTracker = NewInFlightTracker()
+	service.requestContext, service.cancelRequests = context.WithCancel(context.Background())
+
+	service.metrics = NewMetrics(service)
+	service.bucketLogDelivery = NewBucketLogDelivery(irodsController, config.BucketLoggingFlushInterval)
+
+	service.auditLogger = NewAuditLogger(config.GetAdminAuditLogFilePath())
+
+	if len(config.AccessLogPath) > 0 {
+		service.accessLogger = NewAccessLogger(config.AccessLogPath)
+		logger.Infof("Writing access logs to %s", config.AccessLogPath)
+	}
+
+	if config.IsOidcEnabled() {
+		var keySet oidc.KeySet
+		if len(config.OidcJwksPath) > 0 {
+			staticKeySet, err := oidc.NewStaticKeySetFromFile(config.OidcJwksPath)
+			if err != nil {
+				return nil, xerrors.Errorf("failed to load OIDC JWKS: %w", err)
+			}
+			keySet = staticKeySet
+		} else {
+			keySet = oidc.NewRemoteKeySet(config.OidcJwksURL)
+		}
+
+		service.oidcVerifier = oidc.NewVerifier(keySet, config.OidcIssuer, config.OidcAudience)
+		logger.Infof("Trusting OIDC provider %s", config.OidcIssuer)
+	}
+
+	if config.IsTlsEnabled() {
+		reloader, err := NewCertificateReloader(config.TlsCertPath, config.TlsKeyPath)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to load TLS certificate: %w", err)
+		}
+		service.certificateReloader = reloader
 	}
 
 	// setup HTTP request router
 	service.setupRouter()
 
-	fmt.Printf("Starting S3 service at %s\n", service.address)
-	logger.Infof("Starting S3 service at %s", service.address)
-	// listen and serve in background
-	go func() {
-		err := service.httpServer.ListenAndServe()
+	// bind before returning, so the service is ready to accept connections
+	systemdListeners, err := getSystemdListeners()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, listenerConfig := range config.GetListeners() {
+		listener, err := listen(listenerConfig, systemdListeners)
 		if err != nil {
-			logger.Fatal(err)
+			for _, serviceListener := range service.listeners {
+				serviceListener.listener.Close()
+			}
+			return nil, err
+		}
+
+		if listenerConfig.ProxyProtocol {
+			listener = service.trustedProxies.wrapProxyProtocolListener(listener)
+		}
+
+		service.listeners = append(service.listeners, service.newServiceListener(listenerConfig, listener))
+	}
+
+	adminServed := false
+	for _, serviceListener := range service.listeners {
+		if serviceListener.config.IsAdminServed() {
+			adminServed = true
 		}
-	}()
+	}
+
+	if !adminServed {
+		logger.Info("Admin endpoints and metrics are not served, add a listener with role admin to serve them")
+	}
+
+	for key, listener := range systemdListeners {
+		logger.Warnf("Ignoring socket %s passed by systemd, %s is not served", listener.Addr().String(), key)
+		listener.Close()
+	}
+
+	for _, serviceListener := range service.listeners {
+		serviceListener.serve()
+	}
+
+	watchdogInterval := commons.GetSystemdWatchdogInterval()
+	if watchdogInterval > 0 {
+		go service.watchdog(watchdogInterval)
+	}
 
 	return service, nil
 }
 
+// ReloadCertificate reloads the TLS certificate from files
+func (service *S3Service) ReloadCertificate() error {
+	if service.certificateReloader == nil {
+		return nil
+	}
+
+	return service.certificateReloader.Reload()
+}
+
+// drain stops accepting requests and waits for in-flight requests until the shutdown timeout
+// requests still running are canceled and their connections are closed, returns requests cut off
+func (service *S3Service) drain() []*InFlightRequest {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "drain",
+	})
+
+	logger.Infof("Draining %d in-flight requests, waiting up to %s", service.inFlightTracker.Count(), service.config.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), service.config.ShutdownTimeout)
+	defer cancel()
+
+	// listeners are closed at once, then servers wait for their connections together
+	wg := sync.WaitGroup{}
+	for _, serviceListener := range service.listeners {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			server.Shutdown(ctx)
+		}(serviceListener.server)
+	}
+	wg.Wait()
+
+	if ctx.Err() == nil {
+		return nil
+	}
+
+	cutOff := service.inFlightTracker.List()
+
+	// handlers and iRODS calls see their contexts canceled and clean up, e.g., partial uploads
+	service.cancelRequests()
+	for _, serviceListener := range service.listeners {
+		serviceListener.server.Close()
+	}
+
+	// give handlers time to clean up before iRODS connections are released
+	cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), inFlightCleanupTimeout)
+	defer cleanupCancel()
+
+	if !service.inFlightTracker.Wait(cleanupCtx) {
+		logger.Warnf("%d requests did not return in %s after being cut off", service.inFlightTracker.Count(), inFlightCleanupTimeout)
+	}
+
+	return cutOff
+}
+
+// reportCutOffRequests logs requests cut off on shutdown
+func reportCutOffRequests(requests []*InFlightRequest) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"function": "reportCutOffRequests",
+	})
+
+	uploads := 0
+	for _, request := range requests {
+		if request.IsUpload() {
+			uploads++
+		}
+
+		logger.Warnf("cut off request %s - operation %s, bucket %q, key %q, user %q, client %s, content length %d, running %s, upload %t",
+			request.RequestID, request.Operation, request.Bucket, request.Key, request.GetUsername(), request.RemoteIP,
+			request.ContentLength, time.Since(request.StartTime).Round(time.Millisecond), request.IsUpload())
+	}
+
+	logger.Warnf("cut off %d requests including %d uploads on shutdown", len(requests), uploads)
+}
+
 // Stop stops the service
 func (service *S3Service) Stop() error {
 	logger := log.WithFields(log.Fields{
@@ -67,11 +260,34 @@ func (service *S3Service) Stop() error {
 	})
 
 	logger.Infof("Stopping S3 service\n")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 
-	err := service.httpServer.Shutdown(ctx)
-	if err != nil {
+	cutOff := service.drain()
+	if len(cutOff) > 0 {
+		reportCutOffRequests(cutOff)
+	}
+
+	// release contexts of requests finished
+	service.cancelRequests()
+
+	if service.certificateReloader != nil {
+		service.certificateReloader.Release()
+	}
+
+	service.userRateLimiter.Release()
+	service.ipRateLimiter.Release()
+	service.bandwidthLimiter.Release()
+
+	// write access logs buffered before iRODS connections are released
+	service.bucketLogDelivery.Release()
+
+	if service.accessLogger != nil {
+		service.accessLogger.Release()
+	}
+
+	service.auditLogger.Release()
+
+	if len(cutOff) > 0 {
+		err := xerrors.Errorf("cut off %d requests on shutdown", len(cutOff))
 		logger.Error(err)
 		return err
 	}
@@ -0,0 +1,514 @@
+package s3
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/cyverse/s3rods/s3/oidc"
+	"github.com/cyverse/s3rods/s3/policy"
+	"github.com/cyverse/s3rods/s3/sts"
+	"github.com/cyverse/s3rods/s3/types"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	sessionContextKey = "s3rods.session"
+
+	// stsRequestBodyMax is the max size of a form-encoded STS request body
+	stsRequestBodyMax = 64 * 1024
+	// stsSessionPolicySizeMax is the max size of an inline session policy, same as AWS STS
+	stsSessionPolicySizeMax = 2048
+
+	// webIdentityTokenSizeMax is the max size of a web identity token, same as AWS STS
+	webIdentityTokenSizeMax = 20000
+
+	stsDurationMin          = 15 * time.Minute
+	stsAssumeRoleDuration   = 1 * time.Hour
+	stsSessionTokenDuration = 12 * time.Hour
+)
+
+var (
+	// e.g., arn:aws:iam::123456789012:role/name
+	roleArnRegexp         = regexp.MustCompile(`^arn:aws:iam::[0-9]*:role/([\w+=,.@/-]{1,64})$`)
+	roleSessionNameRegexp = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+	irodsUsernameRegexp   = regexp.MustCompile(`^[\w.@-]{1,63}$`)
+)
+
+// verifySessionToken verifies the session token of a request signed with temporary credentials
+func (service *S3Service) verifySessionToken(c *gin.Context, credential *AWSCredential) (*sts.Claims, error) {
+	sessionToken := getSecurityToken(c.Request)
+	if len(sessionToken) == 0 {
+		return nil, ErrInvalidToken.WithMessage("The security token included in the request is missing.")
+	}
+
+	claims, err := service.stsIssuer.Verify(sessionToken)
+	if err != nil {
+		if xerrors.Is(err, sts.ErrExpiredToken) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if claims.AccessKeyID != credential.AccessKey {
+		return nil, ErrInvalidToken.WithMessage("The security token does not match the access key.")
+	}
+
+	return claims, nil
+}
+
+// authorizeSessionRequest evaluates the inline session policy of temporary credentials
+// session policies can only narrow down permissions, so anything not explicitly allowed is denied
+func (service *S3Service) authorizeSessionRequest(c *gin.Context, credential *AWSCredential, claims *sts.Claims, operation S3Operation) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "authorizeSessionRequest",
+	})
+
+	if len(claims.Policy) == 0 {
+		return nil
+	}
+
+	sessionPolicy, err := policy.ParsePolicy([]byte(claims.Policy))
+	if err != nil {
+		return xerrors.Errorf("failed to parse session policy: %w", err)
+	}
+
+	policyRequest := &policy.Request{
+		Username: credential.Username,
+		Action:   operation.Action,
+		Resource: policy.GetResource(operation.Bucket, operation.Key),
+		Context:  service.getPolicyConditionContext(c, credential),
+	}
+
+	decision := sessionPolicy.Evaluate(policyRequest)
+	logger.Debugf("session policy decision for %s on %s by %s: %s", policyRequest.Action, policyRequest.Resource, policyRequest.Username, decision)
+
+	if decision != policy.DecisionAllow {
+		return ErrAccessDenied
+	}
+
+	return nil
+}
+
+// stsRequestBody is an STS request body buffered in memory
+// the body is read once, then shared by parameter parsing and signature checks
+type stsRequestBody struct {
+	*bytes.Reader
+	data []byte
+}
+
+// Close does nothing, the original body is closed when buffered
+func (body *stsRequestBody) Close() error {
+	return nil
+}
+
+// readSTSRequestBody returns the STS request body up to stsRequestBodyMax bytes
+// the body is buffered on the first call, later calls return the buffered body
+func readSTSRequestBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return []byte{}, nil
+	}
+
+	if buffered, ok := request.Body.(*stsRequestBody); ok {
+		return buffered.data, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(request.Body, stsRequestBodyMax+1))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read request body: %w", err)
+	}
+
+	if len(data) > stsRequestBodyMax {
+		return nil, ErrInvalidParameterValue.WithMessage("Request body exceeds the maximum allowed size")
+	}
+
+	request.Body.Close()
+	request.Body = &stsRequestBody{
+		Reader: bytes.NewReader(data),
+		data:   data,
+	}
+
+	return data, nil
+}
+
+// getSTSParams returns STS request parameters from both the query and the form-encoded body
+func getSTSParams(request *http.Request) (url.Values, error) {
+	params := request.URL.Query()
+
+	if request.Method != http.MethodPost {
+		return params, nil
+	}
+
+	body, err := readSTSRequestBody(request)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyParams, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, ErrInvalidParameterValue.WithMessage("Request body is not a valid form")
+	}
+
+	for key, values := range bodyParams {
+		params[key] = append(params[key], values...)
+	}
+
+	return params, nil
+}
+
+// getSTSDuration parses DurationSeconds parameter
+func (service *S3Service) getSTSDuration(params url.Values, defaultDuration time.Duration) (time.Duration, error) {
+	durationMax := service.config.StsDurationMax
+	if defaultDuration > durationMax {
+		defaultDuration = durationMax
+	}
+
+	durationString := params.Get("DurationSeconds")
+	if len(durationString) == 0 {
+		return defaultDuration, nil
+	}
+
+	durationSeconds, err := strconv.ParseInt(durationString, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidParameterValue.WithMessage("DurationSeconds must be an integer")
+	}
+
+	duration := time.Duration(durationSeconds) * time.Second
+	if duration < stsDurationMin || duration > durationMax {
+		return 0, ErrInvalidParameterValue.WithMessage("DurationSeconds must be between %d and %d", int64(stsDurationMin.Seconds()), int64(durationMax.Seconds()))
+	}
+
+	return duration, nil
+}
+
+// getSessionPolicy parses and validates the inline session policy parameter
+func getSessionPolicy(params url.Values) (string, error) {
+	policyString := params.Get("Policy")
+	if len(policyString) == 0 {
+		return "", nil
+	}
+
+	if len(policyString) > stsSessionPolicySizeMax {
+		return "", ErrPackedPolicyTooLarge
+	}
+
+	sessionPolicy, err := policy.ParsePolicy([]byte(policyString))
+	if err != nil {
+		return "", ErrMalformedPolicyDocument.WithMessage("%s", err.Error())
+	}
+
+	err = sessionPolicy.Validate()
+	if err != nil {
+		return "", ErrMalformedPolicyDocument.WithMessage("%s", err.Error())
+	}
+
+	policyBytes, err := sessionPolicy.JSON()
+	if err != nil {
+		return "", err
+	}
+
+	return string(policyBytes), nil
+}
+
+// getRoleParams parses RoleArn and RoleSessionName parameters
+func getRoleParams(params url.Values) (string, string, string, error) {
+	roleArn := params.Get("RoleArn")
+	if len(roleArn) == 0 {
+		return "", "", "", ErrMissingParameter.WithMessage("RoleArn is not given")
+	}
+
+	roleArnMatches := roleArnRegexp.FindStringSubmatch(roleArn)
+	if roleArnMatches == nil {
+		return "", "", "", ErrInvalidParameterValue.WithMessage("RoleArn %q is invalid", roleArn)
+	}
+
+	roleSessionName := params.Get("RoleSessionName")
+	if len(roleSessionName) == 0 {
+		return "", "", "", ErrMissingParameter.WithMessage("RoleSessionName is not given")
+	}
+
+	if !roleSessionNameRegexp.MatchString(roleSessionName) {
+		return "", "", "", ErrInvalidParameterValue.WithMessage("RoleSessionName %q is invalid", roleSessionName)
+	}
+
+	return roleArn, roleArnMatches[1], roleSessionName, nil
+}
+
+func getAssumedRoleArn(roleName string, roleSessionName string) string {
+	return "arn:aws:sts:::assumed-role/" + roleName + "/" + roleSessionName
+}
+
+func (service *S3Service) handleSTS(c *gin.Context) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleSTS",
+	})
+
+	logger.Infof("access request to %s", getRedactedRequestURI(c.Request.URL))
+
+	params, err := getSTSParams(c.Request)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	action := params.Get("Action")
+	switch action {
+	case "AssumeRole":
+		service.handleAssumeRole(c, params)
+	case "AssumeRoleWithWebIdentity":
+		service.handleAssumeRoleWithWebIdentity(c, params)
+	case "GetSessionToken":
+		service.handleGetSessionToken(c, params)
+	case "":
+		service.writeSTSError(c, ErrMissingParameter.WithMessage("Action is not given"))
+	default:
+		service.writeSTSError(c, ErrInvalidAction.WithMessage("Could not find operation %s", action))
+	}
+}
+
+// authenticateSTSUser authenticates a user requesting temporary credentials
+// only long-term credentials of iRODS users can request temporary credentials
+func (service *S3Service) authenticateSTSUser(c *gin.Context) (*AWSCredential, error) {
+	credential, err := service.authenticateUser(c, serviceTypeSTS)
+	if err != nil {
+		return nil, toAuthError(err)
+	}
+
+	if len(credential.Ticket) > 0 {
+		return nil, ErrAccessDenied.WithMessage("Tickets cannot be used to request temporary credentials")
+	}
+
+	if _, ok := c.Get(sessionContextKey); ok {
+		return nil, ErrAccessDenied.WithMessage("Temporary credentials cannot be used to request temporary credentials")
+	}
+
+	return credential, nil
+}
+
+func (service *S3Service) handleAssumeRole(c *gin.Context, params url.Values) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleAssumeRole",
+	})
+
+	credential, err := service.authenticateSTSUser(c)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	roleArn, roleName, roleSessionName, err := getRoleParams(params)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	duration, err := service.getSTSDuration(params, stsAssumeRoleDuration)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	sessionPolicy, err := getSessionPolicy(params)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	// roles are not mapped to other iRODS users, the session acts as the caller
+	claims := &sts.Claims{
+		Username:        credential.Username,
+		Expiration:      time.Now().Add(duration).Unix(),
+		Policy:          sessionPolicy,
+		RoleArn:         roleArn,
+		RoleSessionName: roleSessionName,
+	}
+
+	credentials, err := service.stsIssuer.Issue(claims)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	logger.Infof("issued temporary credentials %s for %s assuming %s", credentials.AccessKeyID, credential.Username, roleArn)
+
+	service.setResponseHeader(c)
+	output := types.AssumeRoleResponse{
+		Result: types.AssumeRoleResult{
+			Credentials: types.NewSTSCredentials(credentials.AccessKeyID, credentials.SecretAccessKey, credentials.SessionToken, credentials.Expiration),
+			AssumedRoleUser: types.AssumedRoleUser{
+				Arn:           getAssumedRoleArn(roleName, roleSessionName),
+				AssumedRoleID: credentials.AccessKeyID + ":" + roleSessionName,
+			},
+		},
+		ResponseMetadata: types.STSResponseMetadata{
+			RequestID: c.Writer.Header().Get("X-Amz-Request-Id"),
+		},
+	}
+	c.XML(http.StatusOK, output)
+}
+
+func (service *S3Service) handleGetSessionToken(c *gin.Context, params url.Values) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleGetSessionToken",
+	})
+
+	credential, err := service.authenticateSTSUser(c)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	duration, err := service.getSTSDuration(params, stsSessionTokenDuration)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	claims := &sts.Claims{
+		Username:   credential.Username,
+		Expiration: time.Now().Add(duration).Unix(),
+	}
+
+	credentials, err := service.stsIssuer.Issue(claims)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	logger.Infof("issued temporary credentials %s for %s", credentials.AccessKeyID, credential.Username)
+
+	service.setResponseHeader(c)
+	output := types.GetSessionTokenResponse{
+		Result: types.GetSessionTokenResult{
+			Credentials: types.NewSTSCredentials(credentials.AccessKeyID, credentials.SecretAccessKey, credentials.SessionToken, credentials.Expiration),
+		},
+		ResponseMetadata: types.STSResponseMetadata{
+			RequestID: c.Writer.Header().Get("X-Amz-Request-Id"),
+		},
+	}
+	c.XML(http.StatusOK, output)
+}
+
+func (service *S3Service) handleAssumeRoleWithWebIdentity(c *gin.Context, params url.Values) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "handleAssumeRoleWithWebIdentity",
+	})
+
+	if service.oidcVerifier == nil {
+		service.writeSTSError(c, ErrInvalidIdentityToken.WithMessage("No OpenIDConnect provider is configured"))
+		return
+	}
+
+	roleArn, roleName, roleSessionName, err := getRoleParams(params)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	webIdentityToken := params.Get("WebIdentityToken")
+	if len(webIdentityToken) == 0 {
+		service.writeSTSError(c, ErrMissingParameter.WithMessage("WebIdentityToken is not given"))
+		return
+	}
+
+	if len(webIdentityToken) > webIdentityTokenSizeMax {
+		service.writeSTSError(c, ErrInvalidParameterValue.WithMessage("WebIdentityToken is too long"))
+		return
+	}
+
+	duration, err := service.getSTSDuration(params, stsAssumeRoleDuration)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	sessionPolicy, err := getSessionPolicy(params)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	// web identity requests are not signed, the token is the only credential
+	identityClaims, err := service.oidcVerifier.Verify(webIdentityToken)
+	if err != nil {
+		logger.Debugf("%+v", err)
+
+		if xerrors.Is(err, oidc.ErrExpiredToken) {
+			service.metrics.AddAuthFailure(ErrExpiredWebIdentityToken)
+			service.writeSTSError(c, ErrExpiredWebIdentityToken)
+			return
+		}
+
+		if xerrors.Is(err, oidc.ErrInvalidToken) {
+			service.metrics.AddAuthFailure(ErrInvalidIdentityToken)
+			service.writeSTSError(c, ErrInvalidIdentityToken)
+			return
+		}
+
+		// failed to get keys from the provider
+		service.writeSTSError(c, ErrInvalidIdentityToken.WithMessage("Couldn't retrieve verification key from your identity provider"))
+		return
+	}
+
+	username := identityClaims.GetString(service.config.OidcUsernameClaim)
+	if !irodsUsernameRegexp.MatchString(username) {
+		logger.Debugf("claim %s of %s is not a valid iRODS username: %q", service.config.OidcUsernameClaim, identityClaims.GetSubject(), username)
+		service.writeSTSError(c, ErrIDPRejectedClaim.WithMessage("Claim %s is not a valid username", service.config.OidcUsernameClaim))
+		return
+	}
+
+	if username == service.config.IrodsAdminUsername || username == ticketUsername {
+		service.writeSTSError(c, ErrIDPRejectedClaim.WithMessage("User %s cannot be assumed with a web identity", username))
+		return
+	}
+
+	claims := &sts.Claims{
+		Username:        username,
+		Expiration:      time.Now().Add(duration).Unix(),
+		Policy:          sessionPolicy,
+		RoleArn:         roleArn,
+		RoleSessionName: roleSessionName,
+	}
+
+	credentials, err := service.stsIssuer.Issue(claims)
+	if err != nil {
+		service.writeSTSError(c, err)
+		return
+	}
+
+	logger.Infof("issued temporary credentials %s for %s (subject %s) with web identity", credentials.AccessKeyID, username, identityClaims.GetSubject())
+
+	service.setResponseHeader(c)
+	output := types.AssumeRoleWithWebIdentityResponse{
+		Result: types.AssumeRoleWithWebIdentityResult{
+			Credentials:                 types.NewSTSCredentials(credentials.AccessKeyID, credentials.SecretAccessKey, credentials.SessionToken, credentials.Expiration),
+			SubjectFromWebIdentityToken: identityClaims.GetSubject(),
+			AssumedRoleUser: types.AssumedRoleUser{
+				Arn:           getAssumedRoleArn(roleName, roleSessionName),
+				AssumedRoleID: credentials.AccessKeyID + ":" + roleSessionName,
+			},
+			Provider: service.oidcVerifier.GetIssuer(),
+			Audience: service.oidcVerifier.GetAudience(),
+		},
+		ResponseMetadata: types.STSResponseMetadata{
+			RequestID: c.Writer.Header().Get("X-Amz-Request-Id"),
+		},
+	}
+	c.XML(http.StatusOK, output)
+}
@@ -0,0 +1,203 @@
+package sts
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// AccessKeyIDPrefix is the prefix of temporary access key ids, same as AWS
+	AccessKeyIDPrefix = "ASIA"
+
+	accessKeyIDLength   = 20
+	accessKeyIDLetters  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	signingKeyLength    = 32
+	sessionTokenVersion = "v1"
+)
+
+var (
+	// ErrInvalidToken is returned when a session token is malformed or forged
+	ErrInvalidToken = xerrors.New("invalid session token")
+	// ErrExpiredToken is returned when a session token is expired
+	ErrExpiredToken = xerrors.New("expired session token")
+)
+
+// Claims are contents of a session token
+type Claims struct {
+	AccessKeyID     string `json:"ak"`
+	Username        string `json:"u"`
+	Expiration      int64  `json:"exp"`
+	Policy          string `json:"p,omitempty"`
+	RoleArn         string `json:"r,omitempty"`
+	RoleSessionName string `json:"n,omitempty"`
+}
+
+// GetExpirationTime returns expiration time
+func (claims *Claims) GetExpirationTime() time.Time {
+	return time.Unix(claims.Expiration, 0).UTC()
+}
+
+// Credentials are temporary credentials issued
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// Issuer issues and verifies temporary credentials
+// session tokens are self-contained and signed, so no state is kept on the server
+type Issuer struct {
+	key []byte
+}
+
+// NewIssuer creates a new Issuer with the signing key
+func NewIssuer(key []byte) *Issuer {
+	return &Issuer{
+		key: key,
+	}
+}
+
+// LoadOrCreateSigningKey loads a signing key from the file, creates a new one if not exist
+func LoadOrCreateSigningKey(keyPath string) ([]byte, error) {
+	keyHex, err := os.ReadFile(keyPath)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(keyHex)))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to decode signing key %s: %w", keyPath, err)
+		}
+
+		if len(key) < signingKeyLength {
+			return nil, xerrors.Errorf("signing key %s is too short, requires %d bytes", keyPath, signingKeyLength)
+		}
+
+		return key, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, xerrors.Errorf("failed to read signing key %s: %w", keyPath, err)
+	}
+
+	key := make([]byte, signingKeyLength)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to generate signing key: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(keyPath), 0700)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to make a dir for signing key %s: %w", keyPath, err)
+	}
+
+	err = os.WriteFile(keyPath, []byte(hex.EncodeToString(key)), 0600)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to write signing key %s: %w", keyPath, err)
+	}
+
+	return key, nil
+}
+
+// Issue issues temporary credentials for the claims
+func (issuer *Issuer) Issue(claims *Claims) (*Credentials, error) {
+	if len(claims.AccessKeyID) == 0 {
+		accessKeyID, err := makeAccessKeyID()
+		if err != nil {
+			return nil, err
+		}
+		claims.AccessKeyID = accessKeyID
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal claims: %w", err)
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	signature := issuer.sign([]byte(sessionTokenVersion + "." + encodedPayload))
+
+	return &Credentials{
+		AccessKeyID:     claims.AccessKeyID,
+		SecretAccessKey: issuer.GetSecretAccessKey(claims.AccessKeyID),
+		SessionToken:    sessionTokenVersion + "." + encodedPayload + "." + base64.RawURLEncoding.EncodeToString(signature),
+		Expiration:      claims.GetExpirationTime(),
+	}, nil
+}
+
+// Verify verifies the session token and returns its claims
+func (issuer *Issuer) Verify(sessionToken string) (*Claims, error) {
+	parts := strings.Split(sessionToken, ".")
+	if len(parts) != 3 || parts[0] != sessionTokenVersion {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !hmac.Equal(signature, issuer.sign([]byte(parts[0]+"."+parts[1]))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := &Claims{}
+	err = json.Unmarshal(payload, claims)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().After(claims.GetExpirationTime()) {
+		return nil, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+// GetSecretAccessKey derives a secret access key for the temporary access key id
+func (issuer *Issuer) GetSecretAccessKey(accessKeyID string) string {
+	secret := issuer.sign([]byte("secret:" + accessKeyID))
+	return base64.StdEncoding.EncodeToString(secret)[:40]
+}
+
+// IsTemporaryAccessKeyID checks if the access key id has the shape of ones issued by an Issuer
+// usernames may have the same shape, so only requests with session tokens are checked
+func IsTemporaryAccessKeyID(accessKeyID string) bool {
+	return strings.HasPrefix(accessKeyID, AccessKeyIDPrefix) && len(accessKeyID) == accessKeyIDLength
+}
+
+func (issuer *Issuer) sign(data []byte) []byte {
+	hash := hmac.New(sha256.New, issuer.key)
+	hash.Write(data)
+	return hash.Sum(nil)
+}
+
+func makeAccessKeyID() (string, error) {
+	var sb strings.Builder
+	sb.WriteString(AccessKeyIDPrefix)
+
+	max := big.NewInt(int64(len(accessKeyIDLetters)))
+	for sb.Len() < accessKeyIDLength {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", xerrors.Errorf("failed to generate an access key id: %w", err)
+		}
+		sb.WriteByte(accessKeyIDLetters[n.Int64()])
+	}
+
+	return sb.String(), nil
+}
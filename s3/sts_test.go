@@ -0,0 +1,77 @@
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadSTSRequestBodyOnce(t *testing.T) {
+	form := "Action=GetSessionToken&DurationSeconds=3600"
+	body := &countingReader{reader: io.NopCloser(strings.NewReader(form))}
+
+	request := httptest.NewRequest(http.MethodPost, "/", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	params, err := getSTSParams(request)
+	if err != nil {
+		t.Fatalf("failed to get STS params: %v", err)
+	}
+
+	if params.Get("Action") != "GetSessionToken" || params.Get("DurationSeconds") != "3600" {
+		t.Errorf("unexpected params %v", params)
+	}
+
+	payloadHash, err := getPayloadHash(request)
+	if err != nil {
+		t.Fatalf("failed to get payload hash: %v", err)
+	}
+
+	expectedHash := sha256.Sum256([]byte(form))
+	if payloadHash != hex.EncodeToString(expectedHash[:]) {
+		t.Errorf("payload hash differs from the hash of the body")
+	}
+
+	if body.count != int64(len(form)) {
+		t.Errorf("expected the body to be read once, %d bytes read of %d", body.count, len(form))
+	}
+}
+
+func TestReadSTSRequestBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body io.Reader
+		size int
+		fail bool
+	}{
+		{"empty", nil, 0, false},
+		{"at limit", strings.NewReader(strings.Repeat("a", stsRequestBodyMax)), stsRequestBodyMax, false},
+		{"over limit", strings.NewReader(strings.Repeat("a", stsRequestBodyMax+1)), 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/", test.body)
+
+			body, err := readSTSRequestBody(request)
+			if test.fail {
+				if getS3ErrorCode(err) != ErrInvalidParameterValue.Code {
+					t.Errorf("expected %s, got %v", ErrInvalidParameterValue.Code, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+
+			if len(body) != test.size {
+				t.Errorf("expected %d bytes, got %d", test.size, len(body))
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package s3
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/activation"
+	"github.com/cyverse/s3rods/commons"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// getSystemdListeners returns sockets passed by systemd socket activation by their listener keys
+// sockets stay open while the service restarts, so clients don't see connections refused
+func getSystemdListeners() (map[string]net.Listener, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"function": "getSystemdListeners",
+	})
+
+	listeners, err := activation.Listeners()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get sockets passed by systemd: %w", err)
+	}
+
+	listenersByKey := map[string]net.Listener{}
+	for _, listener := range listeners {
+		if listener == nil {
+			// not a stream socket
+			continue
+		}
+
+		addr := listener.Addr()
+		logger.Infof("Using %s socket %s passed by systemd", addr.Network(), addr.String())
+		listenersByKey[getListenerKey(addr.Network(), addr.String())] = listener
+	}
+
+	return listenersByKey, nil
+}
+
+// watchdog pings the systemd watchdog while the service is ready
+// pings stop while readiness checks fail, so systemd restarts the service after WatchdogSec
+func (service *S3Service) watchdog(interval time.Duration) {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "S3Service",
+		"function": "watchdog",
+	})
+
+	logger.Infof("Pinging systemd watchdog every %s", interval/2)
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-service.requestContext.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(service.requestContext, interval/2)
+			output := service.checkReadiness(ctx)
+			cancel()
+
+			if output.Status != healthStatusOK {
+				logger.Warn("Not ready, skipping systemd watchdog ping")
+				continue
+			}
+
+			commons.SystemdNotify(commons.SystemdNotifyWatchdog)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package s3
+
+import (
+	"strings"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"github.com/cyverse/s3rods/irods"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ticketContextKey = "s3rods.ticket"
+)
+
+// authorizeTicketRequest checks if the request is in the scope of the ticket
+func (service *S3Service) authorizeTicketRequest(c *gin.Context, ticket *irods.Ticket, operation S3Operation) error {
+	ticketBucket, ticketKey, err := service.irodsController.SplitPath(ticket.Path)
+	if err != nil {
+		return ErrAccessDenied.WithMessage("%s", err.Error())
+	}
+
+	if operation.Bucket != ticketBucket {
+		return ErrAccessDenied.WithMessage("The ticket does not grant access to bucket %s", operation.Bucket)
+	}
+
+	if len(ticketKey) > 0 {
+		key := operation.Key
+		if len(key) == 0 {
+			// bucket listing within the ticket's collection
+			key = c.Request.URL.Query().Get("prefix")
+		}
+
+		if key != ticketKey && !strings.HasPrefix(key, ticketKey+"/") {
+			return ErrAccessDenied.WithMessage("The ticket does not grant access to %s", key)
+		}
+	}
+
+	if ticket.Type != irodsclient_types.TicketTypeWrite {
+		switch operation.Action {
+		case "s3:GetObject", "s3:ListBucket", "s3:GetBucketLocation":
+			// read
+		default:
+			return ErrAccessDenied.WithMessage("The ticket only grants read access")
+		}
+	}
+
+	return nil
+}
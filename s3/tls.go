@@ -0,0 +1,193 @@
+package s3
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// certificateCheckInterval is the interval of checking certificate files for changes
+	certificateCheckInterval = 10 * time.Second
+)
+
+// certificateFileState is a state of a file used to detect changes
+type certificateFileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// CertificateReloader serves a certificate that is reloaded when its files change
+// handshakes after reloading use the new certificate, established connections are kept
+type CertificateReloader struct {
+	certPath    string
+	keyPath     string
+	certificate *tls.Certificate
+	certState   certificateFileState
+	keyState    certificateFileState
+	terminated  bool
+	terminate   chan bool
+	mutex       sync.RWMutex
+}
+
+// NewCertificateReloader creates a new CertificateReloader, fails if the certificate can't be loaded
+func NewCertificateReloader(certPath string, keyPath string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{
+		certPath:   certPath,
+		keyPath:    keyPath,
+		terminated: false,
+		terminate:  make(chan bool),
+	}
+
+	err := reloader.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	go reloader.watch()
+
+	return reloader, nil
+}
+
+// Release stops watching certificate files
+func (reloader *CertificateReloader) Release() {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	if reloader.terminated {
+		return
+	}
+
+	reloader.terminated = true
+	close(reloader.terminate)
+}
+
+// Reload loads the certificate from files, the certificate loaded before is kept on failure
+func (reloader *CertificateReloader) Reload() error {
+	reloader.mutex.RLock()
+	certPath := reloader.certPath
+	keyPath := reloader.keyPath
+	reloader.mutex.RUnlock()
+
+	return reloader.ReloadFrom(certPath, keyPath)
+}
+
+// ReloadFrom loads the certificate from other files, files watched are switched only if loaded
+func (reloader *CertificateReloader) ReloadFrom(certPath string, keyPath string) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "CertificateReloader",
+		"function": "ReloadFrom",
+	})
+
+	// states are taken before loading so that a change during loading is picked up next time
+	certState, err := getCertificateFileState(certPath)
+	if err != nil {
+		return err
+	}
+
+	keyState, err := getCertificateFileState(keyPath)
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return xerrors.Errorf("failed to load certificate %s and key %s: %w", certPath, keyPath, err)
+	}
+
+	reloader.mutex.Lock()
+	reloader.certPath = certPath
+	reloader.keyPath = keyPath
+	reloader.certificate = &certificate
+	reloader.certState = certState
+	reloader.keyState = keyState
+	reloader.mutex.Unlock()
+
+	logger.Infof("Loaded certificate %s", certPath)
+	return nil
+}
+
+// GetCertificate returns the certificate loaded, used as tls.Config.GetCertificate
+func (reloader *CertificateReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+
+	return reloader.certificate, nil
+}
+
+// GetTLSConfig returns a TLS configuration serving the certificate
+func (reloader *CertificateReloader) GetTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+}
+
+// isChanged checks if certificate files are changed since loaded
+func (reloader *CertificateReloader) isChanged() bool {
+	reloader.mutex.RLock()
+	certPath := reloader.certPath
+	keyPath := reloader.keyPath
+	loadedCertState := reloader.certState
+	loadedKeyState := reloader.keyState
+	reloader.mutex.RUnlock()
+
+	certState, err := getCertificateFileState(certPath)
+	if err != nil {
+		// files being replaced, checked again later
+		return false
+	}
+
+	keyState, err := getCertificateFileState(keyPath)
+	if err != nil {
+		return false
+	}
+
+	return certState != loadedCertState || keyState != loadedKeyState
+}
+
+func (reloader *CertificateReloader) watch() {
+	logger := log.WithFields(log.Fields{
+		"package":  "s3",
+		"struct":   "CertificateReloader",
+		"function": "watch",
+	})
+
+	ticker := time.NewTicker(certificateCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !reloader.isChanged() {
+				continue
+			}
+
+			err := reloader.Reload()
+			if err != nil {
+				// a cert written before its key fails until both are written
+				logger.Errorf("failed to reload certificate, keeping the current one: %+v", err)
+			}
+		case <-reloader.terminate:
+			return
+		}
+	}
+}
+
+// getCertificateFileState returns a state of the file, symlinks are followed as certificates are often swapped by links
+func getCertificateFileState(path string) (certificateFileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return certificateFileState{}, xerrors.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	return certificateFileState{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}, nil
+}
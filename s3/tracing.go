@@ -0,0 +1,78 @@
+package s3
+
+import (
+	"fmt"
+
+	"github.com/cyverse/s3rods/irods"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/xid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/cyverse/s3rods/s3"
+)
+
+var (
+	tracer = otel.Tracer(tracerName)
+)
+
+// tracingMiddleware starts a span per S3 request, spans of authentication and iRODS calls are its children
+// the request id is assigned here so that spans and the X-Amz-Request-Id response header agree
+func (service *S3Service) tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.URL.Path == service.config.MetricsPath {
+			c.Next()
+			return
+		}
+
+		requestID := xid.New().String()
+		c.Writer.Header().Set("X-Amz-Request-Id", requestID)
+
+		// continue traces of clients sending traceparent
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		operation := getRequestOperationName(c)
+		ctx, span := tracer.Start(ctx, "S3."+operation,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(c.Request.Method),
+				semconv.HTTPTargetKey.String(c.Request.URL.Path),
+				semconv.HTTPClientIPKey.String(c.ClientIP()),
+				attribute.String("aws.request_id", requestID),
+				attribute.String("s3rods.operation", operation),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(irods.WithRequestID(ctx, requestID))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+
+		if credentialValue, ok := c.Get(credentialContextKey); ok {
+			span.SetAttributes(attribute.String("s3rods.user", credentialValue.(*AWSCredential).Username))
+		}
+
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("status %d", status))
+		}
+	}
+}
+
+// endSpan records the error and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
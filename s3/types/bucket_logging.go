@@ -0,0 +1,37 @@
+package types
+
+import (
+	"encoding/xml"
+)
+
+const (
+	bucketLoggingNamespace = "http://doc.s3.amazonaws.com/2006-03-01"
+)
+
+// BucketLoggingStatus is a request and response body of GetBucketLogging and PutBucketLogging
+// the namespace is written as an attribute so that requests without the namespace are accepted
+type BucketLoggingStatus struct {
+	XMLName        xml.Name        `xml:"BucketLoggingStatus"`
+	Xmlns          string          `xml:"xmlns,attr,omitempty"`
+	LoggingEnabled *LoggingEnabled `xml:"LoggingEnabled,omitempty"`
+}
+
+type LoggingEnabled struct {
+	TargetBucket string `xml:"TargetBucket"`
+	TargetPrefix string `xml:"TargetPrefix"`
+}
+
+func NewBucketLoggingStatus(targetBucket string, targetPrefix string) BucketLoggingStatus {
+	status := BucketLoggingStatus{
+		Xmlns: bucketLoggingNamespace,
+	}
+
+	if len(targetBucket) > 0 {
+		status.LoggingEnabled = &LoggingEnabled{
+			TargetBucket: targetBucket,
+			TargetPrefix: targetPrefix,
+		}
+	}
+
+	return status
+}
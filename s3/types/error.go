@@ -0,0 +1,22 @@
+package types
+
+import (
+	"encoding/xml"
+)
+
+type ErrorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource,omitempty"`
+	RequestID string   `xml:"RequestId"`
+}
+
+func NewErrorResponse(code string, message string, resource string, requestID string) ErrorResponse {
+	return ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Resource:  resource,
+		RequestID: requestID,
+	}
+}
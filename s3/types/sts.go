@@ -0,0 +1,78 @@
+package types
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+type STSCredentials struct {
+	AccessKeyID     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken"`
+	Expiration      time.Time `xml:"Expiration"`
+}
+
+func NewSTSCredentials(accessKeyID string, secretAccessKey string, sessionToken string, expiration time.Time) STSCredentials {
+	return STSCredentials{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		SessionToken:    sessionToken,
+		Expiration:      expiration.UTC(),
+	}
+}
+
+type AssumedRoleUser struct {
+	Arn           string `xml:"Arn"`
+	AssumedRoleID string `xml:"AssumedRoleId"`
+}
+
+type STSResponseMetadata struct {
+	RequestID string `xml:"RequestId"`
+}
+
+type AssumeRoleResult struct {
+	Credentials     STSCredentials  `xml:"Credentials"`
+	AssumedRoleUser AssumedRoleUser `xml:"AssumedRoleUser"`
+}
+
+type AssumeRoleResponse struct {
+	XMLName          xml.Name            `xml:"https://sts.amazonaws.com/doc/2011-06-15/ AssumeRoleResponse"`
+	Result           AssumeRoleResult    `xml:"AssumeRoleResult"`
+	ResponseMetadata STSResponseMetadata `xml:"ResponseMetadata"`
+}
+
+type AssumeRoleWithWebIdentityResult struct {
+	Credentials                 STSCredentials  `xml:"Credentials"`
+	SubjectFromWebIdentityToken string          `xml:"SubjectFromWebIdentityToken"`
+	AssumedRoleUser             AssumedRoleUser `xml:"AssumedRoleUser"`
+	Provider                    string          `xml:"Provider"`
+	Audience                    string          `xml:"Audience"`
+}
+
+type AssumeRoleWithWebIdentityResponse struct {
+	XMLName          xml.Name                        `xml:"https://sts.amazonaws.com/doc/2011-06-15/ AssumeRoleWithWebIdentityResponse"`
+	Result           AssumeRoleWithWebIdentityResult `xml:"AssumeRoleWithWebIdentityResult"`
+	ResponseMetadata STSResponseMetadata             `xml:"ResponseMetadata"`
+}
+
+type GetSessionTokenResult struct {
+	Credentials STSCredentials `xml:"Credentials"`
+}
+
+type GetSessionTokenResponse struct {
+	XMLName          xml.Name              `xml:"https://sts.amazonaws.com/doc/2011-06-15/ GetSessionTokenResponse"`
+	Result           GetSessionTokenResult `xml:"GetSessionTokenResult"`
+	ResponseMetadata STSResponseMetadata   `xml:"ResponseMetadata"`
+}
+
+type STSError struct {
+	Type    string `xml:"Type"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type STSErrorResponse struct {
+	XMLName   xml.Name `xml:"https://sts.amazonaws.com/doc/2011-06-15/ ErrorResponse"`
+	Error     STSError `xml:"Error"`
+	RequestID string   `xml:"RequestId"`
+}